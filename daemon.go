@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sensu/sensu-prometheus-collector/pkg/collector"
+)
+
+// DaemonOptions configure the daemon mode of the collector.
+type DaemonOptions struct {
+	// Interval is the time between the starts of two runs.
+	Interval time.Duration
+	// PprofPort is the localhost port of the net/http/pprof endpoints, 0
+	// for none.
+	PprofPort int
+	// HealthAddr is the address of the /healthz endpoint, empty for none.
+	HealthAddr string
+}
+
+// Daemon runs the collector every interval as a resident process, in place
+// of being run by the Sensu agent on every check execution, e.g. to keep
+// streaming the metrics to a sendto output.
+type Daemon struct {
+	options DaemonOptions
+	health  Health
+	// validating is set on the daemons of the runs validating a reloaded
+	// config file.
+	validating bool
+
+	configPath string
+	config     []byte
+}
+
+// NewDaemon returns a daemon with the options.
+func NewDaemon(options DaemonOptions) *Daemon {
+	return &Daemon{options: options}
+}
+
+// Run starts the pprof and health endpoints, if enabled, and runs the
+// collector with args every interval. A run overrunning the interval delays
+// the next one. It returns ErrInterrupted once ctx is canceled and the run
+// in flight has output its samples, or an error if the endpoints cannot be
+// served.
+func (d *Daemon) Run(ctx context.Context, args []string) error {
+	if d.options.PprofPort != 0 {
+		listener, err := net.Listen("tcp", net.JoinHostPort("localhost", strconv.Itoa(d.options.PprofPort)))
+
+		if err != nil {
+			return fmt.Errorf("-pprof-port: %v", err)
+		}
+
+		go http.Serve(listener, PprofHandler())
+
+		collector.Infof("Serving pprof on http://%s/debug/pprof/", listener.Addr())
+	}
+
+	ticker := time.NewTicker(d.options.Interval)
+	defer ticker.Stop()
+
+	if d.options.HealthAddr != "" {
+		listener, err := net.Listen("tcp", d.options.HealthAddr)
+
+		if err != nil {
+			return fmt.Errorf("-health-addr: %v", err)
+		}
+
+		go http.Serve(listener, d.health.Handler())
+
+		collector.Infof("Serving health on http://%s/healthz", listener.Addr())
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		start := time.Now()
+		d.health.RunStarted()
+		code := run(ctx, args, d)
+		d.health.RunExited(code, time.Since(start) > d.options.Interval)
+		collector.LogFields{"exit_code": code, "duration": time.Since(start)}.Debugf("Run exited %d after %s", code, time.Since(start))
+
+		// The config file is reloaded between runs, a SIGHUP received
+		// during a run being handled once it exits.
+		for waiting := true; waiting; {
+			select {
+			case <-ticker.C:
+				waiting = false
+			case <-hup:
+				d.ReloadConfigFile(args)
+			case <-ctx.Done():
+				return collector.ErrInterrupted
+			}
+		}
+	}
+}
+
+// LoadConfigFile applies the config file to the flag set as
+// LoadConfigFile. In daemon mode, the file is read by the first run and
+// reread on SIGHUP, so a file being edited does not break the runs in
+// between.
+func (d *Daemon) LoadConfigFile(path string, flags *flag.FlagSet) error {
+	if d == nil {
+		return collector.LoadConfigFile(path, flags)
+	}
+
+	if d.config == nil || d.configPath != path {
+		data, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		d.configPath, d.config = path, data
+	}
+
+	return collector.ApplyConfig(d.configPath, d.config, flags)
+}
+
+// ReloadConfigFile rereads the config file for the next runs of the
+// command line args. The file is validated as on startup, applied to a new
+// flag set without collecting the metrics, and the previous one is kept if
+// it cannot be read, is invalid or changes the daemon options, which only
+// apply on startup.
+func (d *Daemon) ReloadConfigFile(args []string) {
+	if d.configPath == "" {
+		collector.Warnf("No -config file to reload")
+		return
+	}
+
+	data, err := ioutil.ReadFile(d.configPath)
+
+	if err == nil {
+		validator := &Daemon{options: d.options, validating: true, configPath: d.configPath, config: data}
+		_, _, err = collectMetrics(context.Background(), args, validator)
+	}
+
+	if err != nil {
+		log.Printf("Error: failed to reload config file %s, keeping the previous one: %v", d.configPath, err)
+		return
+	}
+
+	d.config = data
+
+	collector.Infof("Reloaded config file %s", d.configPath)
+}
+
+// CheckOptions returns an error if options, e.g. those of a reloaded config
+// file, differ from the options the daemon was started with. It does
+// nothing outside of daemon mode.
+func (d *Daemon) CheckOptions(options DaemonOptions) error {
+	if d != nil && options != d.options {
+		return errors.New("-interval, -pprof-port and -health-addr only change when the daemon is restarted")
+	}
+
+	return nil
+}
+
+// Validating reports whether the run only validates the options, of a
+// reloaded config file, without collecting the metrics.
+func (d *Daemon) Validating() bool {
+	return d != nil && d.validating
+}
+
+// Scraped records that the targets of the current run were scraped or
+// queried successfully. It does nothing outside of daemon mode.
+func (d *Daemon) Scraped() {
+	if d != nil {
+		d.health.Scraped()
+	}
+}
+
+// PprofHandler serves the net/http/pprof endpoints under /debug/pprof/.
+func PprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return mux
+}
+
+// ValidateDaemonOptions checks the options of the daemon mode.
+func ValidateDaemonOptions(options DaemonOptions) error {
+	if options.Interval < 0 {
+		return fmt.Errorf("-interval must not be negative, got %s", options.Interval)
+	}
+
+	if options.PprofPort < 0 || options.PprofPort > 65535 {
+		return fmt.Errorf("-pprof-port must be a port number, got %d", options.PprofPort)
+	}
+
+	if options.PprofPort != 0 && options.Interval == 0 {
+		return fmt.Errorf("-pprof-port is only supported in daemon mode, with -interval")
+	}
+
+	if options.HealthAddr != "" && options.Interval == 0 {
+		return fmt.Errorf("-health-addr is only supported in daemon mode, with -interval")
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDaemonOptions(t *testing.T) {
+	assert.NoError(t, ValidateDaemonOptions(DaemonOptions{}))
+	assert.NoError(t, ValidateDaemonOptions(DaemonOptions{Interval: time.Minute, PprofPort: 6060}))
+	assert.EqualError(t, ValidateDaemonOptions(DaemonOptions{Interval: -time.Minute}), "-interval must not be negative, got -1m0s")
+	assert.EqualError(t, ValidateDaemonOptions(DaemonOptions{Interval: time.Minute, PprofPort: 70000}), "-pprof-port must be a port number, got 70000")
+	assert.EqualError(t, ValidateDaemonOptions(DaemonOptions{PprofPort: 6060}), "-pprof-port is only supported in daemon mode, with -interval")
+	assert.EqualError(t, ValidateDaemonOptions(DaemonOptions{HealthAddr: ":8080"}), "-health-addr is only supported in daemon mode, with -interval")
+}
+
+func TestPprofHandler(t *testing.T) {
+	server := httptest.NewServer(PprofHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/pprof/")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/debug/pprof/heap")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestCollectorDaemon(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("up 1\n"))
+	}))
+	defer server.Close()
+
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "COLLECTOR_TEST_ARGS="+strings.Join([]string{"-exporter-url", server.URL, "-interval", "50ms"}, "\n"))
+
+	var output strings.Builder
+	cmd.Stdout = &output
+
+	assert.NoError(t, cmd.Start())
+	time.Sleep(300 * time.Millisecond)
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	assert.True(t, strings.Count(output.String(), "up value=1 ") >= 2, output.String())
+}
+
+func TestDaemonReloadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "check.yml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("interval: 1m\nmetric-prefix: a\n"), 0644))
+
+	daemon := NewDaemon(DaemonOptions{Interval: time.Minute})
+	args := []string{"-config", path, "-exporter-url", "http://127.0.0.1:1/metrics"}
+
+	prefix := func() string {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Duration("interval", 0, "")
+		flags.String("output-format", "", "")
+		metricPrefix := flags.String("metric-prefix", "", "")
+		assert.NoError(t, daemon.LoadConfigFile(path, flags))
+		return *metricPrefix
+	}
+
+	assert.Equal(t, "a", prefix())
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("interval: 1m\nmetric-prefix: b\n"), 0644))
+	assert.Equal(t, "a", prefix())
+
+	daemon.ReloadConfigFile(args)
+	assert.Equal(t, "b", prefix())
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("interval: 1m\nmetric-prefix: [c\n"), 0644))
+	daemon.ReloadConfigFile(args)
+	assert.Equal(t, "b", prefix())
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("interval: 1m\nmetric-prefix: c\noutput-format: bogus\n"), 0644))
+	daemon.ReloadConfigFile(args)
+	assert.Equal(t, "b", prefix())
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("interval: 2m\nmetric-prefix: c\n"), 0644))
+	daemon.ReloadConfigFile(args)
+	assert.Equal(t, "b", prefix())
+}
+
+func TestCollectorDaemonSIGHUP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("up 1\n"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "check.yml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("exporter-url: "+server.URL+"\nmetric-prefix: before.\n"), 0644))
+
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "COLLECTOR_TEST_ARGS="+strings.Join([]string{"-config", path, "-interval", "50ms"}, "\n"))
+
+	var output strings.Builder
+	cmd.Stdout = &output
+
+	assert.NoError(t, cmd.Start())
+	time.Sleep(200 * time.Millisecond)
+	assert.NoError(t, ioutil.WriteFile(path, []byte("exporter-url: "+server.URL+"\nmetric-prefix: after.\n"), 0644))
+	time.Sleep(200 * time.Millisecond)
+	cmd.Process.Signal(syscall.SIGHUP)
+	time.Sleep(200 * time.Millisecond)
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	before := strings.Index(output.String(), "before.up value=1 ")
+	after := strings.Index(output.String(), "after.up value=1 ")
+	if assert.True(t, before >= 0 && after > before, output.String()) {
+		assert.NotContains(t, output.String()[after:], "before.up")
+	}
+}
@@ -3,17 +3,21 @@ module github.com/sensu/sensu-prometheus-collector
 go 1.13
 
 require (
-	github.com/beorn7/perks v0.0.0-20180321164747-3a771d992973
+	github.com/BurntSushi/toml v1.2.1
+	github.com/beorn7/perks v1.0.1
 	github.com/davecgh/go-spew v1.1.1
-	github.com/golang/protobuf v1.2.0
+	github.com/eclipse/paho.mqtt.golang v1.2.0
+	github.com/golang/protobuf v1.4.3
 	github.com/kelseyhightower/envconfig v1.3.0
 	github.com/matttproud/golang_protobuf_extensions v1.0.1
+	github.com/nats-io/nats.go v1.13.0
 	github.com/pmezard/go-difflib v1.0.0
-	github.com/prometheus/client_golang v0.8.0
-	github.com/prometheus/client_model v0.0.0-20180712105110-5c3871d89910
-	github.com/prometheus/common v0.0.0-20181126121408-4724e9255275
-	github.com/prometheus/procfs v0.0.0-20181204211112-1dc9a6cbc91a
-	github.com/smira/go-statsd v1.3.2
-	github.com/stretchr/testify v1.2.2
-	golang.org/x/net v0.0.0-20181207154023-610586996380
+	github.com/prometheus/client_golang v1.11.1
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.26.0
+	github.com/prometheus/procfs v0.6.0
+	github.com/streadway/amqp v1.0.0
+	github.com/stretchr/testify v1.4.0
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
+	gopkg.in/yaml.v2 v2.4.0
 )
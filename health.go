@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Health is the state of the daemon reported by /healthz: the status of
+// the last completed run, whether one is in progress, and the time of the
+// last successful scrape.
+type Health struct {
+	mu          sync.Mutex
+	runs        int
+	running     bool
+	runStart    time.Time
+	runScraped  bool
+	scraped     bool
+	exitCode    int
+	lastRun     time.Time
+	lastSuccess time.Time
+	overruns    int
+}
+
+// HealthReport is the JSON body of /healthz.
+type HealthReport struct {
+	// Status is starting until the first run exits, then ok if the last
+	// completed run scraped or queried its targets successfully, failing
+	// otherwise. A run in progress does not change it.
+	Status      string     `json:"status"`
+	ExitCode    int        `json:"exit_code"`
+	InProgress  bool       `json:"in_progress"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	// Overruns is the number of runs which took longer than the interval,
+	// delaying the next one.
+	Overruns int `json:"overruns"`
+}
+
+// RunStarted records the start of a run.
+func (h *Health) RunStarted() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.running = true
+	h.runStart = time.Now()
+	h.runScraped = false
+}
+
+// Scraped records that the targets of the current run were scraped or
+// queried successfully.
+func (h *Health) Scraped() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.runScraped = true
+	h.lastSuccess = time.Now()
+}
+
+// RunExited records the exit code of a run, and whether it overran the
+// interval.
+func (h *Health) RunExited(code int, overran bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.runs++
+	h.running = false
+	h.scraped = h.runScraped
+	h.exitCode = code
+	h.lastRun = h.runStart
+
+	if overran {
+		h.overruns++
+	}
+}
+
+// Report returns the health report.
+func (h *Health) Report() HealthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	report := HealthReport{Status: "starting", ExitCode: h.exitCode, InProgress: h.running, Overruns: h.overruns}
+
+	if h.runs > 0 {
+		report.Status = "failing"
+		lastRun := h.lastRun
+		report.LastRun = &lastRun
+
+		if h.scraped {
+			report.Status = "ok"
+		}
+	}
+
+	if !h.lastSuccess.IsZero() {
+		lastSuccess := h.lastSuccess
+		report.LastSuccess = &lastSuccess
+	}
+
+	return report
+}
+
+// Handler serves the health report on /healthz, with status 200 when it is
+// ok and 503 otherwise, as Kubernetes probes and Sensu http checks expect.
+func (h *Health) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		report := h.Report()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if report.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		json.NewEncoder(w).Encode(report)
+	})
+
+	return mux
+}
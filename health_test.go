@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	var health Health
+
+	report := health.Report()
+	assert.Equal(t, "starting", report.Status)
+	assert.Nil(t, report.LastRun)
+	assert.Nil(t, report.LastSuccess)
+
+	health.RunStarted()
+	health.Scraped()
+	health.RunExited(1, true)
+
+	report = health.Report()
+	assert.Equal(t, "ok", report.Status)
+	assert.Equal(t, 1, report.ExitCode)
+	assert.False(t, report.InProgress)
+	assert.Equal(t, 1, report.Overruns)
+	assert.NotNil(t, report.LastRun)
+	assert.NotNil(t, report.LastSuccess)
+
+	lastRun, lastSuccess := *report.LastRun, *report.LastSuccess
+
+	// A run in progress is reported without changing the status of the
+	// last completed run.
+	health.RunStarted()
+
+	report = health.Report()
+	assert.Equal(t, "ok", report.Status)
+	assert.True(t, report.InProgress)
+	assert.Equal(t, lastRun, *report.LastRun)
+
+	health.RunExited(2, false)
+
+	report = health.Report()
+	assert.Equal(t, "failing", report.Status)
+	assert.Equal(t, 2, report.ExitCode)
+	assert.False(t, report.InProgress)
+	assert.Equal(t, 1, report.Overruns)
+	assert.Equal(t, lastSuccess, *report.LastSuccess)
+}
+
+func TestHealthHandler(t *testing.T) {
+	var health Health
+
+	server := httptest.NewServer(health.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/healthz")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	health.RunStarted()
+	health.Scraped()
+	health.RunExited(0, false)
+	health.RunStarted()
+
+	resp, err = http.Get(server.URL + "/healthz")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var report HealthReport
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, "ok", report.Status)
+	assert.True(t, report.InProgress)
+}
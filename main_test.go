@@ -1,24 +1,211 @@
 package main
 
 import (
+	"crypto/tls"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
-	"time"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sensu/sensu-prometheus-collector/pkg/collector"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestQueryExporter(t *testing.T) {
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(":7777", nil)
-	}()
+// TestMain runs main in place of the tests when the test binary is run
+// by runCollector, with the arguments in COLLECTOR_TEST_ARGS.
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv("COLLECTOR_TEST_ARGS"); ok {
+		os.Args = append([]string{"sensu-prometheus-collector"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
 
-	time.Sleep(2 * time.Second)
+	os.Exit(m.Run())
+}
+
+// runCollector runs the collector with args through the whole pipeline,
+// returning its standard output and exit code.
+func runCollector(t *testing.T, args ...string) (string, int) {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "COLLECTOR_TEST_ARGS="+strings.Join(args, "\n"))
+
+	output, err := cmd.Output()
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(output), exitErr.ExitCode()
+	}
+
+	assert.NoError(t, err)
+	return string(output), 0
+}
+
+func TestQueryPrometheusScalar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1506991200,"3"]}}`))
+	}))
+	defer server.Close()
+
+	samples, err := collector.QueryPrometheus(server.URL, "scalar(count(up))", collector.PrometheusAuth{}, &tls.Config{}, collector.RequestOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "scalar 3 1506991200\n", collector.CreateGraphiteMetrics(samples, "", "", "s"))
+
+	output, code := runCollector(t, "-prom-url", server.URL, "-prom-query", "scalar(count(up))", "-scalar-metric", "up_count")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "up_count value=3 1506991200000000000\n", output)
+}
+
+func TestCollectorSubquery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[` +
+			`{"metric":{"__name__":"up","job":"node"},"values":[[1506991200,"1"],[1506991260,"0"]]}]}}`))
+	}))
+	defer server.Close()
 
-	samples, err := QueryExporter("http://localhost:7777/metrics", ExporterAuth{User: "", Password: "", Header: ""}, false)
+	output, code := runCollector(t, "-prom-url", server.URL, "-prom-query", "up[2m:1m]")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "up,job=node value=1 1506991200000000000\nup,job=node value=0 1506991260000000000\n", output)
+
+	output, code = runCollector(t, "-prom-url", server.URL, "-prom-query", "up[2m:1m]", "-duplicate-samples", "error", "-output-format", "graphite")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "up 1 1506991200\nup 0 1506991260\n", output)
+}
+
+func TestCollectorDryRun(t *testing.T) {
+	output, code := runCollector(t, "-exporter-url", "http://127.0.0.1:1/metrics", "-dry-run")
+	assert.Equal(t, 0, code)
+	assert.Empty(t, output)
+
+	_, code = runCollector(t, "-exporter-url", "http://127.0.0.1:1/metrics", "-dry-run", "-dry-run-connect")
+	assert.Equal(t, 2, code)
+
+	_, code = runCollector(t, "-exporter-url", "http://127.0.0.1:1/metrics", "-dry-run", "-include-regex", "(")
+	assert.Equal(t, 2, code)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("up 1\n"))
+	}))
+	defer server.Close()
+
+	output, code = runCollector(t, "-exporter-url", server.URL, "-dry-run", "-dry-run-connect")
+	assert.Equal(t, 0, code)
+	assert.Empty(t, output)
+
+	counterServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# TYPE req_total counter\nreq_total 5\n"))
+	}))
+	defer counterServer.Close()
+
+	stateDir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(stateDir)
+
+	_, code = runCollector(t, "-exporter-url", counterServer.URL, "-counter-mode", "delta", "-state-dir", stateDir)
+	assert.Equal(t, 0, code)
+
+	states, err := filepath.Glob(filepath.Join(stateDir, "*"))
+	assert.NoError(t, err)
+	assert.Len(t, states, 1)
 
+	state, err := ioutil.ReadFile(states[0])
 	assert.NoError(t, err)
-	assert.NotNil(t, samples)
+	assert.Contains(t, string(state), "req_total")
+
+	for _, args := range [][]string{{"-dry-run"}, {"-dry-run", "-dry-run-connect"}} {
+		_, code = runCollector(t, append([]string{"-exporter-url", counterServer.URL, "-counter-mode", "delta", "-state-dir", stateDir}, args...)...)
+		assert.Equal(t, 0, code)
+
+		dryRunState, err := ioutil.ReadFile(states[0])
+		assert.NoError(t, err)
+		assert.Equal(t, string(state), string(dryRunState))
+	}
+}
+
+func TestCollectorMetaMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("up 1\nnode_load1 0.5\nnode_load5 0.25\n"))
+	}))
+	defer server.Close()
+
+	output, code := runCollector(t, "-exporter-url", server.URL, "-include-names", "up", "-meta-metrics")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, output, "collector_samples_scraped value=3 ")
+	assert.Contains(t, output, "collector_samples_filtered value=2 ")
+	assert.Contains(t, output, "collector_scrape_duration_seconds value=")
+}
+
+func TestCollectorVerboseStdout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("up 1\n"))
+	}))
+	defer server.Close()
+
+	output, code := runCollector(t, "-exporter-url", server.URL, "-output-format", "graphite", "-honor-timestamps=false", "-v")
+	assert.Equal(t, 0, code)
+	assert.Regexp(t, `^up 1 \d+\n$`, output)
+}
+
+func TestCollectorUnknownOutputFormat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("up 1\n"))
+	}))
+	defer server.Close()
+
+	output, code := runCollector(t, "-exporter-url", server.URL, "-output-format", "graphite,bogus", "-exit-code", "config=3")
+	assert.Equal(t, 3, code)
+	assert.Empty(t, output)
+}
+
+func TestCollectorStatsdCounters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("up 1\n"))
+	}))
+	defer server.Close()
+
+	// Statsd type rules only matter to the sendtostatsd output.
+	output, code := runCollector(t, "-exporter-url", server.URL, "-output-format", "graphite", "-statsd-type", "_total$=counter", "-exit-code", "config=3")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, output, "up 1")
+
+	_, code = runCollector(t, "-exporter-url", server.URL, "-output-format", "graphite,sendtostatsd", "-statsd-type", "_total$=counter", "-dry-run", "-exit-code", "config=3")
+	assert.Equal(t, 3, code)
+
+	_, code = runCollector(t, "-exporter-url", server.URL, "-output-format", "sendtostatsd", "-statsd-type", "_total$=counter", "-counter-mode", "delta", "-dry-run", "-exit-code", "config=3")
+	assert.Equal(t, 0, code)
+}
+
+func TestCollectorPartialScrape(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("up 1\n"))
+	}))
+	defer server.Close()
+
+	// The samples of the scraped exporters are output, the exit code
+	// reporting the unreachable one.
+	output, code := runCollector(t, "-exporter-url", server.URL+","+"http://127.0.0.1:1/metrics", "-output-format", "graphite", "-exit-code", "unreachable=4")
+	assert.Equal(t, 4, code)
+	assert.Contains(t, output, "up 1")
+}
+
+func TestCollectorConfigExitCodes(t *testing.T) {
+	// Options are validated before the exporters are scraped.
+	_, code := runCollector(t, "-exporter-url", "http://127.0.0.1:1/metrics", "-output-format", "sendtomqtt", "-mqtt-qos", "3", "-exit-code", "config=3")
+	assert.Equal(t, 3, code)
+
+	_, code = runCollector(t, "-exporter-url", "http://127.0.0.1:1/metrics", "-global-tags", `env:"unterminated`, "-exit-code", "config=3")
+	assert.Equal(t, 3, code)
+
+	_, code = runCollector(t, "-output-format", "bogus", "-exit-code", "config=3")
+	assert.Equal(t, 3, code)
+
+	_, code = runCollector(t, "-config", "/nonexistent/check.yml", "-exit-code", "config=3")
+	assert.Equal(t, 3, code)
+
+	_, code = runCollector(t, "-version", "-version-format", "yaml", "-exit-code", "config=3")
+	assert.Equal(t, 3, code)
 }
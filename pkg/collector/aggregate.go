@@ -0,0 +1,199 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// aggregationExpression parses aggregations like
+// sum by (instance) (node_cpu_.*).
+var aggregationExpression = regexp.MustCompile(`^\s*(sum|avg|min|max|count)\s*(?:(by|without)\s*\(([^)]*)\))?\s*(?:\((.*)\))?\s*$`)
+
+// Aggregation aggregates the samples of a metric like a PromQL aggregation
+// operator, grouped by, or without, labels. Unlike PromQL the metric name is
+// kept, so the samples of every metric are aggregated separately.
+type Aggregation struct {
+	Operator string
+	// Without groups the samples by all the labels but Labels, rather than
+	// by Labels.
+	Without bool
+	Labels  map[model.LabelName]bool
+	// Names matches the names of the metrics to aggregate, all of them
+	// when nil.
+	Names *regexp.Regexp
+}
+
+// ParseAggregation parses an aggregation, <sum|avg|min|max|count>
+// [by|without (<label>, ...)] [(<metric name regex>)], e.g.
+// sum without (cpu) (node_cpu_seconds_total). The regex is anchored at both
+// ends.
+func ParseAggregation(aggregation string) (*Aggregation, error) {
+	match := aggregationExpression.FindStringSubmatch(aggregation)
+
+	if match == nil {
+		return nil, fmt.Errorf("invalid aggregation %q, expected <sum|avg|min|max|count> [by|without (<label>, ...)] [(<metric name regex>)]", aggregation)
+	}
+
+	a := &Aggregation{
+		Operator: match[1],
+		Without:  match[2] == "without",
+		Labels:   map[model.LabelName]bool{},
+	}
+
+	for _, name := range strings.Split(match[3], ",") {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		if !model.LabelName(name).IsValid() {
+			return nil, fmt.Errorf("invalid aggregation %q, invalid label name %q", aggregation, name)
+		}
+
+		a.Labels[model.LabelName(name)] = true
+	}
+
+	if names := strings.TrimSpace(match[4]); names != "" {
+		re, err := regexp.Compile("^(?:" + names + ")$")
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid aggregation %q: %v", aggregation, err)
+		}
+
+		a.Names = re
+	}
+
+	return a, nil
+}
+
+// ParseAggregations parses aggregations, see ParseAggregation.
+func ParseAggregations(aggregations []string) ([]*Aggregation, error) {
+	var parsed []*Aggregation
+
+	for _, aggregation := range aggregations {
+		a, err := ParseAggregation(aggregation)
+
+		if err != nil {
+			return nil, err
+		}
+
+		parsed = append(parsed, a)
+	}
+
+	return parsed, nil
+}
+
+// groupMetric returns the metric of the group of a sample.
+func (a *Aggregation) groupMetric(metric model.Metric) model.Metric {
+	group := model.Metric{}
+
+	for name, value := range metric {
+		if name == model.MetricNameLabel || a.Labels[name] != a.Without {
+			group[name] = value
+		}
+	}
+
+	return group
+}
+
+// AggregateSamples aggregates the samples of the metrics matching an
+// aggregation, by the first one matching, into a sample per group with the
+// newest timestamp of the group. The samples of other metrics are kept.
+// With byTimestamp, e.g. for range queries, only the samples of a group
+// with the same timestamp are aggregated.
+func AggregateSamples(samples model.Vector, aggregations []*Aggregation, byTimestamp bool) model.Vector {
+	type groupKey struct {
+		fingerprint model.Fingerprint
+		timestamp   model.Time
+	}
+
+	type group struct {
+		sample    *model.Sample
+		operator  string
+		sum       float64
+		count     int
+		aggregate bool
+	}
+
+	var groups []*group
+	groupIndex := map[groupKey]*group{}
+
+	for _, sample := range samples {
+		var aggregation *Aggregation
+
+		for _, a := range aggregations {
+			if a.Names == nil || a.Names.MatchString(string(sample.Metric[model.MetricNameLabel])) {
+				aggregation = a
+				break
+			}
+		}
+
+		if aggregation == nil {
+			groups = append(groups, &group{sample: sample})
+			continue
+		}
+
+		metric := aggregation.groupMetric(sample.Metric)
+		key := groupKey{fingerprint: metric.Fingerprint()}
+		if byTimestamp {
+			key.timestamp = sample.Timestamp
+		}
+
+		value := float64(sample.Value)
+		g, ok := groupIndex[key]
+
+		if !ok {
+			g = &group{
+				sample:    &model.Sample{Metric: metric, Value: sample.Value, Timestamp: sample.Timestamp},
+				operator:  aggregation.Operator,
+				aggregate: true,
+			}
+			groups = append(groups, g)
+			groupIndex[key] = g
+		} else {
+			current := float64(g.sample.Value)
+
+			switch g.operator {
+			case "min":
+				if value < current || math.IsNaN(current) {
+					g.sample.Value = sample.Value
+				}
+			case "max":
+				if value > current || math.IsNaN(current) {
+					g.sample.Value = sample.Value
+				}
+			}
+
+			if sample.Timestamp.After(g.sample.Timestamp) {
+				g.sample.Timestamp = sample.Timestamp
+			}
+		}
+
+		g.sum += value
+		g.count++
+	}
+
+	aggregated := make(model.Vector, 0, len(groups))
+
+	for _, g := range groups {
+		if g.aggregate {
+			switch g.operator {
+			case "sum":
+				g.sample.Value = model.SampleValue(g.sum)
+			case "avg":
+				g.sample.Value = model.SampleValue(g.sum / float64(g.count))
+			case "count":
+				g.sample.Value = model.SampleValue(g.count)
+			}
+		}
+
+		aggregated = append(aggregated, g.sample)
+	}
+
+	return aggregated
+}
@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAggregation(t *testing.T) {
+	a, err := ParseAggregation("sum by (instance, job)")
+	assert.NoError(t, err)
+	assert.Equal(t, "sum", a.Operator)
+	assert.False(t, a.Without)
+	assert.Equal(t, map[model.LabelName]bool{"instance": true, "job": true}, a.Labels)
+	assert.Nil(t, a.Names)
+
+	a, err = ParseAggregation("avg without(cpu) (node_cpu_.*)")
+	assert.NoError(t, err)
+	assert.True(t, a.Without)
+	assert.True(t, a.Names.MatchString("node_cpu_seconds_total"))
+	assert.False(t, a.Names.MatchString("go_node_cpu_seconds_total"))
+
+	a, err = ParseAggregation("count")
+	assert.NoError(t, err)
+	assert.Empty(t, a.Labels)
+
+	for _, aggregation := range []string{"stddev by (cpu)", "sum by cpu", "sum by (1cpu)", "sum (()"} {
+		_, err := ParseAggregation(aggregation)
+		assert.Error(t, err, aggregation)
+	}
+}
+
+func TestAggregateSamples(t *testing.T) {
+	cpu := func(cpu string, mode string, value model.SampleValue, timestamp model.Time) *model.Sample {
+		return &model.Sample{
+			Metric:    model.Metric{model.MetricNameLabel: "node_cpu_seconds_total", "cpu": model.LabelValue(cpu), "mode": model.LabelValue(mode)},
+			Value:     value,
+			Timestamp: timestamp,
+		}
+	}
+
+	load := &model.Sample{Metric: model.Metric{model.MetricNameLabel: "node_load1"}, Value: 0.5, Timestamp: 1000}
+
+	samples := model.Vector{
+		cpu("0", "idle", 10, 1000),
+		load,
+		cpu("1", "idle", 30, 2000),
+		cpu("0", "user", 5, 1000),
+	}
+
+	aggregations, err := ParseAggregations([]string{"sum without (cpu) (node_cpu_.*)"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "node_cpu_seconds_total", "mode": "idle"}, Value: 40, Timestamp: 2000},
+		load,
+		{Metric: model.Metric{model.MetricNameLabel: "node_cpu_seconds_total", "mode": "user"}, Value: 5, Timestamp: 1000},
+	}, AggregateSamples(samples, aggregations, false))
+
+	for operator, value := range map[string]model.SampleValue{"avg": 15, "min": 5, "max": 30, "count": 3} {
+		aggregations, err := ParseAggregations([]string{operator + " by (instance) (node_cpu_seconds_total)"})
+		assert.NoError(t, err)
+
+		aggregated := AggregateSamples(samples, aggregations, false)
+		assert.Equal(t, model.Vector{
+			{Metric: model.Metric{model.MetricNameLabel: "node_cpu_seconds_total"}, Value: value, Timestamp: 2000},
+			load,
+		}, aggregated, operator)
+	}
+
+	// Range query samples are only aggregated with those of the same
+	// timestamp.
+	aggregations, err = ParseAggregations([]string{"max (node_cpu_seconds_total)"})
+	assert.NoError(t, err)
+	assert.Len(t, AggregateSamples(samples, aggregations, true), 3)
+
+	// The samples are not modified.
+	assert.Equal(t, model.SampleValue(10), samples[0].Value)
+	assert.Len(t, samples[0].Metric, 3)
+}
@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAMQPRoutingKey(t *testing.T) {
+	metric := model.Metric{model.MetricNameLabel: "node_load1", "instance": "10.0.0.1:9100"}
+
+	assert.Equal(t, "metrics.server1.node_node_load1.10_0_0_1:9100", AMQPRoutingKey("metrics.{host}.{name}.{instance}", metric, "node.", "server1"))
+}
+
+func TestSendToAMQPReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	// The broker drops every connection during the handshake.
+	var connections int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&connections, 1)
+			conn.Close()
+		}
+	}()
+
+	samples := model.Vector{{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1, Timestamp: model.Time(1506991233000)}}
+
+	config := OutputConfig{
+		TimestampPrecision: "s",
+		AMQP: AMQPConfig{
+			URL:                "amqp://guest:guest@" + listener.Addr().String() + "/",
+			RoutingKeyTemplate: "metrics",
+			Format:             "graphite",
+			Timeout:            time.Second,
+			ReconnectAttempts:  2,
+			ReconnectDelay:     time.Millisecond,
+		},
+	}
+
+	assert.Error(t, SendToAMQP(samples, config))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&connections))
+
+	config.AMQP.Format = "sendtoamqp"
+	assert.EqualError(t, SendToAMQP(samples, config), `unknown AMQP message format "sendtoamqp"`)
+}
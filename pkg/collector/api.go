@@ -0,0 +1,260 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// Scraper collects the samples of a run, e.g. from exporters or a
+// Prometheus API.
+type Scraper interface {
+	// Scrape returns the samples, canceling the requests in flight when
+	// ctx is done.
+	Scrape(ctx context.Context) (model.Vector, error)
+}
+
+// Filter selects and transforms the samples of a run.
+type Filter interface {
+	// Filter returns the samples to keep of samples.
+	Filter(samples model.Vector) (model.Vector, error)
+}
+
+// Encoder encodes samples in an output format.
+type Encoder interface {
+	// Encode returns the samples in the output format.
+	Encode(samples model.Vector) (string, error)
+}
+
+// ExporterScraper scrapes exporter targets as QueryTargets, labeling the
+// samples with the labels of their target.
+type ExporterScraper struct {
+	Targets        []Target
+	Auth           ExporterAuth
+	TLSConfig      *tls.Config
+	ParseOptions   ParseOptions
+	RequestOptions RequestOptions
+}
+
+// Scrape implements Scraper.
+func (s *ExporterScraper) Scrape(ctx context.Context) (model.Vector, error) {
+	requestOptions := s.RequestOptions
+	requestOptions.Context = ctx
+
+	return QueryTargets(s.Targets, s.Auth, s.TLSConfig, s.ParseOptions, requestOptions)
+}
+
+// PrometheusScraper runs Prometheus API queries as QueryPrometheusQueries.
+// The status of the query thresholds is not returned, QueryPrometheusQueries
+// returns it.
+type PrometheusScraper struct {
+	URL string
+	// Queries are run concurrently, their samples labeled with the query
+	// name as NameLabel, if set.
+	Queries        []PromQuery
+	NameLabel      string
+	Auth           PrometheusAuth
+	TLSConfig      *tls.Config
+	RequestOptions RequestOptions
+}
+
+// Scrape implements Scraper.
+func (s *PrometheusScraper) Scrape(ctx context.Context) (model.Vector, error) {
+	results, err := s.ScrapeResults(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results.Samples, nil
+}
+
+// ScrapeResults returns the samples of the queries with the status of their
+// thresholds.
+func (s *PrometheusScraper) ScrapeResults(ctx context.Context) (*QueryResults, error) {
+	requestOptions := s.RequestOptions
+	requestOptions.Context = ctx
+
+	return QueryPrometheusQueries(s.URL, s.Queries, s.NameLabel, s.Auth, s.TLSConfig, requestOptions)
+}
+
+// PrometheusRangeScraper runs a Prometheus API range query as
+// QueryPrometheusRange.
+type PrometheusRangeScraper struct {
+	URL            string
+	Query          string
+	Range          v1.Range
+	Auth           PrometheusAuth
+	TLSConfig      *tls.Config
+	RequestOptions RequestOptions
+}
+
+// Scrape implements Scraper.
+func (s *PrometheusRangeScraper) Scrape(ctx context.Context) (model.Vector, error) {
+	results, err := s.ScrapeResults(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results.Samples, nil
+}
+
+// ScrapeResults returns the samples of every point of the range query.
+func (s *PrometheusRangeScraper) ScrapeResults(ctx context.Context) (*QueryResults, error) {
+	requestOptions := s.RequestOptions
+	requestOptions.Context = ctx
+
+	samples, err := QueryPrometheusRange(s.URL, s.Query, s.Range, s.Auth, s.TLSConfig, requestOptions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueryResults{Samples: samples, Matrix: true, Status: CheckOK}, nil
+}
+
+// resultsScraper is a Scraper of Prometheus queries, whose samples may hold
+// every point of range query or subquery series and whose thresholds have a
+// status.
+type resultsScraper interface {
+	ScrapeResults(ctx context.Context) (*QueryResults, error)
+}
+
+// FederateScraper scrapes the /federate endpoint of a Prometheus API as
+// QueryFederate.
+type FederateScraper struct {
+	URL            string
+	Matches        []string
+	Auth           PrometheusAuth
+	TLSConfig      *tls.Config
+	ParseOptions   ParseOptions
+	RequestOptions RequestOptions
+}
+
+// Scrape implements Scraper.
+func (s *FederateScraper) Scrape(ctx context.Context) (model.Vector, error) {
+	requestOptions := s.RequestOptions
+	requestOptions.Context = ctx
+
+	return QueryFederate(s.URL, s.Matches, s.Auth, s.TLSConfig, s.ParseOptions, requestOptions)
+}
+
+// InputScraper reads exposition files, and the .prom files of Dir if set,
+// as ReadInputFiles.
+type InputScraper struct {
+	Paths        []string
+	Dir          string
+	ParseOptions ParseOptions
+}
+
+// Scrape implements Scraper.
+func (s *InputScraper) Scrape(ctx context.Context) (model.Vector, error) {
+	paths := append([]string{}, s.Paths...)
+
+	if s.Dir != "" {
+		dirPaths, err := InputDirFiles(s.Dir)
+
+		if err != nil {
+			return nil, Classify(err, FailureUnreachable)
+		}
+
+		paths = append(paths, dirPaths...)
+	}
+
+	samples, err := ReadInputFiles(paths, s.ParseOptions)
+
+	return samples, Classify(err, FailureParse)
+}
+
+// ReplayScraper parses a response saved by a Recorder as ReplayRecording.
+type ReplayScraper struct {
+	Path         string
+	ParseOptions ParseOptions
+}
+
+// Scrape implements Scraper.
+func (s *ReplayScraper) Scrape(ctx context.Context) (model.Vector, error) {
+	samples, err := ReplayRecording(s.Path, s.ParseOptions)
+
+	return samples, Classify(err, FailureParse)
+}
+
+// VectorScraper returns its samples, e.g. the metric points of a Sensu
+// event.
+type VectorScraper model.Vector
+
+// Scrape implements Scraper.
+func (s VectorScraper) Scrape(ctx context.Context) (model.Vector, error) {
+	return model.Vector(s), nil
+}
+
+// Filter implements Filter.
+func (f SampleFilter) Filter(samples model.Vector) (model.Vector, error) {
+	return f(samples)
+}
+
+// Filters applies filters in order.
+type Filters []Filter
+
+// Filter implements Filter.
+func (f Filters) Filter(samples model.Vector) (model.Vector, error) {
+	for _, filter := range f {
+		var err error
+
+		if samples, err = filter.Filter(samples); err != nil {
+			return nil, err
+		}
+	}
+
+	return samples, nil
+}
+
+// FormatEncoder encodes samples in a format printed to stdout, e.g. influx,
+// graphite or json, as FormatMetrics.
+type FormatEncoder struct {
+	Config OutputConfig
+}
+
+// Encode implements Encoder.
+func (e FormatEncoder) Encode(samples model.Vector) (string, error) {
+	output, ok := FormatMetrics(samples, e.Config)
+
+	if !ok {
+		return "", unknownOutputFormat(e.Config.Format)
+	}
+
+	return output, nil
+}
+
+// Collect scrapes the samples with scraper, filters them with filter, if
+// not nil, sorts them and encodes them with encoder. When some targets fail
+// to be scraped, the samples of the others are encoded and returned with
+// the scrape error.
+func Collect(ctx context.Context, scraper Scraper, filter Filter, encoder Encoder) (string, error) {
+	samples, scrapeErr := scraper.Scrape(ctx)
+
+	if scrapeErr != nil && len(samples) == 0 {
+		return "", scrapeErr
+	}
+
+	var err error
+
+	if filter != nil {
+		if samples, err = filter.Filter(samples); err != nil {
+			return "", err
+		}
+	}
+
+	SortSamples(samples)
+
+	output, err := encoder.Encode(samples)
+
+	if err != nil {
+		return "", err
+	}
+
+	return output, scrapeErr
+}
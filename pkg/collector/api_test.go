@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("node_load5 0.25 1506991200000\nnode_load1 0.5 1506991200000\nup 1 1506991200000\n"))
+	}))
+	defer server.Close()
+
+	scraper := &ExporterScraper{
+		Targets:      []Target{{URL: server.URL, Labels: model.LabelSet{"job": "node"}}},
+		ParseOptions: ParseOptions{HonorTimestamps: true},
+	}
+	filter := Filters{
+		SampleFilter(func(samples model.Vector) (model.Vector, error) {
+			return FilterSampleNames(samples, "node_load1|node_load5", "")
+		}),
+		SampleFilter(func(samples model.Vector) (model.Vector, error) {
+			return FilterValues(samples, false, 0.3, 1), nil
+		}),
+	}
+	encoder := FormatEncoder{Config: OutputConfig{Format: "graphite", TimestampPrecision: "s"}}
+
+	output, err := Collect(context.Background(), scraper, filter, encoder)
+	assert.NoError(t, err)
+	assert.Equal(t, "node_load1 0.5 1506991200\n", output)
+
+	_, err = Collect(context.Background(), scraper, nil, FormatEncoder{Config: OutputConfig{Format: "sendtostatsd"}})
+	assert.EqualError(t, err, `unknown output format "sendtostatsd", expected one of `+strings.Join(OutputFormats, ", "))
+
+	failing := SampleFilter(func(samples model.Vector) (model.Vector, error) {
+		return nil, errors.New("invalid filter")
+	})
+	_, err = Collect(context.Background(), scraper, failing, encoder)
+	assert.EqualError(t, err, "invalid filter")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Collect(ctx, scraper, nil, encoder)
+	assert.Error(t, err)
+
+	partial := &ExporterScraper{
+		Targets:      []Target{{URL: server.URL}, {URL: "http://127.0.0.1:1"}},
+		ParseOptions: ParseOptions{HonorTimestamps: true},
+	}
+	output, err = Collect(context.Background(), partial, filter, encoder)
+	assert.Error(t, err)
+	assert.Equal(t, "node_load1 0.5 1506991200\n", output)
+
+	var failure *FailureError
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureUnreachable, failure.Class)
+}
+
+func TestPrometheusScraper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"up","job":"node"},"value":[1506991200,"1"]}]}}`))
+	}))
+	defer server.Close()
+
+	scraper := &PrometheusScraper{URL: server.URL, Queries: []PromQuery{{Name: "up", Query: "up"}}, NameLabel: "query"}
+
+	samples, err := scraper.Scrape(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, `up{job="node", query="up"} => 1 @[1506991200]`, samples[0].String())
+}
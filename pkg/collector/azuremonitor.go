@@ -0,0 +1,284 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// azureMonitorResource is the resource of the Azure Monitor access
+	// tokens.
+	azureMonitorResource = "https://monitoring.azure.com/"
+	// azureMonitorMaxDimensions is the maximum number of dimensions of an
+	// Azure Monitor custom metric.
+	azureMonitorMaxDimensions = 10
+	// AzureIdentityURL is the Azure Instance Metadata Service endpoint
+	// issuing managed identity access tokens.
+	AzureIdentityURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+// AzureMonitorConfig configures the sendtoazuremonitor output.
+type AzureMonitorConfig struct {
+	// URL is the regional ingestion endpoint, e.g.
+	// https://westeurope.monitoring.azure.com, metrics are posted to
+	// <URL><ResourceID>/metrics.
+	URL        string
+	ResourceID string
+	// Namespace is the custom metrics namespace.
+	Namespace string
+	// TenantID, ClientID and ClientSecret authenticate as a service
+	// principal with the AuthorityURL, e.g. https://login.microsoftonline.com.
+	// Without a ClientSecret the managed identity of IdentityURL is used,
+	// the user-assigned identity ClientID if set.
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	AuthorityURL string
+	IdentityURL  string
+	TLSConfig    *tls.Config
+	Timeout      time.Duration
+}
+
+// AzureMonitorSeries is a series of an Azure Monitor custom metric.
+type AzureMonitorSeries struct {
+	DimValues []string `json:"dimValues,omitempty"`
+	Min       float64  `json:"min"`
+	Max       float64  `json:"max"`
+	Sum       float64  `json:"sum"`
+	Count     int      `json:"count"`
+}
+
+// AzureMonitorBaseData is the metric of an Azure Monitor custom metric
+// submission.
+type AzureMonitorBaseData struct {
+	Metric    string               `json:"metric"`
+	Namespace string               `json:"namespace"`
+	DimNames  []string             `json:"dimNames,omitempty"`
+	Series    []AzureMonitorSeries `json:"series"`
+}
+
+// AzureMonitorMetric is an Azure Monitor custom metric submission.
+type AzureMonitorMetric struct {
+	Time string `json:"time"`
+	Data struct {
+		BaseData AzureMonitorBaseData `json:"baseData"`
+	} `json:"data"`
+}
+
+// CreateAzureMonitorMetrics converts samples to Azure Monitor custom
+// metrics, one per metric name and timestamp, with the labels as
+// dimensions and a series, of a single value, per sample. Azure Monitor
+// cannot store NaN or infinite values, so those samples are skipped.
+func CreateAzureMonitorMetrics(samples model.Vector, metricPrefix string, namespace string) ([]AzureMonitorMetric, error) {
+	type metricKey struct {
+		name      model.LabelValue
+		timestamp model.Time
+	}
+
+	var keys []metricKey
+	groups := map[metricKey]model.Vector{}
+
+	for _, sample := range samples {
+		value := float64(sample.Value)
+
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		key := metricKey{sample.Metric["__name__"], sample.Timestamp}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], sample)
+	}
+
+	metrics := []AzureMonitorMetric{}
+
+	for _, key := range keys {
+		dimensions := map[string]bool{}
+		for _, sample := range groups[key] {
+			for name, labelValue := range sample.Metric {
+				if name != "__name__" && labelValue != "" {
+					dimensions[string(name)] = true
+				}
+			}
+		}
+
+		if len(dimensions) > azureMonitorMaxDimensions {
+			return nil, fmt.Errorf("azure monitor metric %s has %d dimensions, at most %d are supported", key.name, len(dimensions), azureMonitorMaxDimensions)
+		}
+
+		dimNames := make([]string, 0, len(dimensions))
+		for name := range dimensions {
+			dimNames = append(dimNames, name)
+		}
+		sort.Strings(dimNames)
+
+		var metric AzureMonitorMetric
+		metric.Time = key.timestamp.Time().UTC().Format(time.RFC3339)
+		metric.Data.BaseData = AzureMonitorBaseData{
+			Metric:    fmt.Sprintf("%s%s", metricPrefix, key.name),
+			Namespace: namespace,
+			DimNames:  dimNames,
+		}
+
+		for _, sample := range groups[key] {
+			series := AzureMonitorSeries{Count: 1}
+			series.Min = float64(sample.Value)
+			series.Max = series.Min
+			series.Sum = series.Min
+
+			for _, name := range dimNames {
+				series.DimValues = append(series.DimValues, string(sample.Metric[model.LabelName(name)]))
+			}
+
+			metric.Data.BaseData.Series = append(metric.Data.BaseData.Series, series)
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, nil
+}
+
+// SendToAzureMonitor posts samples to the Azure Monitor custom metrics
+// ingestion endpoint of the resource.
+func SendToAzureMonitor(samples model.Vector, metricPrefix string, config AzureMonitorConfig) error {
+	if config.ResourceID == "" {
+		return errors.New("an Azure resource ID is required")
+	}
+
+	metrics, err := CreateAzureMonitorMetrics(samples, metricPrefix, config.Namespace)
+
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config.TLSConfig,
+		},
+		Timeout: config.Timeout,
+	}
+	defer client.CloseIdleConnections()
+
+	token, err := azureAccessToken(client, config)
+
+	if err != nil {
+		return err
+	}
+
+	metricsURL := strings.TrimSuffix(config.URL, "/") + "/" + strings.TrimPrefix(config.ResourceID, "/") + "/metrics"
+
+	for _, metric := range metrics {
+		body, err := json.Marshal(metric)
+
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest("POST", metricsURL, bytes.NewReader(body))
+
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := client.Do(req)
+
+		if err != nil {
+			return err
+		}
+
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		if resp.StatusCode/100 != 2 {
+			return errors.New("azure monitor returned non 2xx HTTP response status: " + resp.Status + ": " + strings.TrimSpace(string(respBody)))
+		}
+	}
+
+	return nil
+}
+
+// azureAccessToken gets an Azure Monitor access token, as a service
+// principal when config has a client secret and from the managed identity
+// otherwise.
+func azureAccessToken(client *http.Client, config AzureMonitorConfig) (string, error) {
+	var req *http.Request
+	var err error
+
+	if config.ClientSecret != "" {
+		if config.TenantID == "" || config.ClientID == "" {
+			return "", errors.New("an Azure tenant ID and client ID are required with a client secret")
+		}
+
+		form := url.Values{}
+		form.Set("grant_type", "client_credentials")
+		form.Set("client_id", config.ClientID)
+		form.Set("client_secret", config.ClientSecret)
+		form.Set("resource", azureMonitorResource)
+
+		tokenURL := strings.TrimSuffix(config.AuthorityURL, "/") + "/" + url.PathEscape(config.TenantID) + "/oauth2/token"
+		req, err = http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+
+		if err != nil {
+			return "", err
+		}
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		query := url.Values{}
+		query.Set("api-version", "2018-02-01")
+		query.Set("resource", azureMonitorResource)
+		if config.ClientID != "" {
+			query.Set("client_id", config.ClientID)
+		}
+
+		req, err = http.NewRequest("GET", config.IdentityURL+"?"+query.Encode(), nil)
+
+		if err != nil {
+			return "", err
+		}
+
+		req.Header.Set("Metadata", "true")
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", errors.New("azure token endpoint returned non 2xx HTTP response status: " + resp.Status + ": " + strings.TrimSpace(string(respBody)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode Azure access token: %v", err)
+	}
+
+	return token.AccessToken, nil
+}
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAzureMonitorMetrics(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "node_cpu_seconds_total", "cpu": "0", "mode": "idle"}, Value: 10, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "node_cpu_seconds_total", "cpu": "1"}, Value: 20, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "node_load1"}, Value: 0.5, Timestamp: model.Time(1506991233000)},
+	}
+
+	metrics, err := CreateAzureMonitorMetrics(samples, "node.", "Prometheus")
+	assert.NoError(t, err)
+
+	body, err := json.Marshal(metrics)
+	assert.NoError(t, err)
+
+	assert.JSONEq(t, `[
+  {"time": "2017-10-03T00:40:33Z", "data": {"baseData": {"metric": "node.node_cpu_seconds_total", "namespace": "Prometheus", "dimNames": ["cpu", "mode"], "series": [
+    {"dimValues": ["0", "idle"], "min": 10, "max": 10, "sum": 10, "count": 1},
+    {"dimValues": ["1", ""], "min": 20, "max": 20, "sum": 20, "count": 1}
+  ]}}},
+  {"time": "2017-10-03T00:40:33Z", "data": {"baseData": {"metric": "node.node_load1", "namespace": "Prometheus", "series": [
+    {"min": 0.5, "max": 0.5, "sum": 0.5, "count": 1}
+  ]}}}
+]`, string(body))
+
+	metric := model.Metric{model.MetricNameLabel: "foo"}
+	for _, name := range []model.LabelName{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"} {
+		metric[name] = "x"
+	}
+
+	_, err = CreateAzureMonitorMetrics(model.Vector{{Metric: metric, Value: 1}}, "", "Prometheus")
+	assert.EqualError(t, err, "azure monitor metric foo has 11 dimensions, at most 10 are supported")
+}
+
+func TestSendToAzureMonitor(t *testing.T) {
+	var metricNames []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tenant/oauth2/token":
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+			assert.Equal(t, "client", r.PostForm.Get("client_id"))
+			assert.Equal(t, "secret", r.PostForm.Get("client_secret"))
+			assert.Equal(t, "https://monitoring.azure.com/", r.PostForm.Get("resource"))
+			w.Write([]byte(`{"access_token":"sp-token"}`))
+		case "/identity":
+			assert.Equal(t, "true", r.Header.Get("Metadata"))
+			assert.Equal(t, "https://monitoring.azure.com/", r.URL.Query().Get("resource"))
+			w.Write([]byte(`{"access_token":"mi-token"}`))
+		case "/subscriptions/s/resourceGroups/g/providers/Microsoft.Compute/virtualMachines/vm/metrics":
+			var metric AzureMonitorMetric
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&metric))
+			metricNames = append(metricNames, r.Header.Get("Authorization")+" "+metric.Data.BaseData.Metric)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	samples := model.Vector{{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1, Timestamp: model.Time(1506991233000)}}
+
+	config := AzureMonitorConfig{
+		URL:          ts.URL,
+		ResourceID:   "/subscriptions/s/resourceGroups/g/providers/Microsoft.Compute/virtualMachines/vm",
+		Namespace:    "Prometheus",
+		TenantID:     "tenant",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		AuthorityURL: ts.URL,
+		IdentityURL:  ts.URL + "/identity",
+	}
+
+	assert.NoError(t, SendToAzureMonitor(samples, "", config))
+
+	config.ClientSecret = ""
+	assert.NoError(t, SendToAzureMonitor(samples, "", config))
+
+	assert.Equal(t, []string{"Bearer sp-token foo", "Bearer mi-token foo"}, metricNames)
+
+	config.ResourceID = "/subscriptions/s/unknown"
+	assert.EqualError(t, SendToAzureMonitor(samples, "", config), "azure monitor returned non 2xx HTTP response status: 404 Not Found: 404 page not found")
+}
@@ -0,0 +1,240 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// carbonMaxBatchSize is the maximum size of a single write, a failed
+	// write is resent in full after reconnecting.
+	carbonMaxBatchSize = 64 * 1024
+	// carbonPickleBatchSize is the number of metrics per pickle message,
+	// keeping messages well below the 1 MiB carbon accepts.
+	carbonPickleBatchSize = 500
+)
+
+// CarbonConfig configures the sendtocarbon output.
+type CarbonConfig struct {
+	// Protocol is plaintext or pickle.
+	Protocol string
+	// Address is the host:port of the carbon-cache or carbon-relay.
+	Address string
+	// TLSConfig connects over TLS when set.
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+	// ReconnectAttempts is the number of times a failed connection or
+	// write is retried, waiting ReconnectDelay, doubled after every
+	// attempt, in between.
+	ReconnectAttempts int
+	ReconnectDelay    time.Duration
+}
+
+// CarbonClient writes to a carbon TCP listener, reconnecting when the
+// connection fails.
+type CarbonClient struct {
+	config CarbonConfig
+	conn   net.Conn
+}
+
+// NewCarbonClient returns a client for the carbon listener in config, the
+// connection is made on the first write.
+func NewCarbonClient(config CarbonConfig) *CarbonClient {
+	return &CarbonClient{config: config}
+}
+
+// Write sends data, a sequence of newline terminated lines, in batches of
+// whole lines. Batches failing to send are retried on a new connection, so
+// lines may be delivered more than once but are not lost while the
+// reconnect attempts last.
+func (c *CarbonClient) Write(data []byte) error {
+	for len(data) > 0 {
+		batch := data
+
+		if len(batch) > carbonMaxBatchSize {
+			if i := bytes.LastIndexByte(batch[:carbonMaxBatchSize], '\n'); i >= 0 {
+				batch = batch[:i+1]
+			}
+		}
+
+		if err := c.Send(batch); err != nil {
+			return err
+		}
+
+		data = data[len(batch):]
+	}
+
+	return nil
+}
+
+// Send writes batch in a single write, retrying on a new connection when
+// it fails.
+func (c *CarbonClient) Send(batch []byte) error {
+	delay := c.config.ReconnectDelay
+	var err error
+
+	for attempt := 0; attempt <= c.config.ReconnectAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		if c.conn == nil {
+			c.conn, err = c.dial()
+
+			if err != nil {
+				continue
+			}
+		}
+
+		if c.config.Timeout > 0 {
+			c.conn.SetWriteDeadline(time.Now().Add(c.config.Timeout))
+		}
+
+		_, err = c.conn.Write(batch)
+
+		if err == nil {
+			return nil
+		}
+
+		c.conn.Close()
+		c.conn = nil
+	}
+
+	return fmt.Errorf("carbon %s: %v", c.config.Address, err)
+}
+
+func (c *CarbonClient) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.config.Timeout}
+
+	if c.config.TLSConfig != nil {
+		return tls.DialWithDialer(dialer, "tcp", c.config.Address, c.config.TLSConfig)
+	}
+
+	return dialer.Dial("tcp", c.config.Address)
+}
+
+// Close closes the connection.
+func (c *CarbonClient) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+
+	return err
+}
+
+// SendToCarbon sends samples to a carbon listener in the graphite plaintext
+// format, or batched in the pickle format.
+func SendToCarbon(samples model.Vector, config OutputConfig) error {
+	client := NewCarbonClient(config.Carbon)
+
+	var err error
+
+	switch config.Carbon.Protocol {
+	case "", "plaintext":
+		metrics := CreateGraphiteMetrics(samples, config.MetricPrefix, config.GraphiteTemplate, config.TimestampPrecision)
+		err = client.Write([]byte(metrics))
+	case "pickle":
+		for _, message := range CreateCarbonPickleMessages(samples, config.MetricPrefix, config.GraphiteTemplate, config.TimestampPrecision) {
+			if err = client.Send(message); err != nil {
+				break
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown carbon protocol %q", config.Carbon.Protocol)
+	}
+
+	if err != nil {
+		client.Close()
+		return err
+	}
+
+	return client.Close()
+}
+
+// CreateCarbonPickleMessages encodes samples as carbon pickle protocol
+// messages of up to carbonPickleBatchSize metrics. Each message is a
+// 4 byte big endian length followed by a pickled list of
+// (path, (timestamp, value)) tuples.
+func CreateCarbonPickleMessages(samples model.Vector, metricPrefix string, graphiteTemplate string, timestampPrecision string) [][]byte {
+	var messages [][]byte
+
+	for start := 0; start < len(samples); start += carbonPickleBatchSize {
+		end := start + carbonPickleBatchSize
+		if end > len(samples) {
+			end = len(samples)
+		}
+
+		var payload bytes.Buffer
+
+		// Protocol 2, an empty list and a mark for the appended tuples.
+		payload.WriteString("\x80\x02](")
+
+		for _, sample := range samples[start:end] {
+			path := graphiteMetricPath(sample.Metric, metricPrefix, graphiteTemplate)
+
+			picklePutString(&payload, path)
+			picklePutInt(&payload, FormatTimestamp(sample.Timestamp, timestampPrecision))
+			picklePutFloat(&payload, float64(sample.Value))
+
+			// TUPLE2 twice, (timestamp, value) then (path, (...)).
+			payload.WriteString("\x86\x86")
+		}
+
+		// APPENDS and STOP.
+		payload.WriteString("e.")
+
+		message := make([]byte, 4, 4+payload.Len())
+		binary.BigEndian.PutUint32(message, uint32(payload.Len()))
+		messages = append(messages, append(message, payload.Bytes()...))
+	}
+
+	return messages
+}
+
+// picklePutString writes a BINUNICODE string.
+func picklePutString(w *bytes.Buffer, s string) {
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(s)))
+
+	w.WriteByte('X')
+	w.Write(size[:])
+	w.WriteString(s)
+}
+
+// picklePutInt writes a BININT, or a LONG1 when i does not fit 32 bits.
+func picklePutInt(w *bytes.Buffer, i int64) {
+	if i >= math.MinInt32 && i <= math.MaxInt32 {
+		var value [4]byte
+		binary.LittleEndian.PutUint32(value[:], uint32(int32(i)))
+
+		w.WriteByte('J')
+		w.Write(value[:])
+		return
+	}
+
+	var value [8]byte
+	binary.LittleEndian.PutUint64(value[:], uint64(i))
+
+	w.WriteString("\x8a\x08")
+	w.Write(value[:])
+}
+
+// picklePutFloat writes a BINFLOAT.
+func picklePutFloat(w *bytes.Buffer, f float64) {
+	var value [8]byte
+	binary.BigEndian.PutUint64(value[:], math.Float64bits(f))
+
+	w.WriteByte('G')
+	w.Write(value[:])
+}
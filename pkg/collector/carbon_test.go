@@ -0,0 +1,125 @@
+package collector
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func acceptCarbonLines(listener net.Listener) chan string {
+	received := make(chan string)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	return received
+}
+
+func TestSendToCarbon(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	samples := model.Vector{{
+		Metric:    model.Metric{model.MetricNameLabel: "foo"},
+		Value:     1.5,
+		Timestamp: model.Time(1506991233000),
+	}}
+
+	received := acceptCarbonLines(listener)
+
+	err = SendToCarbon(samples, OutputConfig{MetricPrefix: "prefix.", TimestampPrecision: "s", Carbon: CarbonConfig{Address: listener.Addr().String()}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "prefix.foo 1.5 1506991233\n", <-received)
+}
+
+func TestSendToCarbonTLS(t *testing.T) {
+	cert, certFile, keyFile := writeTestCertificate(t)
+	defer os.Remove(certFile)
+	defer os.Remove(keyFile)
+
+	keyPair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.NoError(t, err)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{keyPair}})
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(cert)
+
+	samples := model.Vector{{
+		Metric:    model.Metric{model.MetricNameLabel: "foo"},
+		Value:     1,
+		Timestamp: model.Time(1506991233000),
+	}}
+
+	received := acceptCarbonLines(listener)
+
+	err = SendToCarbon(samples, OutputConfig{TimestampPrecision: "s", Carbon: CarbonConfig{Address: listener.Addr().String(), TLSConfig: &tls.Config{RootCAs: rootCAs}}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "foo 1 1506991233\n", <-received)
+}
+
+func TestCarbonClientReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	client := NewCarbonClient(CarbonConfig{Address: listener.Addr().String(), ReconnectAttempts: 1, ReconnectDelay: time.Millisecond})
+
+	// A broken connection is replaced and the batch is resent.
+	broken, other := net.Pipe()
+	other.Close()
+	broken.Close()
+	client.conn = broken
+
+	received := acceptCarbonLines(listener)
+
+	assert.NoError(t, client.Write([]byte("foo 1 1506991233\n")))
+	assert.NoError(t, client.Close())
+	assert.Equal(t, "foo 1 1506991233\n", <-received)
+
+	listener.Close()
+
+	client = NewCarbonClient(CarbonConfig{Address: listener.Addr().String(), ReconnectAttempts: 1, ReconnectDelay: time.Millisecond})
+	assert.Error(t, client.Write([]byte("foo 1 1506991233\n")))
+}
+
+func TestCreateCarbonPickleMessages(t *testing.T) {
+	samples := model.Vector{{
+		Metric:    model.Metric{model.MetricNameLabel: "foo"},
+		Value:     1.5,
+		Timestamp: model.Time(1506991233000),
+	}}
+
+	messages := CreateCarbonPickleMessages(samples, "a.", "", "s")
+
+	// pickle.dumps([("a.foo", (1506991233, 1.5))], protocol=2)
+	expected := "\x00\x00\x00\x20\x80\x02](X\x05\x00\x00\x00a.fooJ\x81\xdc\xd2YG?\xf8\x00\x00\x00\x00\x00\x00\x86\x86e."
+
+	assert.Equal(t, [][]byte{[]byte(expected)}, messages)
+
+	for len(samples) <= carbonPickleBatchSize {
+		samples = append(samples, samples[0])
+	}
+
+	assert.Len(t, CreateCarbonPickleMessages(samples, "", "", "s"), 2)
+}
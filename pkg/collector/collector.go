@@ -0,0 +1,1882 @@
+package collector
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	exporterAuthID   = "exporter"
+	promAuthID       = "prom"
+	unixSocketScheme = "unix://"
+
+	// exporterAcceptHeader prefers the delimited protobuf exposition
+	// format, then OpenMetrics, falling back to text.
+	exporterAcceptHeader = `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,application/openmetrics-text;version=1.0.0;q=0.5,text/plain;version=0.0.4;q=0.3,*/*;q=0.1`
+)
+
+type ExporterAuth struct {
+	User     string `envconfig:"user" default:""`
+	Password string `envconfig:"password" default:""`
+	Header   string `envconfig:"header" default:""`
+	// OAuth2 authenticates scrapes with bearer tokens, unless there is a
+	// Header.
+	OAuth2 *OAuth2TokenSource `ignored:"true"`
+	// Headers are set on every scrape, before the credentials.
+	Headers http.Header `ignored:"true"`
+}
+
+// PrometheusAuth authenticates Prometheus API queries, with basic auth or
+// OAuth2 bearer tokens.
+type PrometheusAuth struct {
+	User     string             `envconfig:"user" default:""`
+	Password string             `envconfig:"password" default:""`
+	OAuth2   *OAuth2TokenSource `ignored:"true"`
+	// Headers are set on every query, before the credentials.
+	Headers http.Header `ignored:"true"`
+}
+
+// basicAuthTransport sets the basic auth credentials of the requests it
+// round trips, as the Prometheus API client has no option to.
+type basicAuthTransport struct {
+	http.RoundTripper
+	user     string
+	password string
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	authorized := req.WithContext(req.Context())
+	authorized.Header = make(http.Header, len(req.Header)+1)
+	for name, values := range req.Header {
+		authorized.Header[name] = values
+	}
+	authorized.SetBasicAuth(t.user, t.password)
+
+	return t.RoundTripper.RoundTrip(authorized)
+}
+
+// ParseOptions configures how exposition data is parsed into samples.
+type ParseOptions struct {
+	// Exemplars emits OpenMetrics exemplars as additional samples.
+	Exemplars bool
+	// HonorTimestamps keeps the sample timestamps given in the exposition,
+	// like the Prometheus honor_timestamps scrape option.
+	HonorTimestamps bool
+	// Types, when set, is filled with the type of every parsed metric
+	// family.
+	Types MetricTypes
+	// ScalarMetric names the sample of a replayed scalar or string query
+	// result, DefaultScalarMetric if empty.
+	ScalarMetric string
+}
+
+// RequestOptions configures the exporter scrapes and Prometheus API
+// queries.
+type RequestOptions struct {
+	// Timeout is the deadline of a scrape or query, including reading the
+	// response, 0 is none.
+	Timeout time.Duration
+	// Retries is the number of times a scrape or query failing with a
+	// connection error, timeout or 5xx response is retried, waiting
+	// RetryBackoff, doubled after every retry, in between.
+	Retries      int
+	RetryBackoff time.Duration
+	// Concurrency is the number of targets scraped at a time.
+	Concurrency int
+	// Recorder, if set, saves the raw responses.
+	Recorder *Recorder
+	// Context, if set, cancels the scrapes and queries when it is done,
+	// e.g. on SIGINT or SIGTERM.
+	Context context.Context
+}
+
+// context returns the options context, or the background context.
+func (o RequestOptions) context() context.Context {
+	if o.Context != nil {
+		return o.Context
+	}
+
+	return context.Background()
+}
+
+// withTimeout returns a context with the options timeout, if any.
+func (o RequestOptions) withTimeout() (context.Context, context.CancelFunc) {
+	if o.Timeout > 0 {
+		return context.WithTimeout(o.context(), o.Timeout)
+	}
+
+	return context.WithCancel(o.context())
+}
+
+// interrupted returns ErrInterrupted once the options context is canceled.
+func (o RequestOptions) interrupted() error {
+	if o.context().Err() != nil {
+		return ErrInterrupted
+	}
+
+	return nil
+}
+
+// MetricTypes maps metric family names to their type, e.g. counter, gauge,
+// histogram or summary.
+type MetricTypes map[string]string
+
+// metricTypeSuffixes are the suffixes of the samples of a metric family.
+var metricTypeSuffixes = []string{"_bucket", "_sum", "_count", "_total", "_created", "_gcount", "_gsum", "_info"}
+
+// Type returns the type of the metric family of a sample name, or untyped
+// when it is not known.
+func (t MetricTypes) Type(name string) string {
+	_, metricType := t.Family(name)
+	return metricType
+}
+
+// Family returns the metric family of a sample name and its type. Samples
+// of unknown families are untyped families of their own.
+func (t MetricTypes) Family(name string) (string, string) {
+	if metricType, ok := t[name]; ok {
+		return name, metricType
+	}
+
+	for _, suffix := range metricTypeSuffixes {
+		family := strings.TrimSuffix(name, suffix)
+
+		if metricType, ok := t[family]; ok && family != name {
+			return family, metricType
+		}
+	}
+
+	return name, "untyped"
+}
+
+// StringList is a flag.Value collecting values from repeated and comma
+// separated flags.
+type StringList []string
+
+func (l *StringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Reset removes the collected values.
+func (l *StringList) Reset() {
+	*l = nil
+}
+
+func (l *StringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			*l = append(*l, v)
+		}
+	}
+
+	return nil
+}
+
+type Tag struct {
+	Name  model.LabelName
+	Value model.LabelValue
+}
+
+type Metric struct {
+	Tags      []Tag
+	Value     float64
+	Timestamp int64
+}
+
+// MetricV2 is a sample in the v2 json output schema.
+type MetricV2 struct {
+	Name      string            `json:"name"`
+	Value     float64           `json:"value"`
+	Timestamp int64             `json:"timestamp"`
+	Type      string            `json:"type"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// OutputConfig configures how samples are formatted and where they are
+// sent.
+type OutputConfig struct {
+	Format             string
+	MetricPrefix       string
+	GlobalTags         []GlobalTag
+	GraphiteTemplate   string
+	InfluxMeasurement  string
+	JSONSchema         string
+	MetricTypes        MetricTypes
+	TimestampPrecision string
+	// Status is the check status of the samples, e.g. CheckWarning when a
+	// sample breached the warning threshold.
+	Status int
+	// Warning and Critical are the thresholds of the nagios performance
+	// data, either may be nil.
+	Warning         *Threshold
+	Critical        *Threshold
+	Statsd          StatsdConfig
+	Carbon          CarbonConfig
+	OpenTSDB        OpenTSDBConfig
+	InfluxDB        InfluxDBConfig
+	VictoriaMetrics VictoriaMetricsConfig
+	Sensu           SensuConfig
+	Datadog         DatadogConfig
+	NATS            NATSConfig
+	MQTT            MQTTConfig
+	AMQP            AMQPConfig
+	AzureMonitor    AzureMonitorConfig
+}
+
+// MultiFlag is a flag.Value collecting the values of a repeated flag.
+type MultiFlag []string
+
+func (f *MultiFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+// Reset removes the collected values.
+func (f *MultiFlag) Reset() {
+	*f = nil
+}
+
+func (f *MultiFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// FormatTimestamp converts a sample timestamp to a Unix timestamp in the
+// given precision, s (the default), ms or ns.
+func FormatTimestamp(timestamp model.Time, precision string) int64 {
+	switch precision {
+	case "ms":
+		return int64(timestamp)
+	case "ns":
+		return timestamp.UnixNano()
+	default:
+		return timestamp.Unix()
+	}
+}
+
+// DefaultTimestampPrecision is the timestamp precision of an output format,
+// nanoseconds for the influx line protocol, as its specification requires
+// unless the precision is given to InfluxDB, and seconds otherwise.
+func DefaultTimestampPrecision(outputFormat string) string {
+	switch outputFormat {
+	case "influx", "sendtoinfluxdb":
+		return "ns"
+	default:
+		return "s"
+	}
+}
+
+// MessageFormat returns the output format of the messages the sendtonats,
+// sendtomqtt and sendtoamqp outputs publish, and config.Format otherwise.
+func MessageFormat(config OutputConfig) string {
+	switch config.Format {
+	case "sendtonats":
+		return config.NATS.Format
+	case "sendtomqtt":
+		return config.MQTT.Format
+	case "sendtoamqp":
+		return config.AMQP.Format
+	default:
+		return config.Format
+	}
+}
+
+func CreateJSONMetrics(samples model.Vector, timestampPrecision string) string {
+	metrics := []Metric{}
+
+	for _, sample := range samples {
+		metrics = append(metrics, createJSONMetric(sample, timestampPrecision))
+	}
+
+	jsonMetrics, _ := json.Marshal(metrics)
+
+	return string(jsonMetrics)
+}
+
+// CreateJSONV2Metrics formats samples as a JSON array in the v2 schema,
+// with the metric name, type and timestamp as fields and the labels as a
+// tags object.
+func CreateJSONV2Metrics(samples model.Vector, metricTypes MetricTypes, timestampPrecision string) string {
+	metrics := []MetricV2{}
+
+	for _, sample := range samples {
+		metrics = append(metrics, createJSONV2Metric(sample, metricTypes, timestampPrecision))
+	}
+
+	jsonMetrics, _ := json.Marshal(metrics)
+
+	return string(jsonMetrics)
+}
+
+// CreateJSONLinesMetrics formats samples as JSON Lines, a JSON object per
+// sample per line, in the v1 or v2 json output schema.
+func CreateJSONLinesMetrics(samples model.Vector, jsonSchema string, metricTypes MetricTypes, timestampPrecision string) string {
+	metrics := ""
+
+	for _, sample := range samples {
+		var jsonMetric []byte
+
+		if jsonSchema == "v2" {
+			jsonMetric, _ = json.Marshal(createJSONV2Metric(sample, metricTypes, timestampPrecision))
+		} else {
+			jsonMetric, _ = json.Marshal(createJSONMetric(sample, timestampPrecision))
+		}
+
+		metrics += string(jsonMetric) + "\n"
+	}
+
+	return metrics
+}
+
+func createJSONV2Metric(sample *model.Sample, metricTypes MetricTypes, timestampPrecision string) MetricV2 {
+	name := string(sample.Metric[model.MetricNameLabel])
+
+	metric := MetricV2{
+		Name:      name,
+		Value:     float64(sample.Value),
+		Timestamp: FormatTimestamp(sample.Timestamp, timestampPrecision),
+		Type:      metricTypes.Type(name),
+		Tags:      map[string]string{},
+	}
+
+	for labelName, value := range sample.Metric {
+		if labelName != model.MetricNameLabel {
+			metric.Tags[string(labelName)] = string(value)
+		}
+	}
+
+	return metric
+}
+
+func createJSONMetric(sample *model.Sample, timestampPrecision string) Metric {
+	metric := Metric{}
+
+	names := sortedLabelNames(sample.Metric)
+	if _, ok := sample.Metric[model.MetricNameLabel]; ok {
+		names = append(model.LabelNames{model.MetricNameLabel}, names...)
+	}
+
+	for _, name := range names {
+		tag := Tag{
+			Name:  name,
+			Value: sample.Metric[name],
+		}
+
+		metric.Tags = append(metric.Tags, tag)
+	}
+
+	metric.Value = float64(sample.Value)
+	metric.Timestamp = FormatTimestamp(sample.Timestamp, timestampPrecision)
+
+	return metric
+}
+
+// CreateGraphiteMetrics formats samples in the Graphite plaintext format.
+// The metric path is the metric name, or the graphite template with the
+// labels of the sample filled in when one is given.
+func CreateGraphiteMetrics(samples model.Vector, metricPrefix string, graphiteTemplate string, timestampPrecision string) string {
+	metrics := ""
+
+	for _, sample := range samples {
+		name := graphiteMetricPath(sample.Metric, metricPrefix, graphiteTemplate)
+
+		value := strconv.FormatFloat(float64(sample.Value), 'f', -1, 64)
+
+		timestamp := FormatTimestamp(sample.Timestamp, timestampPrecision)
+
+		metric := fmt.Sprintf("%s %s %d\n", name, value, timestamp)
+
+		metrics += metric
+	}
+
+	return metrics
+}
+
+func graphiteMetricPath(metric model.Metric, metricPrefix string, graphiteTemplate string) string {
+	if graphiteTemplate != "" {
+		return metricPrefix + GraphitePath(graphiteTemplate, metric)
+	}
+
+	return fmt.Sprintf("%s%s", metricPrefix, metric["__name__"])
+}
+
+// graphiteTemplateLabel matches the {label} placeholders of a graphite
+// template.
+var graphiteTemplateLabel = regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// graphitePathReplacer replaces the characters that would split or break a
+// label value used as a graphite path node.
+var graphitePathReplacer = strings.NewReplacer(".", "_", " ", "_", "/", "_", "\n", "_")
+
+// GraphitePath fills in the {label} placeholders of a graphite template,
+// e.g. {instance}.{__name__}.{cpu}, with the label values of the metric.
+// Dots in label values are replaced so each value stays a single node, and
+// nodes left empty by missing labels are dropped.
+func GraphitePath(template string, metric model.Metric) string {
+	path := graphiteTemplateLabel.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := model.LabelName(placeholder[1 : len(placeholder)-1])
+		return graphitePathReplacer.Replace(string(metric[name]))
+	})
+
+	nodes := strings.Split(path, ".")
+	kept := nodes[:0]
+
+	for _, node := range nodes {
+		if node != "" {
+			kept = append(kept, node)
+		}
+	}
+
+	return strings.Join(kept, ".")
+}
+
+// fillTemplate fills in the {label} placeholders of a topic or routing key
+// template with the label values of the metric, escaped by replacer, with
+// the special {name}, the prefixed metric name, and {host} placeholders.
+func fillTemplate(template string, metric model.Metric, metricPrefix string, host string, replacer *strings.Replacer) string {
+	return graphiteTemplateLabel.ReplaceAllStringFunc(template, func(placeholder string) string {
+		var value string
+
+		switch name := placeholder[1 : len(placeholder)-1]; name {
+		case "name":
+			value = metricPrefix + string(metric["__name__"])
+		case "host":
+			value = host
+		default:
+			value = string(metric[model.LabelName(name)])
+		}
+
+		return replacer.Replace(value)
+	})
+}
+
+// ExpandMetricPrefix executes a metric prefix Go template, with the
+// .Hostname and .ShortHostname, the hostname up to the first dot, and the
+// env "NAME" and replace "old" "new" functions, e.g.
+// servers.{{.ShortHostname}}.{{env "DC"}}.
+func ExpandMetricPrefix(prefix string, hostname string) (string, error) {
+	expanded, err := expandHostTemplate("metric-prefix", prefix, hostname)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid metric prefix template: %v", err)
+	}
+
+	return expanded, nil
+}
+
+// ExpandQuery executes a Prometheus query Go template, as
+// ExpandMetricPrefix, e.g. up{instance="{{.ShortHostname}}:9100"}.
+func ExpandQuery(query string, hostname string) (string, error) {
+	expanded, err := expandHostTemplate("query", query, hostname)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid query template: %v", err)
+	}
+
+	return expanded, nil
+}
+
+func expandHostTemplate(name string, text string, hostname string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"env": os.Getenv,
+		"replace": func(old string, new string, s string) string {
+			return strings.Replace(s, old, new, -1)
+		},
+	}).Parse(text)
+
+	if err != nil {
+		return "", err
+	}
+
+	data := struct {
+		Hostname      string
+		ShortHostname string
+	}{
+		Hostname:      hostname,
+		ShortHostname: strings.SplitN(hostname, ".", 2)[0],
+	}
+
+	var expanded strings.Builder
+	if err := tmpl.Execute(&expanded, data); err != nil {
+		return "", err
+	}
+
+	return expanded.String(), nil
+}
+
+// CreateGraphiteTaggedMetrics formats samples in the Graphite 1.1 tagged
+// plaintext format, name;tag1=value1;tag2=value2 value timestamp. Labels are
+// sorted by name and those with an empty value are dropped, as Graphite
+// rejects empty tag values.
+func CreateGraphiteTaggedMetrics(samples model.Vector, metricPrefix string, timestampPrecision string) string {
+	metrics := ""
+
+	for _, sample := range samples {
+		metric := fmt.Sprintf("%s%s", metricPrefix, sample.Metric["__name__"])
+
+		names := make([]string, 0, len(sample.Metric))
+		for name := range sample.Metric {
+			if name != "__name__" && sample.Metric[name] != "" {
+				names = append(names, string(name))
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			value := graphiteTagReplacer.Replace(string(sample.Metric[model.LabelName(name)]))
+			metric += fmt.Sprintf(";%s=%s", name, value)
+		}
+
+		value := strconv.FormatFloat(float64(sample.Value), 'f', -1, 64)
+
+		timestamp := FormatTimestamp(sample.Timestamp, timestampPrecision)
+
+		metrics += fmt.Sprintf("%s %s %d\n", metric, value, timestamp)
+	}
+
+	return metrics
+}
+
+// graphiteTagReplacer replaces the characters Graphite does not allow in
+// tag values.
+var graphiteTagReplacer = strings.NewReplacer(";", "_", " ", "_", "\n", "_", "~", "_")
+
+// influxMeasurementEscaper and influxTagEscaper escape the characters with
+// a special meaning in line protocol measurements and tag keys and values.
+// Line protocol cannot escape newlines, they are replaced with spaces.
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `)
+)
+
+// CreateInfluxMetrics formats samples in the InfluxDB line protocol, with
+// the labels as tags, sorted by name, and the sample value as the value
+// field. Labels with an empty value are dropped, as line protocol does not
+// allow empty tag values.
+func CreateInfluxMetrics(samples model.Vector, metricPrefix string, timestampPrecision string) string {
+	metrics := ""
+
+	for _, sample := range samples {
+		metric := influxMeasurementEscaper.Replace(fmt.Sprintf("%s%s", metricPrefix, sample.Metric["__name__"]))
+
+		value := strconv.FormatFloat(float64(sample.Value), 'f', -1, 64)
+
+		timestamp := FormatTimestamp(sample.Timestamp, timestampPrecision)
+
+		metrics += fmt.Sprintf("%s%s value=%s %d\n", metric, influxTags(sample.Metric), value, timestamp)
+	}
+
+	return metrics
+}
+
+// CreateInfluxGroupedMetrics formats samples in the InfluxDB line protocol
+// like the Telegraf prometheus input with metric_version=2: samples with
+// the same labels and timestamp are written as a single line of the given
+// measurement, with a field named after each metric.
+func CreateInfluxGroupedMetrics(samples model.Vector, metricPrefix string, measurement string, timestampPrecision string) string {
+	type group struct {
+		tags      string
+		fields    []string
+		timestamp int64
+	}
+
+	type groupKey struct {
+		fingerprint model.Fingerprint
+		timestamp   model.Time
+	}
+
+	var groups []*group
+	groupIndex := map[groupKey]*group{}
+
+	for _, sample := range samples {
+		labels := sample.Metric.Clone()
+		delete(labels, model.MetricNameLabel)
+
+		key := groupKey{labels.Fingerprint(), sample.Timestamp}
+		g, ok := groupIndex[key]
+
+		if !ok {
+			g = &group{
+				tags:      influxTags(labels),
+				timestamp: FormatTimestamp(sample.Timestamp, timestampPrecision),
+			}
+			groups = append(groups, g)
+			groupIndex[key] = g
+		}
+
+		field := influxTagEscaper.Replace(fmt.Sprintf("%s%s", metricPrefix, sample.Metric["__name__"]))
+		value := strconv.FormatFloat(float64(sample.Value), 'f', -1, 64)
+		g.fields = append(g.fields, field+"="+value)
+	}
+
+	metrics := ""
+	measurement = influxMeasurementEscaper.Replace(measurement)
+
+	for _, g := range groups {
+		metrics += fmt.Sprintf("%s%s %s %d\n", measurement, g.tags, strings.Join(g.fields, ","), g.timestamp)
+	}
+
+	return metrics
+}
+
+// influxTags formats the labels of a metric as line protocol tags, sorted
+// by name.
+func influxTags(metric model.Metric) string {
+	names := make([]string, 0, len(metric))
+	for name, value := range metric {
+		if name != "__name__" && value != "" {
+			names = append(names, string(name))
+		}
+	}
+	sort.Strings(names)
+
+	tags := ""
+	for _, name := range names {
+		value := metric[model.LabelName(name)]
+		tags += fmt.Sprintf(",%s=%s", influxTagEscaper.Replace(name), influxTagEscaper.Replace(string(value)))
+	}
+
+	return tags
+}
+
+// carbon2Replacer replaces the characters carbon2 does not allow in tag
+// keys and values.
+var carbon2Replacer = strings.NewReplacer(" ", "_", "=", "_", "\n", "_")
+
+// CreateCarbon2Metrics formats samples in the carbon2 format used by Sumo
+// Logic, intrinsic_tags  meta_tags value timestamp. The metric name and
+// labels are the intrinsic tags, identifying the series, and the global
+// tags are the meta tags.
+func CreateCarbon2Metrics(samples model.Vector, metricPrefix string, globalTags []GlobalTag, timestampPrecision string) string {
+	var metaTags []string
+	for _, tag := range globalTags {
+		metaTags = append(metaTags, carbon2Replacer.Replace(tag.Name)+"="+carbon2Replacer.Replace(tag.Value))
+	}
+
+	metrics := ""
+
+	for _, sample := range samples {
+		intrinsicTags := []string{"metric=" + carbon2Replacer.Replace(fmt.Sprintf("%s%s", metricPrefix, sample.Metric["__name__"]))}
+
+		names := make([]string, 0, len(sample.Metric))
+		for name, value := range sample.Metric {
+			if name != "__name__" && value != "" {
+				names = append(names, string(name))
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			value := sample.Metric[model.LabelName(name)]
+			intrinsicTags = append(intrinsicTags, carbon2Replacer.Replace(name)+"="+carbon2Replacer.Replace(string(value)))
+		}
+
+		value := strconv.FormatFloat(float64(sample.Value), 'f', -1, 64)
+
+		timestamp := FormatTimestamp(sample.Timestamp, timestampPrecision)
+
+		metrics += fmt.Sprintf("%s  %s %s %d\n", strings.Join(intrinsicTags, " "), strings.Join(metaTags, " "), value, timestamp)
+	}
+
+	return metrics
+}
+
+// nagiosLabelReplacer replaces the characters not allowed in Nagios
+// performance data labels.
+var nagiosLabelReplacer = strings.NewReplacer("=", "_", "'", "_", "\n", "_")
+
+// CreateNagiosMetrics formats samples as the output of a Nagios plugin of
+// the check status, a status line followed by performance data,
+// label=value;warn;crit;min;max, with a label per series like
+// name{label:value,...} and the warning and critical thresholds, if any, as
+// Nagios ranges. Performance data values must be numbers, so NaN and
+// infinite values are skipped.
+func CreateNagiosMetrics(samples model.Vector, metricPrefix string, status int, warning *Threshold, critical *Threshold) string {
+	var perfdata []string
+
+	thresholds := warning.NagiosRange() + ";" + critical.NagiosRange()
+
+	for _, sample := range samples {
+		value := float64(sample.Value)
+
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		names := make([]string, 0, len(sample.Metric))
+		for name, labelValue := range sample.Metric {
+			if name != "__name__" && labelValue != "" {
+				names = append(names, string(name))
+			}
+		}
+		sort.Strings(names)
+
+		label := fmt.Sprintf("%s%s", metricPrefix, sample.Metric["__name__"])
+
+		if len(names) > 0 {
+			labels := make([]string, 0, len(names))
+			for _, name := range names {
+				labels = append(labels, name+":"+string(sample.Metric[model.LabelName(name)]))
+			}
+			label += "{" + strings.Join(labels, ",") + "}"
+		}
+
+		label = nagiosLabelReplacer.Replace(label)
+		if strings.Contains(label, " ") {
+			label = "'" + label + "'"
+		}
+
+		perfdata = append(perfdata, fmt.Sprintf("%s=%s;%s;;", label, strconv.FormatFloat(value, 'f', -1, 64), thresholds))
+	}
+
+	if len(perfdata) == 0 {
+		return checkStatusNames[status] + " - collected 0 metrics\n"
+	}
+
+	return fmt.Sprintf("%s - collected %d metrics | %s\n", checkStatusNames[status], len(perfdata), strings.Join(perfdata, " "))
+}
+
+// prometheusLabelEscaper escapes label values of the Prometheus text
+// exposition format.
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// CreatePrometheusMetrics formats samples in the Prometheus text exposition
+// format, with labels sorted by name and millisecond timestamps. Samples are
+// grouped by metric family, preceded by a TYPE line for the counter,
+// gauge, histogram and summary families in metricTypes, so that Prometheus
+// text parsers read back the original families.
+func CreatePrometheusMetrics(samples model.Vector, metricPrefix string, metricTypes MetricTypes) string {
+	type family struct {
+		name       string
+		metricType string
+		samples    []string
+	}
+
+	var families []*family
+	familyIndex := map[string]*family{}
+
+	for _, sample := range samples {
+		name := string(sample.Metric["__name__"])
+		familyName, metricType := metricTypes.Family(name)
+
+		switch metricType {
+		case "histogram", "summary":
+		case "counter", "gauge":
+			// Counter and gauge samples must be named after their family,
+			// unlike OpenMetrics counters with a _total suffix.
+			if familyName != name {
+				familyName, metricType = name, "untyped"
+			}
+		default:
+			familyName, metricType = name, "untyped"
+		}
+
+		f, ok := familyIndex[familyName]
+		if !ok {
+			f = &family{name: familyName, metricType: metricType}
+			families = append(families, f)
+			familyIndex[familyName] = f
+		}
+
+		names := make([]string, 0, len(sample.Metric))
+		for name := range sample.Metric {
+			if name != "__name__" {
+				names = append(names, string(name))
+			}
+		}
+		sort.Strings(names)
+
+		labels := make([]string, len(names))
+		for i, name := range names {
+			value := sample.Metric[model.LabelName(name)]
+			labels[i] = fmt.Sprintf(`%s="%s"`, name, prometheusLabelEscaper.Replace(string(value)))
+		}
+
+		metric := fmt.Sprintf("%s%s", metricPrefix, name)
+		if len(labels) > 0 {
+			metric += "{" + strings.Join(labels, ",") + "}"
+		}
+
+		value := strconv.FormatFloat(float64(sample.Value), 'g', -1, 64)
+
+		f.samples = append(f.samples, fmt.Sprintf("%s %s %d\n", metric, value, int64(sample.Timestamp)))
+	}
+
+	metrics := ""
+
+	for _, f := range families {
+		if f.metricType != "untyped" {
+			metrics += fmt.Sprintf("# TYPE %s%s %s\n", metricPrefix, f.name, f.metricType)
+		}
+
+		metrics += strings.Join(f.samples, "")
+	}
+
+	return metrics
+}
+
+// SampleFilter returns the samples to keep of samples.
+type SampleFilter func(samples model.Vector) (model.Vector, error)
+
+func FilterSamples(samples model.Vector, includeRegex string, excludeRegex string) (model.Vector, error) {
+	var reInclude, reExclude *regexp.Regexp
+	var err error
+
+	if includeRegex != "" {
+		reInclude, err = regexp.Compile(includeRegex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if excludeRegex != "" {
+		reExclude, err = regexp.Compile(excludeRegex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var filteredSamples model.Vector
+	for _, sample := range samples {
+		metricString := sample.Metric.String()
+
+		var matchInclude, matchExclude bool
+		if reInclude == nil {
+			// include all metrics
+			matchInclude = true
+		} else {
+			matchInclude = reInclude.MatchString(metricString)
+		}
+
+		if reExclude != nil {
+			matchExclude = reExclude.MatchString(metricString)
+		}
+
+		if matchInclude == true && matchExclude == false {
+			filteredSamples = append(filteredSamples, sample)
+		}
+	}
+	return filteredSamples, nil
+}
+
+// FilterSampleNames keeps the samples whose metric name matches the include
+// regex, if given, and not the exclude regex. Unlike FilterSamples the
+// regexes only match the metric name, and are anchored at both ends.
+func FilterSampleNames(samples model.Vector, includeNames string, excludeNames string) (model.Vector, error) {
+	var reInclude, reExclude *regexp.Regexp
+	var err error
+
+	if includeNames != "" {
+		reInclude, err = regexp.Compile("^(?:" + includeNames + ")$")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if excludeNames != "" {
+		reExclude, err = regexp.Compile("^(?:" + excludeNames + ")$")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var filteredSamples model.Vector
+	for _, sample := range samples {
+		name := string(sample.Metric[model.MetricNameLabel])
+
+		if reInclude != nil && !reInclude.MatchString(name) {
+			continue
+		}
+
+		if reExclude != nil && reExclude.MatchString(name) {
+			continue
+		}
+
+		filteredSamples = append(filteredSamples, sample)
+	}
+	return filteredSamples, nil
+}
+
+// FilterValues keeps the samples with a value from min to max, and drops
+// those with a NaN or infinite value when dropNonFinite is set. Pass -Inf
+// and +Inf for no minimum and maximum, NaN values are only dropped by
+// dropNonFinite.
+func FilterValues(samples model.Vector, dropNonFinite bool, min float64, max float64) model.Vector {
+	var filteredSamples model.Vector
+
+	for _, sample := range samples {
+		value := float64(sample.Value)
+
+		if dropNonFinite && (math.IsNaN(value) || math.IsInf(value, 0)) {
+			continue
+		}
+
+		if value < min || value > max {
+			continue
+		}
+
+		filteredSamples = append(filteredSamples, sample)
+	}
+
+	return filteredSamples
+}
+
+// DedupeSamples removes samples with the same metric name and labels as
+// another, e.g. when scraping HA Prometheus pairs or exporters exposing the
+// same series, keeping the newest in the position of the first. With
+// strict a duplicate is an error instead.
+func DedupeSamples(samples model.Vector, strict bool) (model.Vector, error) {
+	positions := make(map[model.Fingerprint]int, len(samples))
+	dedupedSamples := make(model.Vector, 0, len(samples))
+
+	for _, sample := range samples {
+		fingerprint := sample.Metric.Fingerprint()
+
+		position, ok := positions[fingerprint]
+		if !ok {
+			positions[fingerprint] = len(dedupedSamples)
+			dedupedSamples = append(dedupedSamples, sample)
+			continue
+		}
+
+		if strict {
+			return nil, fmt.Errorf("duplicate sample %s", sample.Metric)
+		}
+
+		if sample.Timestamp.After(dedupedSamples[position].Timestamp) {
+			dedupedSamples[position] = sample
+		}
+	}
+
+	return dedupedSamples, nil
+}
+
+// SortSamples sorts samples by metric name, then by labels, compared
+// label by label in name order, and then by timestamp, so the output does
+// not depend on the order exporters expose the samples in.
+func SortSamples(samples model.Vector) {
+	sort.SliceStable(samples, func(i, j int) bool {
+		a, b := samples[i], samples[j]
+
+		if a.Metric[model.MetricNameLabel] != b.Metric[model.MetricNameLabel] {
+			return a.Metric[model.MetricNameLabel] < b.Metric[model.MetricNameLabel]
+		}
+
+		aNames, bNames := sortedLabelNames(a.Metric), sortedLabelNames(b.Metric)
+
+		for k := 0; k < len(aNames) && k < len(bNames); k++ {
+			if aNames[k] != bNames[k] {
+				return aNames[k] < bNames[k]
+			}
+
+			aValue, bValue := a.Metric[aNames[k]], b.Metric[bNames[k]]
+			if aValue != bValue {
+				return aValue < bValue
+			}
+		}
+
+		if len(aNames) != len(bNames) {
+			return len(aNames) < len(bNames)
+		}
+
+		return a.Timestamp.Before(b.Timestamp)
+	})
+}
+
+// sortedLabelNames returns the label names of metric, except the metric
+// name, sorted.
+func sortedLabelNames(metric model.Metric) model.LabelNames {
+	names := make(model.LabelNames, 0, len(metric))
+	for name := range metric {
+		if name != model.MetricNameLabel {
+			names = append(names, name)
+		}
+	}
+	sort.Sort(names)
+
+	return names
+}
+
+// TruncatedSamplesMetric is the metric name of the sample reporting the
+// number of samples dropped by LimitSamples.
+const TruncatedSamplesMetric = "sensu_prometheus_collector_truncated_samples"
+
+// LimitSamples returns an error when there are more than maxSamples samples,
+// or with truncate the first maxSamples samples and a
+// TruncatedSamplesMetric sample with the number of dropped samples. A
+// maxSamples of 0 is unlimited.
+func LimitSamples(samples model.Vector, maxSamples int, truncate bool) (model.Vector, error) {
+	if maxSamples <= 0 || len(samples) <= maxSamples {
+		return samples, nil
+	}
+
+	if !truncate {
+		return nil, fmt.Errorf("collected %d samples, more than the maximum of %d", len(samples), maxSamples)
+	}
+
+	truncated := append(model.Vector{}, samples[:maxSamples]...)
+
+	return append(truncated, &model.Sample{
+		Metric:    model.Metric{model.MetricNameLabel: TruncatedSamplesMetric},
+		Value:     model.SampleValue(len(samples) - maxSamples),
+		Timestamp: model.Now(),
+	}), nil
+}
+
+// FormatMetrics formats samples in config.Format, returning false when it
+// is not a format printed to stdout.
+func FormatMetrics(samples model.Vector, config OutputConfig) (string, bool) {
+	switch config.Format {
+	case "influx":
+		return influxLines(samples, config), true
+	case "graphite":
+		return CreateGraphiteMetrics(samples, config.MetricPrefix, config.GraphiteTemplate, config.TimestampPrecision), true
+	case "graphite-tagged":
+		return CreateGraphiteTaggedMetrics(samples, config.MetricPrefix, config.TimestampPrecision), true
+	case "json":
+		if config.JSONSchema == "v2" {
+			return CreateJSONV2Metrics(samples, config.MetricTypes, config.TimestampPrecision), true
+		}
+
+		return CreateJSONMetrics(samples, config.TimestampPrecision), true
+	case "jsonl":
+		return CreateJSONLinesMetrics(samples, config.JSONSchema, config.MetricTypes, config.TimestampPrecision), true
+	case "prometheus":
+		return CreatePrometheusMetrics(samples, config.MetricPrefix, config.MetricTypes), true
+	case "carbon2":
+		return CreateCarbon2Metrics(samples, config.MetricPrefix, config.GlobalTags, config.TimestampPrecision), true
+	case "nagios":
+		return CreateNagiosMetrics(samples, config.MetricPrefix, config.Status, config.Warning, config.Critical), true
+	case "opentsdb":
+		return CreateOpenTSDBMetrics(samples, config.MetricPrefix, config.TimestampPrecision), true
+	}
+
+	return "", false
+}
+
+func OutputMetrics(samples model.Vector, config OutputConfig) error {
+	if output, ok := FormatMetrics(samples, config); ok {
+		fmt.Print(output)
+		return nil
+	}
+
+	switch config.Format {
+	case "sendtostatsd":
+		err := SendToStatsD(samples, config.MetricPrefix, config.GlobalTags, config.Statsd)
+
+		if err != nil {
+			return err
+		}
+	case "sendtocarbon":
+		err := SendToCarbon(samples, config)
+
+		if err != nil {
+			return err
+		}
+	case "sendtoinfluxdb":
+		err := SendToInfluxDB(samples, config)
+
+		if err != nil {
+			return err
+		}
+	case "sendtovictoriametrics":
+		err := SendToVictoriaMetrics(samples, config.MetricPrefix, config.MetricTypes, config.VictoriaMetrics)
+
+		if err != nil {
+			return err
+		}
+	case "sendtonats":
+		err := SendToNATS(samples, config)
+
+		if err != nil {
+			return err
+		}
+	case "sendtomqtt":
+		err := SendToMQTT(samples, config)
+
+		if err != nil {
+			return err
+		}
+	case "sendtoamqp":
+		err := SendToAMQP(samples, config)
+
+		if err != nil {
+			return err
+		}
+	case "sendtoazuremonitor":
+		err := SendToAzureMonitor(samples, config.MetricPrefix, config.AzureMonitor)
+
+		if err != nil {
+			return err
+		}
+	case "datadog":
+		err := SendToDatadog(samples, config.MetricPrefix, config.GlobalTags, config.Datadog)
+
+		if err != nil {
+			return err
+		}
+	case "sensu-agent":
+		err := SendToSensuAgent(samples, config)
+
+		if err != nil {
+			return err
+		}
+	case "sensu-backend":
+		err := SendToSensuBackend(samples, config)
+
+		if err != nil {
+			return err
+		}
+	case "sendtoopentsdb":
+		err := SendToOpenTSDB(samples, config.MetricPrefix, config.TimestampPrecision, config.OpenTSDB)
+
+		if err != nil {
+			return err
+		}
+	default:
+		return unknownOutputFormat(config.Format)
+	}
+
+	return nil
+}
+
+// OutputFormats are the supported output formats, those printed to stdout
+// by FormatMetrics first.
+var OutputFormats = []string{
+	"influx", "graphite", "graphite-tagged", "carbon2", "json", "jsonl", "nagios", "opentsdb", "prometheus",
+	"sendtostatsd", "sendtocarbon", "sendtoopentsdb", "sendtoinfluxdb", "sendtovictoriametrics", "sendtonats", "sendtomqtt", "sendtoamqp", "sendtoazuremonitor", "datadog", "sensu-agent", "sensu-backend",
+}
+
+// ValidateOutputFormats checks every format is one of OutputFormats, for
+// an unknown format to fail before anything is scraped or output.
+func ValidateOutputFormats(formats []string) error {
+	for _, format := range formats {
+		known := false
+
+		for _, outputFormat := range OutputFormats {
+			if format == outputFormat {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return unknownOutputFormat(format)
+		}
+	}
+
+	return nil
+}
+
+func unknownOutputFormat(format string) error {
+	return &FailureError{Class: FailureConfig, Err: fmt.Errorf("unknown output format %q, expected one of %s", format, strings.Join(OutputFormats, ", "))}
+}
+
+// WriteFileAtomic writes data to a temporary file in the directory of path
+// and renames it to path, so readers never see a partially written file.
+func WriteFileAtomic(path string, data []byte) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmpFile, err := ioutil.TempFile(dir, "."+name+".tmp")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tmpFile.Write(data)
+
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmpFile.Name(), 0644)
+	}
+
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(tmpFile.Name())
+	}
+
+	return err
+}
+
+// newPrometheusQueryAPI returns a client of the Prometheus API at promURL,
+// and a function closing its idle connections, to be called once the
+// queries are done so that daemon runs do not accumulate connections.
+func newPrometheusQueryAPI(promURL string, auth PrometheusAuth, tlsConfig *tls.Config, recorder *Recorder) (v1.API, func(), error) {
+	httpTransport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+
+	var transport http.RoundTripper = httpTransport
+
+	if auth.User != "" && auth.Password != "" {
+		transport = &basicAuthTransport{RoundTripper: transport, user: auth.User, password: auth.Password}
+	} else if auth.OAuth2 != nil {
+		transport = &OAuth2Transport{Base: transport, Source: auth.OAuth2}
+	}
+
+	if len(auth.Headers) > 0 {
+		transport = &headerTransport{RoundTripper: transport, headers: auth.Headers}
+	}
+
+	if recorder != nil {
+		transport = &recordTransport{Base: transport, Recorder: recorder}
+	}
+
+	promConfig := api.Config{
+		Address:      promURL,
+		RoundTripper: transport,
+	}
+	promClient, err := api.NewClient(promConfig)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return v1.NewAPI(promClient), httpTransport.CloseIdleConnections, nil
+}
+
+// QueryPrometheus runs an instant query. A matrix result, e.g. of a
+// subquery, is flattened into a sample per point, with its own timestamp,
+// and a scalar or string result is a single DefaultScalarMetric sample.
+func QueryPrometheus(promURL string, queryString string, auth PrometheusAuth, tlsConfig *tls.Config, requestOptions RequestOptions) (model.Vector, error) {
+	samples, _, err := queryPrometheus(promURL, queryString, DefaultScalarMetric, auth, tlsConfig, requestOptions)
+	return samples, err
+}
+
+// queryPrometheus runs an instant query as QueryPrometheus, naming the
+// sample of a scalar or string result scalarMetric, and also reporting
+// whether the result was a matrix, whose series have a sample per point.
+func queryPrometheus(promURL string, queryString string, scalarMetric string, auth PrometheusAuth, tlsConfig *tls.Config, requestOptions RequestOptions) (model.Vector, bool, error) {
+	promQueryClient, closeIdleConnections, err := newPrometheusQueryAPI(promURL, auth, tlsConfig, requestOptions.Recorder)
+
+	if err != nil {
+		return nil, false, &FailureError{Class: FailureConfig, Err: err}
+	}
+	defer closeIdleConnections()
+
+	promResponse, err := runQuery(queryString, requestOptions, func(ctx context.Context) (model.Value, v1.Warnings, error) {
+		return promQueryClient.Query(ctx, queryString, time.Now())
+	})
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	samples, err := ValueToVector(promResponse, scalarMetric)
+
+	if err != nil {
+		return nil, false, &FailureError{Class: FailureParse, Err: err}
+	}
+
+	return samples, promResponse.Type() == model.ValMatrix, nil
+}
+
+// QueryPrometheusRange runs a range query and returns every sample of the
+// resulting matrix with its own timestamp.
+func QueryPrometheusRange(promURL string, queryString string, queryRange v1.Range, auth PrometheusAuth, tlsConfig *tls.Config, requestOptions RequestOptions) (model.Vector, error) {
+	promQueryClient, closeIdleConnections, err := newPrometheusQueryAPI(promURL, auth, tlsConfig, requestOptions.Recorder)
+
+	if err != nil {
+		return nil, &FailureError{Class: FailureConfig, Err: err}
+	}
+	defer closeIdleConnections()
+
+	promResponse, err := runQuery(queryString, requestOptions, func(ctx context.Context) (model.Value, v1.Warnings, error) {
+		return promQueryClient.QueryRange(ctx, queryString, queryRange)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if promResponse.Type() == model.ValMatrix {
+		return MatrixToVector(promResponse.(model.Matrix)), nil
+	}
+
+	return nil, &FailureError{Class: FailureParse, Err: fmt.Errorf("unexpected response type %s", promResponse.Type())}
+}
+
+// runQuery runs a Prometheus API query with the timeout and retries of
+// requestOptions, logging the warnings of the result, e.g. of a partial
+// response. Connection errors, timeouts and 5xx responses are retried,
+// errors of the query itself are not.
+func runQuery(queryString string, requestOptions RequestOptions, query func(ctx context.Context) (model.Value, v1.Warnings, error)) (model.Value, error) {
+	var value model.Value
+
+	start := time.Now()
+	LogFields{"target": queryString}.Debugf("Querying %s", queryString)
+
+	err := retry(requestOptions, func() error {
+		ctx, cancel := requestOptions.withTimeout()
+		defer cancel()
+
+		var warnings v1.Warnings
+		var err error
+		value, warnings, err = query(ctx)
+
+		if err == nil {
+			for _, warning := range warnings {
+				LogFields{"target": queryString}.Warnf("query %s: %s", queryString, warning)
+			}
+
+			return nil
+		}
+
+		if ctx.Err() == context.DeadlineExceeded {
+			return &retryableError{&FailureError{Class: FailureUnreachable, Err: fmt.Errorf("query timed out after %s", requestOptions.Timeout)}}
+		}
+
+		if apiErr, ok := err.(*v1.Error); ok {
+			if apiErr.Type == v1.ErrServer {
+				return &retryableError{err}
+			}
+
+			if code := clientErrorStatus(apiErr); code == http.StatusUnauthorized || code == http.StatusForbidden {
+				return &FailureError{Class: FailureAuth, Err: err}
+			}
+
+			return err
+		}
+
+		return &retryableError{&FailureError{Class: FailureUnreachable, Err: err}}
+	})
+
+	duration := time.Since(start)
+
+	if err != nil {
+		LogFields{"target": queryString, "duration": duration}.Debugf("Query %s failed after %s: %v", queryString, duration, err)
+	} else {
+		LogFields{"target": queryString, "duration": duration}.Debugf("Query %s returned a %s in %s", queryString, value.Type(), duration)
+	}
+
+	return value, err
+}
+
+// clientErrorStatus returns the status code of the 4xx responses which are
+// not Prometheus API errors, the v1 client only reporting it in the message
+// of its ErrClient errors, e.g. "client error: 401", 0 for other errors.
+func clientErrorStatus(err *v1.Error) int {
+	if err.Type != v1.ErrClient {
+		return 0
+	}
+
+	var code int
+	if _, err := fmt.Sscanf(err.Msg, "client error: %d", &code); err != nil {
+		return 0
+	}
+
+	return code
+}
+
+// MatrixToVector flattens a matrix into one sample per value.
+func MatrixToVector(matrix model.Matrix) model.Vector {
+	samples := model.Vector{}
+
+	for _, stream := range matrix {
+		for _, pair := range stream.Values {
+			samples = append(samples, &model.Sample{
+				Metric:    stream.Metric.Clone(),
+				Value:     pair.Value,
+				Timestamp: pair.Timestamp,
+			})
+		}
+	}
+
+	return samples
+}
+
+// DefaultScalarMetric is the name of the sample of a scalar or string
+// query result, e.g. of scalar(count(up)), which has no metric name.
+const DefaultScalarMetric = "scalar"
+
+// ValueToVector converts a query result into samples. A matrix is
+// flattened as MatrixToVector, and a scalar or string is a single sample
+// named metricName, DefaultScalarMetric if empty. A string must hold a
+// number.
+func ValueToVector(value model.Value, metricName string) (model.Vector, error) {
+	if metricName == "" {
+		metricName = DefaultScalarMetric
+	}
+
+	metric := model.Metric{model.MetricNameLabel: model.LabelValue(metricName)}
+
+	switch value := value.(type) {
+	case model.Vector:
+		return value, nil
+	case model.Matrix:
+		return MatrixToVector(value), nil
+	case *model.Scalar:
+		return model.Vector{{Metric: metric, Value: value.Value, Timestamp: value.Timestamp}}, nil
+	case *model.String:
+		number, err := strconv.ParseFloat(strings.TrimSpace(value.Value), 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("string result %q is not a number", value.Value)
+		}
+
+		return model.Vector{{Metric: metric, Value: model.SampleValue(number), Timestamp: value.Timestamp}}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected response type %s", value.Type())
+}
+
+// ParseQueryTime parses an RFC 3339 timestamp, Unix timestamp or a
+// duration relative to now (e.g. 15m for fifteen minutes ago). An empty
+// value is now.
+func ParseQueryTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now, nil
+	}
+
+	if d, err := time.ParseDuration(strings.TrimPrefix(value, "-")); err == nil {
+		return now.Add(-d), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, expected an RFC 3339 or Unix timestamp, or a duration", value)
+}
+
+// ParseUnixSocketURL splits an exporter URL of the form
+// unix:///path/to/socket:/metrics into the socket path and the HTTP path,
+// which defaults to /metrics.
+func ParseUnixSocketURL(exporterURL string) (string, string, error) {
+	if !strings.HasPrefix(exporterURL, unixSocketScheme) {
+		return "", "", fmt.Errorf("not a unix socket URL: %s", exporterURL)
+	}
+
+	socketPath := strings.TrimPrefix(exporterURL, unixSocketScheme)
+	httpPath := "/metrics"
+
+	if i := strings.LastIndex(socketPath, ":/"); i >= 0 {
+		socketPath, httpPath = socketPath[:i], socketPath[i+1:]
+	}
+
+	if socketPath == "" {
+		return "", "", fmt.Errorf("missing socket path in unix socket URL: %s", exporterURL)
+	}
+
+	return socketPath, httpPath, nil
+}
+
+// QueryExporter scrapes an exporter, retrying connection errors, timeouts
+// and 5xx responses as requestOptions allows.
+func QueryExporter(exporterURL string, auth ExporterAuth, tlsConfig *tls.Config, parseOptions ParseOptions, requestOptions RequestOptions) (model.Vector, error) {
+	var samples model.Vector
+
+	start := time.Now()
+	LogFields{"target": exporterURL}.Debugf("Scraping %s", exporterURL)
+
+	err := retry(requestOptions, func() error {
+		var err error
+		samples, err = queryExporter(exporterURL, auth, tlsConfig, parseOptions, requestOptions)
+		return err
+	})
+
+	duration := time.Since(start)
+
+	if err != nil {
+		LogFields{"target": exporterURL, "duration": duration}.Debugf("Scrape of %s failed after %s: %v", exporterURL, duration, err)
+	} else {
+		LogFields{"target": exporterURL, "duration": duration, "samples": len(samples)}.Debugf("Scraped %d samples from %s in %s", len(samples), exporterURL, duration)
+	}
+
+	return samples, err
+}
+
+func queryExporter(exporterURL string, auth ExporterAuth, tlsConfig *tls.Config, parseOptions ParseOptions, requestOptions RequestOptions) (model.Vector, error) {
+	ctx, cancel := requestOptions.withTimeout()
+	defer cancel()
+
+	tr := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	// The transport is not reused by the next scrape, so its connection
+	// is closed rather than kept alive.
+	defer tr.CloseIdleConnections()
+
+	if strings.HasPrefix(exporterURL, unixSocketScheme) {
+		socketPath, httpPath, err := ParseUnixSocketURL(exporterURL)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+		exporterURL = "http://localhost" + httpPath
+	}
+
+	client := &http.Client{Transport: tr}
+	if auth.OAuth2 != nil {
+		client.Transport = &OAuth2Transport{Base: tr, Source: auth.OAuth2}
+	}
+	if requestOptions.Recorder != nil {
+		client.Transport = &recordTransport{Base: client.Transport, Recorder: requestOptions.Recorder}
+	}
+
+	req, err := http.NewRequest("GET", exporterURL, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	setHeaders(req, auth.Headers)
+
+	if auth.User != "" && auth.Password != "" {
+		req.SetBasicAuth(auth.User, auth.Password)
+	}
+
+	if auth.Header != "" {
+		req.Header.Set("Authorization", auth.Header)
+	}
+
+	// Requesting gzip explicitly disables the transport's transparent
+	// decompression, so the body is decompressed below.
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Accept", exporterAcceptHeader)
+
+	expResponse, err := client.Do(req)
+
+	if err != nil {
+		var failure *FailureError
+		if errors.As(err, &failure) {
+			return nil, err
+		}
+
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("scrape timed out after %s", requestOptions.Timeout)
+		}
+
+		return nil, &retryableError{&FailureError{Class: FailureUnreachable, Err: err}}
+	}
+	defer expResponse.Body.Close()
+
+	if expResponse.StatusCode != http.StatusOK {
+		err := errors.New("exporter returned non OK HTTP response status: " + expResponse.Status)
+
+		if expResponse.StatusCode == http.StatusUnauthorized || expResponse.StatusCode == http.StatusForbidden {
+			return nil, &FailureError{Class: FailureAuth, Err: err}
+		}
+
+		if expResponse.StatusCode/100 == 5 {
+			return nil, &retryableError{&FailureError{Class: FailureUnreachable, Err: err}}
+		}
+
+		return nil, &FailureError{Class: FailureUnreachable, Err: err}
+	}
+
+	samples, err := decodeExpositionResponse(expResponse, parseOptions)
+
+	// The parsers may take a read error for the end of the metrics, so a
+	// response cut short by the timeout is caught here.
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, &retryableError{&FailureError{Class: FailureUnreachable, Err: fmt.Errorf("scrape timed out after %s reading the response", requestOptions.Timeout)}}
+	}
+
+	if err != nil {
+		return nil, &FailureError{Class: FailureParse, Err: err}
+	}
+
+	return samples, nil
+}
+
+// decodeExpositionResponse parses the exposition of an exporter response,
+// decompressing it if it is gzip encoded.
+func decodeExpositionResponse(resp *http.Response, parseOptions ParseOptions) (model.Vector, error) {
+	body := io.Reader(resp.Body)
+
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(resp.Body)
+
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+
+		body = gzipReader
+	}
+
+	return ParseExposition(body, responseFormat(resp.Header), parseOptions)
+}
+
+// ParseExposition decodes the text, delimited protobuf or OpenMetrics
+// exposition format into samples. Unknown formats are parsed as text.
+// Samples without an exposed timestamp, or all samples unless timestamps
+// are honored, are stamped with the time of parsing.
+func ParseExposition(r io.Reader, format expfmt.Format, parseOptions ParseOptions) (model.Vector, error) {
+	now := model.Now()
+
+	var samples model.Vector
+	var err error
+
+	if format == FmtOpenMetrics {
+		samples, err = ParseOpenMetrics(r, now, parseOptions.Exemplars, parseOptions.Types)
+	} else {
+		samples, err = decodeExposition(r, format, now, parseOptions.Types)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !parseOptions.HonorTimestamps {
+		for _, sample := range samples {
+			sample.Timestamp = now
+		}
+	}
+
+	return samples, nil
+}
+
+func decodeExposition(r io.Reader, format expfmt.Format, now model.Time, types MetricTypes) (model.Vector, error) {
+	decoder := expfmt.NewDecoder(r, format)
+
+	samples := model.Vector{}
+
+	decodeOptions := &expfmt.DecodeOptions{
+		Timestamp: now,
+	}
+
+	for {
+		family := &dto.MetricFamily{}
+		err := decoder.Decode(family)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if types != nil {
+			types[family.GetName()] = strings.ToLower(family.GetType().String())
+		}
+
+		familySamples, _ := expfmt.ExtractSamples(decodeOptions, family)
+		samples = append(samples, familySamples...)
+	}
+
+	return samples, nil
+}
+
+// QueryExporters scrapes every exporter URL, as QueryTargets.
+func QueryExporters(exporterURLs []string, auth ExporterAuth, tlsConfig *tls.Config, parseOptions ParseOptions, requestOptions RequestOptions) (model.Vector, error) {
+	return QueryTargets(URLTargets(exporterURLs), auth, tlsConfig, parseOptions, requestOptions)
+}
+
+// QueryTargets scrapes every target, requestOptions.Concurrency at a time,
+// and merges the samples in target order, with the target labels added.
+// When more than one target is scraped each sample is labeled with its
+// source instance, unless the target has one; as with Prometheus target
+// labels, a label exposed by the exporter is kept as exported_<label>. The
+// errors of every failing target are returned as a MultiError, together
+// with the samples of the targets which were scraped.
+func QueryTargets(targets []Target, auth ExporterAuth, tlsConfig *tls.Config, parseOptions ParseOptions, requestOptions RequestOptions) (model.Vector, error) {
+	results := make([]model.Vector, len(targets))
+	types := make([]MetricTypes, len(targets))
+	errs := make([]error, len(targets))
+
+	runConcurrently(len(targets), requestOptions.Concurrency, func(i int) {
+		// The types of every scrape are parsed into their own map, merged
+		// below, as maps cannot be written concurrently.
+		options := parseOptions
+		if parseOptions.Types != nil {
+			types[i] = MetricTypes{}
+			options.Types = types[i]
+		}
+
+		var err error
+		results[i], err = QueryExporter(targets[i].URL, auth, tlsConfig, options, requestOptions)
+
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", targets[i].URL, err)
+		}
+	})
+
+	samples := model.Vector{}
+
+	for i, target := range targets {
+		if errs[i] != nil {
+			continue
+		}
+
+		for name, metricType := range types[i] {
+			parseOptions.Types[name] = metricType
+		}
+
+		labels := target.Labels
+
+		if _, ok := labels[model.InstanceLabel]; !ok && len(targets) > 1 {
+			instance, err := exporterInstance(target.URL)
+
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", target.URL, err)
+				continue
+			}
+
+			labels = labels.Clone()
+			if labels == nil {
+				labels = model.LabelSet{}
+			}
+			labels[model.InstanceLabel] = instance
+		}
+
+		addTargetLabels(results[i], labels)
+		samples = append(samples, results[i]...)
+	}
+
+	return samples, multiError(errs)
+}
+
+func exporterInstance(exporterURL string) (model.LabelValue, error) {
+	if strings.HasPrefix(exporterURL, unixSocketScheme) {
+		socketPath, _, err := ParseUnixSocketURL(exporterURL)
+		return model.LabelValue(socketPath), err
+	}
+
+	u, err := url.Parse(exporterURL)
+
+	if err != nil {
+		return "", err
+	}
+
+	return model.LabelValue(u.Host), nil
+}
+
+// NewTLSConfig returns a TLS configuration trusting the CA certificates in
+// caFile, in addition to the system roots, and presenting a client
+// certificate when a certificate and key are given.
+func NewTLSConfig(caFile string, certFile string, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if caFile != "" {
+		rootCAs, err := x509.SystemCertPool()
+
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+
+		caCert, err := ioutil.ReadFile(caFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !rootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no PEM encoded CA certificates found in %s", caFile)
+		}
+
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("both a TLS client certificate and key are required")
+		}
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// NewExporterAuth returns the exporter auth of the EXPORTER_ environment
+// variables, overridden by the user and password, if both are set, and the
+// Authorization header, if set.
+func NewExporterAuth(user string, password string, header string) (auth ExporterAuth, error error) {
+	err := envconfig.Process(exporterAuthID, &auth)
+
+	if err != nil {
+		return auth, err
+	}
+
+	if user != "" && password != "" {
+		auth.User = user
+		auth.Password = password
+	}
+
+	if header != "" {
+		auth.Header = header
+	}
+
+	return auth, nil
+}
+
+// NewPrometheusAuth returns the Prometheus API auth of the PROM_
+// environment variables, overridden by the user and password, if both are
+// set.
+func NewPrometheusAuth(user string, password string) (auth PrometheusAuth, error error) {
+	err := envconfig.Process(promAuthID, &auth)
+
+	if err != nil {
+		return auth, err
+	}
+
+	if user != "" && password != "" {
+		auth.User = user
+		auth.Password = password
+	}
+
+	return auth, nil
+}
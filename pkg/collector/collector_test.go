@@ -0,0 +1,808 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryExporter(t *testing.T) {
+	go func() {
+		http.Handle("/metrics", promhttp.Handler())
+		http.ListenAndServe(":7777", nil)
+	}()
+
+	time.Sleep(2 * time.Second)
+
+	samples, err := QueryExporter("http://localhost:7777/metrics", ExporterAuth{User: "", Password: "", Header: ""}, &tls.Config{}, ParseOptions{}, RequestOptions{})
+
+	assert.NoError(t, err)
+	assert.NotNil(t, samples)
+}
+
+func TestQueriesCloseConnections(t *testing.T) {
+	var open int32
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+			return
+		}
+
+		w.Write([]byte("up 1\n"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			atomic.AddInt32(&open, 1)
+		case http.StateClosed, http.StateHijacked:
+			atomic.AddInt32(&open, -1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	// Daemon runs scrape and query with new clients every interval, whose
+	// connections must not be kept alive.
+	for i := 0; i < 5; i++ {
+		_, err := QueryExporter(server.URL, ExporterAuth{}, nil, ParseOptions{}, RequestOptions{})
+		assert.NoError(t, err)
+
+		_, err = QueryPrometheus(server.URL, "up", PrometheusAuth{}, nil, RequestOptions{})
+		assert.NoError(t, err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&open) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&open))
+}
+
+func TestQueryExporters(t *testing.T) {
+	first := httptest.NewServer(promhttp.Handler())
+	defer first.Close()
+
+	second := httptest.NewServer(promhttp.Handler())
+	defer second.Close()
+
+	urls := []string{first.URL + "/metrics", second.URL + "/metrics"}
+
+	samples, err := QueryExporters(urls, ExporterAuth{}, &tls.Config{}, ParseOptions{}, RequestOptions{})
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, samples)
+
+	instances := map[string]int{}
+	for _, sample := range samples {
+		instances[string(sample.Metric["instance"])]++
+	}
+
+	assert.Len(t, instances, 2)
+	assert.Contains(t, instances, strings.TrimPrefix(first.URL, "http://"))
+	assert.Contains(t, instances, strings.TrimPrefix(second.URL, "http://"))
+}
+
+func TestQueryPrometheusRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/query_range", r.URL.Path)
+		assert.Equal(t, "up", r.FormValue("query"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[` +
+			`{"metric":{"__name__":"up","job":"node"},"values":[[1506991200,"1"],[1506991260,"0"]]}]}}`))
+	}))
+	defer server.Close()
+
+	end := time.Unix(1506991260, 0)
+	queryRange := v1.Range{Start: end.Add(-time.Minute), End: end, Step: time.Minute}
+
+	samples, err := QueryPrometheusRange(server.URL, "up", queryRange, PrometheusAuth{}, &tls.Config{}, RequestOptions{})
+
+	assert.NoError(t, err)
+	assert.Len(t, samples, 2)
+	assert.Equal(t, "up 1 1506991200\nup 0 1506991260\n", CreateGraphiteMetrics(samples, "", "", "s"))
+}
+
+func TestQueryPrometheusMatrix(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/query", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[` +
+			`{"metric":{"__name__":"up","job":"node"},"values":[[1506991200,"1"],[1506991260,"0"]]}]}}`))
+	}))
+	defer server.Close()
+
+	samples, err := QueryPrometheus(server.URL, "up[2m:1m]", PrometheusAuth{}, &tls.Config{}, RequestOptions{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "up 1 1506991200\nup 0 1506991260\n", CreateGraphiteMetrics(samples, "", "", "s"))
+	assert.Equal(t, "up,job=node value=1 1506991200000000000\nup,job=node value=0 1506991260000000000\n", CreateInfluxMetrics(samples, "", "ns"))
+}
+
+func TestQueryPrometheusWarnings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","warnings":["partial response"],"data":{"resultType":"vector","result":[` +
+			`{"metric":{"__name__":"up","job":"node"},"value":[1506991200,"1"]}]}}`))
+	}))
+	defer server.Close()
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	samples, err := QueryPrometheus(server.URL, "up", PrometheusAuth{}, &tls.Config{}, RequestOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+	assert.Contains(t, logged.String(), "warn: query up: partial response")
+}
+
+func TestValueToVector(t *testing.T) {
+	samples, err := ValueToVector(&model.String{Value: "0.5", Timestamp: 1506991200000}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, `scalar => 0.5 @[1506991200]`, samples[0].String())
+
+	_, err = ValueToVector(&model.String{Value: "ok"}, "")
+	assert.EqualError(t, err, `string result "ok" is not a number`)
+}
+
+func TestQueryTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("up 1\n"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	var failure *FailureError
+
+	_, err := QueryExporter(server.URL, ExporterAuth{}, nil, ParseOptions{}, RequestOptions{Timeout: 50 * time.Millisecond})
+	assert.EqualError(t, err, "scrape timed out after 50ms reading the response")
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureUnreachable, failure.Class)
+
+	_, err = QueryPrometheus(server.URL, "up", PrometheusAuth{}, &tls.Config{}, RequestOptions{Timeout: 50 * time.Millisecond})
+	assert.EqualError(t, err, "query timed out after 50ms")
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureUnreachable, failure.Class)
+}
+
+func TestQueryPrometheusBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "admin", user)
+		assert.Equal(t, "s3cret", password)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` +
+			`{"metric":{"__name__":"up","job":"node"},"value":[1506991200,"1"]}]}}`))
+	}))
+	defer server.Close()
+
+	samples, err := QueryPrometheus(server.URL, "up", PrometheusAuth{User: "admin", Password: "s3cret"}, &tls.Config{}, RequestOptions{})
+
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+}
+
+func TestSetPrometheusAuth(t *testing.T) {
+	defer os.Setenv("PROM_USER", os.Getenv("PROM_USER"))
+	defer os.Setenv("PROM_PASSWORD", os.Getenv("PROM_PASSWORD"))
+	os.Setenv("PROM_USER", "env-user")
+	os.Setenv("PROM_PASSWORD", "env-password")
+
+	auth, err := NewPrometheusAuth("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "env-user", auth.User)
+	assert.Equal(t, "env-password", auth.Password)
+
+	auth, err = NewPrometheusAuth("admin", "s3cret")
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", auth.User)
+	assert.Equal(t, "s3cret", auth.Password)
+}
+
+func TestParseQueryTime(t *testing.T) {
+	now := time.Unix(1506991260, 0)
+
+	for value, expected := range map[string]time.Time{
+		"":                     now,
+		"15m":                  now.Add(-15 * time.Minute),
+		"-1h":                  now.Add(-time.Hour),
+		"2017-10-03T00:41:00Z": time.Unix(1506991260, 0),
+		"1506991200":           time.Unix(1506991200, 0),
+	} {
+		parsed, err := ParseQueryTime(value, now)
+
+		assert.NoError(t, err, value)
+		assert.True(t, expected.Equal(parsed), value)
+	}
+
+	_, err := ParseQueryTime("yesterday", now)
+	assert.Error(t, err)
+}
+
+// writeTestCertificate writes a self-signed certificate and key valid for
+// localhost, returning the certificate and the PEM file paths.
+func writeTestCertificate(t *testing.T) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile, err := ioutil.TempFile("", "sensu-prometheus-collector-cert")
+	assert.NoError(t, err)
+	defer certFile.Close()
+	assert.NoError(t, pem.Encode(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	keyFile, err := ioutil.TempFile("", "sensu-prometheus-collector-key")
+	assert.NoError(t, err)
+	defer keyFile.Close()
+	assert.NoError(t, pem.Encode(keyFile, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+
+	return cert, certFile.Name(), keyFile.Name()
+}
+
+func TestQueryExporterClientCertificate(t *testing.T) {
+	cert, certFile, keyFile := writeTestCertificate(t)
+	defer os.Remove(certFile)
+	defer os.Remove(keyFile)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+
+	server := httptest.NewUnstartedServer(promhttp.Handler())
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	_, err := QueryExporter(server.URL, ExporterAuth{}, &tls.Config{InsecureSkipVerify: true}, ParseOptions{}, RequestOptions{})
+	assert.Error(t, err)
+
+	tlsConfig, err := NewTLSConfig("", certFile, keyFile, true)
+	assert.NoError(t, err)
+
+	samples, err := QueryExporter(server.URL, ExporterAuth{}, tlsConfig, ParseOptions{}, RequestOptions{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, samples)
+
+	_, err = NewTLSConfig("", certFile, "", false)
+	assert.Error(t, err)
+}
+
+func TestQueryExporterCACertificate(t *testing.T) {
+	_, certFile, keyFile := writeTestCertificate(t)
+	defer os.Remove(certFile)
+	defer os.Remove(keyFile)
+
+	serverCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(promhttp.Handler())
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	server.StartTLS()
+	defer server.Close()
+
+	_, err = QueryExporter(server.URL, ExporterAuth{}, &tls.Config{}, ParseOptions{}, RequestOptions{})
+	assert.Error(t, err)
+
+	tlsConfig, err := NewTLSConfig(certFile, "", "", false)
+	assert.NoError(t, err)
+
+	samples, err := QueryExporter(server.URL, ExporterAuth{}, tlsConfig, ParseOptions{}, RequestOptions{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, samples)
+
+	_, err = NewTLSConfig(keyFile, "", "", false)
+	assert.Error(t, err)
+}
+
+func TestParseUnixSocketURL(t *testing.T) {
+	socketPath, httpPath, err := ParseUnixSocketURL("unix:///var/run/foo.sock:/custom/metrics")
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/run/foo.sock", socketPath)
+	assert.Equal(t, "/custom/metrics", httpPath)
+
+	socketPath, httpPath, err = ParseUnixSocketURL("unix:///var/run/foo.sock")
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/run/foo.sock", socketPath)
+	assert.Equal(t, "/metrics", httpPath)
+
+	_, _, err = ParseUnixSocketURL("unix://:/metrics")
+	assert.Error(t, err)
+}
+
+func TestQueryExporterUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "exporter.sock")
+	listener, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(promhttp.Handler())
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	samples, err := QueryExporter("unix://"+socketPath+":/metrics", ExporterAuth{}, &tls.Config{}, ParseOptions{}, RequestOptions{})
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, samples)
+}
+
+func TestQueryExporterGzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip", r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		gz.Write([]byte("# TYPE foo_total counter\nfoo_total{bar=\"baz\"} 42\n"))
+	}))
+	defer server.Close()
+
+	samples, err := QueryExporter(server.URL, ExporterAuth{}, &tls.Config{}, ParseOptions{}, RequestOptions{})
+
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+	assert.Equal(t, model.SampleValue(42), samples[0].Value)
+}
+
+func TestQueryExporterProtobuf(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := expfmt.Negotiate(r.Header)
+		assert.Equal(t, expfmt.FmtProtoDelim, format)
+
+		family := &dto.MetricFamily{
+			Name: proto.String("foo_total"),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{
+				Label:   []*dto.LabelPair{{Name: proto.String("bar"), Value: proto.String("baz")}},
+				Counter: &dto.Counter{Value: proto.Float64(42)},
+			}},
+		}
+
+		w.Header().Set("Content-Type", string(format))
+		assert.NoError(t, expfmt.NewEncoder(w, format).Encode(family))
+	}))
+	defer server.Close()
+
+	samples, err := QueryExporter(server.URL, ExporterAuth{}, &tls.Config{}, ParseOptions{}, RequestOptions{})
+
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+	assert.Equal(t, model.LabelValue("baz"), samples[0].Metric["bar"])
+	assert.Equal(t, model.SampleValue(42), samples[0].Value)
+}
+
+func TestParseExpositionHonorTimestamps(t *testing.T) {
+	exposition := "foo 1 1506991233000\nbar 2\n"
+
+	samples, err := ParseExposition(strings.NewReader(exposition), expfmt.FmtText, ParseOptions{HonorTimestamps: true})
+
+	assert.NoError(t, err)
+	assert.Len(t, samples, 2)
+
+	for _, sample := range samples {
+		if sample.Metric[model.MetricNameLabel] == "foo" {
+			assert.Equal(t, model.Time(1506991233000), sample.Timestamp)
+		} else {
+			assert.True(t, sample.Timestamp.After(model.Time(1506991233000)))
+		}
+	}
+
+	samples, err = ParseExposition(strings.NewReader(exposition), expfmt.FmtText, ParseOptions{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, samples[0].Timestamp, samples[1].Timestamp)
+	assert.True(t, samples[0].Timestamp.After(model.Time(1506991233000)))
+}
+
+func TestTimestampPrecision(t *testing.T) {
+	samples := model.Vector{{
+		Metric:    model.Metric{model.MetricNameLabel: "foo", "bar": "baz"},
+		Value:     1.5,
+		Timestamp: model.Time(1506991233123),
+	}}
+
+	assert.Equal(t, "foo 1.5 1506991233\n", CreateGraphiteMetrics(samples, "", "", "s"))
+	assert.Equal(t, "foo 1.5 1506991233123\n", CreateGraphiteMetrics(samples, "", "", "ms"))
+	assert.Equal(t, "foo,bar=baz value=1.5 1506991233123000000\n", CreateInfluxMetrics(samples, "", "ns"))
+	assert.Contains(t, CreateJSONMetrics(samples, "ms"), `"Timestamp":1506991233123`)
+
+	assert.Equal(t, "ns", DefaultTimestampPrecision("influx"))
+	assert.Equal(t, "ns", DefaultTimestampPrecision("sendtoinfluxdb"))
+	assert.Equal(t, "s", DefaultTimestampPrecision("graphite"))
+	assert.Equal(t, "ns", DefaultTimestampPrecision(MessageFormat(OutputConfig{Format: "sendtonats", NATS: NATSConfig{Format: "influx"}})))
+	assert.Equal(t, "json", MessageFormat(OutputConfig{Format: "sendtomqtt", MQTT: MQTTConfig{Format: "json"}}))
+	assert.Equal(t, "graphite", MessageFormat(OutputConfig{Format: "graphite"}))
+}
+
+func TestCreateInfluxMetricsEscaping(t *testing.T) {
+	samples := model.Vector{{
+		Metric: model.Metric{
+			model.MetricNameLabel: "foo",
+			"path":                "C:\\Program Files",
+			"query":               "a=b,c",
+			"message":             "line one\nline two",
+			"empty":               "",
+		},
+		Value:     1,
+		Timestamp: model.Time(1506991233000),
+	}}
+
+	assert.Equal(t, "my\\ prefix\\,foo,message=line\\ one\\ line\\ two,path=C:\\Program\\ Files,query=a\\=b\\,c value=1 1506991233\n", CreateInfluxMetrics(samples, "my prefix,", "s"))
+}
+
+func TestCreateInfluxGroupedMetrics(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "rpc_duration_seconds_sum", "service": "a"}, Value: 12.5, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "rpc_duration_seconds_count", "service": "a"}, Value: 10, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "rpc_duration_seconds_sum", "service": "b"}, Value: 2, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "rpc_duration_seconds_count", "service": "b"}, Value: 4, Timestamp: model.Time(1506991233000)},
+	}
+
+	expected := "prometheus,service=a rpc_duration_seconds_sum=12.5,rpc_duration_seconds_count=10 1506991233\n" +
+		"prometheus,service=b rpc_duration_seconds_sum=2,rpc_duration_seconds_count=4 1506991233\n"
+
+	assert.Equal(t, expected, CreateInfluxGroupedMetrics(samples, "", "prometheus", "s"))
+}
+
+func TestCreatePrometheusMetrics(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "foo", "path": `C:\tmp`, "msg": "say \"hi\"\n"}, Value: 1.5, Timestamp: model.Time(1506991233123)},
+		{Metric: model.Metric{model.MetricNameLabel: "bar"}, Value: 2, Timestamp: model.Time(1506991233123)},
+	}
+
+	expected := `foo{msg="say \"hi\"\n",path="C:\\tmp"} 1.5 1506991233123` + "\n" +
+		"bar 2 1506991233123\n"
+
+	assert.Equal(t, expected, CreatePrometheusMetrics(samples, "", nil))
+}
+
+func TestCreatePrometheusMetricsTypes(t *testing.T) {
+	exposition := `# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 0.25 1506991233000
+rpc_duration_seconds_sum 1.5 1506991233000
+rpc_duration_seconds_count 2 1506991233000
+`
+	metricTypes := MetricTypes{}
+
+	samples, err := ParseExposition(strings.NewReader(exposition), expfmt.FmtText, ParseOptions{HonorTimestamps: true, Types: metricTypes})
+	assert.NoError(t, err)
+
+	samples = append(model.Vector{{Metric: model.Metric{model.MetricNameLabel: "up"}, Value: 1, Timestamp: model.Time(1506991233000)}}, samples...)
+
+	output := CreatePrometheusMetrics(samples, "", metricTypes)
+
+	assert.Equal(t, "up 1 1506991233000\n"+exposition, output)
+
+	// Sensu extracts prometheus_text output with the text parser.
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(output))
+	assert.NoError(t, err)
+	assert.Equal(t, dto.MetricType_SUMMARY, families["rpc_duration_seconds"].GetType())
+}
+
+func TestCreateJSONLinesMetrics(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "bar"}, Value: 2, Timestamp: model.Time(1506991233000)},
+	}
+
+	expected := `{"Tags":[{"Name":"__name__","Value":"foo"}],"Value":1,"Timestamp":1506991233}` + "\n" +
+		`{"Tags":[{"Name":"__name__","Value":"bar"}],"Value":2,"Timestamp":1506991233}` + "\n"
+
+	assert.Equal(t, expected, CreateJSONLinesMetrics(samples, "v1", nil, "s"))
+}
+
+func TestCreateJSONV2Metrics(t *testing.T) {
+	exposition := `# TYPE rpc_duration_seconds summary
+rpc_duration_seconds_sum{service="a"} 1.5 1506991233000
+rpc_duration_seconds_count{service="a"} 2 1506991233000
+`
+	metricTypes := MetricTypes{}
+
+	samples, err := ParseExposition(strings.NewReader(exposition), expfmt.FmtText, ParseOptions{HonorTimestamps: true, Types: metricTypes})
+	assert.NoError(t, err)
+
+	samples = append(samples, &model.Sample{Metric: model.Metric{model.MetricNameLabel: "up"}, Value: 1, Timestamp: model.Time(1506991233000)})
+
+	expected := `[{"name":"rpc_duration_seconds_sum","value":1.5,"timestamp":1506991233,"type":"summary","tags":{"service":"a"}},` +
+		`{"name":"rpc_duration_seconds_count","value":2,"timestamp":1506991233,"type":"summary","tags":{"service":"a"}},` +
+		`{"name":"up","value":1,"timestamp":1506991233,"type":"untyped","tags":{}}]`
+
+	assert.Equal(t, expected, CreateJSONV2Metrics(samples, metricTypes, "s"))
+	assert.Equal(t, `{"name":"up","value":1,"timestamp":1506991233,"type":"untyped","tags":{}}`+"\n", CreateJSONLinesMetrics(samples[2:], "v2", metricTypes, "s"))
+}
+
+func TestCreateCarbon2Metrics(t *testing.T) {
+	samples := model.Vector{{
+		Metric:    model.Metric{model.MetricNameLabel: "node_load1", "instance": "host1:9100", "job": "node exporter"},
+		Value:     0.5,
+		Timestamp: model.Time(1506991233000),
+	}}
+
+	assert.Equal(t, "metric=node_load1 instance=host1:9100 job=node_exporter  dc=eu 0.5 1506991233\n", CreateCarbon2Metrics(samples, "", []GlobalTag{{Name: "dc", Value: "eu"}}, "s"))
+	assert.Equal(t, "metric=node_load1 instance=host1:9100 job=node_exporter   0.5 1506991233\n", CreateCarbon2Metrics(samples, "", nil, "s"))
+}
+
+func TestCreateGraphiteMetricsTemplate(t *testing.T) {
+	samples := model.Vector{
+		{
+			Metric:    model.Metric{model.MetricNameLabel: "node_cpu_seconds_total", "instance": "host1.example.com:9100", "cpu": "0"},
+			Value:     1.5,
+			Timestamp: model.Time(1506991233000),
+		},
+		{
+			Metric:    model.Metric{model.MetricNameLabel: "node_load1", "instance": "host1.example.com:9100"},
+			Value:     0.5,
+			Timestamp: model.Time(1506991233000),
+		},
+	}
+
+	assert.Equal(t, "prefix.host1_example_com:9100.node_cpu_seconds_total.0 1.5 1506991233\nprefix.host1_example_com:9100.node_load1 0.5 1506991233\n", CreateGraphiteMetrics(samples, "prefix.", "{instance}.{__name__}.{cpu}", "s"))
+}
+
+func TestCreateGraphiteTaggedMetrics(t *testing.T) {
+	samples := model.Vector{{
+		Metric:    model.Metric{model.MetricNameLabel: "foo", "job": "node", "instance": "host1:9100", "mode": "a;b", "empty": ""},
+		Value:     1.5,
+		Timestamp: model.Time(1506991233000),
+	}}
+
+	assert.Equal(t, "prefix.foo;instance=host1:9100;job=node;mode=a_b 1.5 1506991233\n", CreateGraphiteTaggedMetrics(samples, "prefix.", "s"))
+}
+
+func TestCreateNagiosMetrics(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "node_load1"}, Value: 0.05, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "node_filesystem_avail_bytes", "mountpoint": "/mnt/my disk", "fstype": "ext4", "device": ""}, Value: 1024, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "node_scrape_ratio"}, Value: model.SampleValue(math.NaN()), Timestamp: model.Time(1506991233000)},
+	}
+
+	assert.Equal(t, "OK - collected 2 metrics | node.node_load1=0.05;;;; 'node.node_filesystem_avail_bytes{fstype:ext4,mountpoint:/mnt/my disk}'=1024;;;;\n", CreateNagiosMetrics(samples, "node.", CheckOK, nil, nil))
+	assert.Equal(t, "OK - collected 0 metrics\n", CreateNagiosMetrics(model.Vector{}, "", CheckOK, nil, nil))
+	assert.Equal(t, "CRITICAL - collected 1 metrics | node_load1=0.05;;;;\n", CreateNagiosMetrics(samples[:1], "", CheckCritical, nil, nil))
+
+	warning, _ := ParseThreshold("value > 0.9")
+	critical, _ := ParseThreshold("value >= 2")
+	assert.Equal(t, "OK - collected 1 metrics | node_load1=0.05;~:0.9;@2:~;;\n", CreateNagiosMetrics(samples[:1], "", CheckOK, warning, critical))
+	assert.Equal(t, "OK - collected 1 metrics | node_load1=0.05;;@2:~;;\n", CreateNagiosMetrics(samples[:1], "", CheckOK, nil, critical))
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "collector.prom")
+
+	assert.NoError(t, WriteFileAtomic(path, []byte("foo 1\n")))
+	assert.NoError(t, WriteFileAtomic(path, []byte("foo 2\n")))
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo 2\n", string(data))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// Only the file itself is left behind.
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	assert.Error(t, WriteFileAtomic(filepath.Join(dir, "missing", "collector.prom"), nil))
+}
+
+func TestLimitSamples(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "foo", "id": "1"}, Value: 1},
+		{Metric: model.Metric{model.MetricNameLabel: "foo", "id": "2"}, Value: 2},
+		{Metric: model.Metric{model.MetricNameLabel: "foo", "id": "3"}, Value: 3},
+	}
+
+	limited, err := LimitSamples(samples, 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, samples, limited)
+
+	limited, err = LimitSamples(samples, 3, false)
+	assert.NoError(t, err)
+	assert.Equal(t, samples, limited)
+
+	_, err = LimitSamples(samples, 2, false)
+	assert.EqualError(t, err, "collected 3 samples, more than the maximum of 2")
+
+	limited, err = LimitSamples(samples, 1, true)
+	assert.NoError(t, err)
+	assert.Len(t, limited, 2)
+	assert.Equal(t, samples[0], limited[0])
+	assert.Equal(t, model.LabelValue(TruncatedSamplesMetric), limited[1].Metric[model.MetricNameLabel])
+	assert.Equal(t, model.SampleValue(2), limited[1].Value)
+	assert.Len(t, samples, 3)
+}
+
+func TestDedupeSamples(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "up", "instance": "a"}, Value: 1, Timestamp: model.Time(1000)},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "instance": "b"}, Value: 1, Timestamp: model.Time(1000)},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "instance": "a"}, Value: 0, Timestamp: model.Time(2000)},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "instance": "b"}, Value: 0, Timestamp: model.Time(500)},
+	}
+
+	deduped, err := DedupeSamples(samples, false)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Vector{samples[2], samples[1]}, deduped)
+
+	_, err = DedupeSamples(samples, true)
+	assert.EqualError(t, err, `duplicate sample up{instance="a"}`)
+
+	deduped, err = DedupeSamples(samples[:2], true)
+	assert.NoError(t, err)
+	assert.Equal(t, samples[:2], deduped)
+}
+
+func TestSortSamples(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "up", "job": "node"}, Timestamp: model.Time(2000)},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "instance": "b", "job": "node"}},
+		{Metric: model.Metric{model.MetricNameLabel: "node_load1"}},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "instance": "a", "job": "node"}},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "job": "node"}, Timestamp: model.Time(1000)},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "instance": "a"}},
+	}
+
+	sorted := append(model.Vector{}, samples...)
+	SortSamples(sorted)
+
+	assert.Equal(t, model.Vector{samples[2], samples[5], samples[3], samples[1], samples[4], samples[0]}, sorted)
+	assert.Equal(t, `[{"Tags":[{"Name":"__name__","Value":"up"},{"Name":"instance","Value":"b"},{"Name":"job","Value":"node"}],"Value":0,"Timestamp":0}]`, CreateJSONMetrics(samples[1:2], "s"))
+}
+
+func TestFilterSampleNames(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "node_cpu_seconds_total", "mode": "idle"}},
+		{Metric: model.Metric{model.MetricNameLabel: "node_load1"}},
+		{Metric: model.Metric{model.MetricNameLabel: "go_goroutines", "job": "node_exporter"}},
+	}
+
+	filtered, err := FilterSampleNames(samples, "node_.*", "node_load.")
+	assert.NoError(t, err)
+	assert.Equal(t, model.Vector{samples[0]}, filtered)
+
+	// Label values do not match, and the regexes are anchored.
+	filtered, err = FilterSampleNames(samples, "node", "")
+	assert.NoError(t, err)
+	assert.Empty(t, filtered)
+
+	filtered, err = FilterSampleNames(samples, "", "go_.*|node_cpu_seconds_total")
+	assert.NoError(t, err)
+	assert.Equal(t, model.Vector{samples[1]}, filtered)
+
+	_, err = FilterSampleNames(samples, "(", "")
+	assert.Error(t, err)
+}
+
+func TestFilterValues(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "a"}, Value: 0.5},
+		{Metric: model.Metric{model.MetricNameLabel: "b"}, Value: model.SampleValue(math.NaN())},
+		{Metric: model.Metric{model.MetricNameLabel: "c"}, Value: model.SampleValue(math.Inf(1))},
+		{Metric: model.Metric{model.MetricNameLabel: "d"}, Value: -3},
+		{Metric: model.Metric{model.MetricNameLabel: "e"}, Value: 100},
+	}
+
+	assert.Equal(t, model.Vector{samples[0], samples[3], samples[4]}, FilterValues(samples, true, math.Inf(-1), math.Inf(1)))
+	assert.Equal(t, model.Vector{samples[0], samples[1]}, FilterValues(samples, false, 0, 1))
+	assert.Equal(t, model.Vector{samples[0], samples[3]}, FilterValues(samples, true, -10, 10))
+}
+
+func TestExpandMetricPrefix(t *testing.T) {
+	os.Setenv("COLLECTOR_TEST_DC", "ams1")
+	defer os.Unsetenv("COLLECTOR_TEST_DC")
+
+	prefix, err := ExpandMetricPrefix(`servers.{{.ShortHostname}}.{{env "COLLECTOR_TEST_DC"}}.`, "web-1.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "servers.web-1.ams1.", prefix)
+
+	prefix, err = ExpandMetricPrefix(`{{replace "." "_" .Hostname}}.`, "web-1.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "web-1_example_com.", prefix)
+
+	prefix, err = ExpandMetricPrefix("foo.bar.", "web-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo.bar.", prefix)
+
+	_, err = ExpandMetricPrefix("{{.Datacenter}}.", "web-1")
+	assert.Error(t, err)
+
+	_, err = ExpandMetricPrefix("{{.Hostname", "web-1")
+	assert.Error(t, err)
+}
+
+func TestExpandQuery(t *testing.T) {
+	defer os.Setenv("COLLECTOR_TEST_JOB", os.Getenv("COLLECTOR_TEST_JOB"))
+	os.Setenv("COLLECTOR_TEST_JOB", "node")
+
+	query, err := ExpandQuery(`up{instance="{{.ShortHostname}}:9100",job="{{env "COLLECTOR_TEST_JOB"}}"}`, "web-1.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, `up{instance="web-1:9100",job="node"}`, query)
+
+	query, err = ExpandQuery(`rate(http_requests_total{code=~"5.."}[5m])`, "web-1")
+	assert.NoError(t, err)
+	assert.Equal(t, `rate(http_requests_total{code=~"5.."}[5m])`, query)
+
+	_, err = ExpandQuery(`up{instance="{{.Instance}}"}`, "web-1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid query template: ")
+}
+
+func TestValidateOutputFormats(t *testing.T) {
+	assert.NoError(t, ValidateOutputFormats([]string{"influx", "nagios", "sendtostatsd", "sensu-backend"}))
+
+	err := ValidateOutputFormats([]string{"influx", "bogus"})
+	assert.Error(t, err)
+
+	var failure *FailureError
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureConfig, failure.Class)
+
+	err = OutputMetrics(model.Vector{}, OutputConfig{Format: "bogus"})
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureConfig, failure.Class)
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// LoadConfigFile reads a YAML or TOML configuration file and applies its
+// options to the flag set. Option names match the command line flag names
+// (e.g. exporter-url), list values are applied once per element so that
+// repeatable flags can be configured, and flags explicitly set on the
+// command line take precedence over the file.
+func LoadConfigFile(path string, flags *flag.FlagSet) error {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	return ApplyConfig(path, data, flags)
+}
+
+// ApplyConfig applies the options of the data of a config file, read from
+// path, to the flag set as LoadConfigFile.
+func ApplyConfig(path string, data []byte, flags *flag.FlagSet) error {
+	options, err := ParseConfig(path, data)
+
+	if err != nil {
+		return fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+
+	setOnCommandLine := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	for name, value := range options {
+		if flags.Lookup(name) == nil {
+			return fmt.Errorf("unknown option %q in config file %s", name, path)
+		}
+
+		if setOnCommandLine[name] {
+			continue
+		}
+
+		values, err := configValues(value)
+
+		if err != nil {
+			return fmt.Errorf("invalid value for option %q in config file %s: %v", name, path, err)
+		}
+
+		for _, v := range values {
+			if err := flags.Set(name, v); err != nil {
+				return fmt.Errorf("invalid value for option %q in config file %s: %v", name, path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ParseConfig parses the data of a YAML or TOML config file, read from
+// path, into its options.
+func ParseConfig(path string, data []byte) (map[string]interface{}, error) {
+	options := map[string]interface{}{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		if _, err := toml.Decode(string(data), &options); err != nil {
+			return nil, err
+		}
+	case ".yml", ".yaml", "":
+		if err := yaml.Unmarshal(data, &options); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unsupported config file extension, expected .yml, .yaml or .toml")
+	}
+
+	return options, nil
+}
+
+func configValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return []string{""}, nil
+	case []interface{}:
+		values := []string{}
+		for _, element := range v {
+			scalar, err := configScalar(element)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, scalar)
+		}
+		return values, nil
+	default:
+		scalar, err := configScalar(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{scalar}, nil
+	}
+}
+
+func configScalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool, int, int64, uint64:
+		return fmt.Sprint(v), nil
+	case float64:
+		// Not in exponent notation, e.g. 1e+06, which integer flags reject.
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", value)
+	}
+}
@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, extension string, content string) string {
+	file, err := ioutil.TempFile("", "sensu-prometheus-collector-*"+extension)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	_, err = file.WriteString(content)
+	assert.NoError(t, err)
+
+	return file.Name()
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	configs := map[string]string{
+		".yml": `
+exporter-url: http://localhost:9100/metrics
+output-format: graphite
+insecure-skip-verify: true
+`,
+		".toml": `
+exporter-url = "http://localhost:9100/metrics"
+output-format = "graphite"
+insecure-skip-verify = true
+`,
+	}
+
+	for extension, content := range configs {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		exporterURL := flags.String("exporter-url", "", "")
+		outputFormat := flags.String("output-format", "influx", "")
+		insecureSkipVerify := flags.Bool("insecure-skip-verify", false, "")
+
+		path := writeConfigFile(t, extension, content)
+		defer os.Remove(path)
+
+		err := LoadConfigFile(path, flags)
+
+		assert.NoError(t, err, extension)
+		assert.Equal(t, "http://localhost:9100/metrics", *exporterURL, extension)
+		assert.Equal(t, "graphite", *outputFormat, extension)
+		assert.True(t, *insecureSkipVerify, extension)
+	}
+}
+
+func TestLoadConfigFileCommandLinePrecedence(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	outputFormat := flags.String("output-format", "influx", "")
+	assert.NoError(t, flags.Parse([]string{"-output-format", "json"}))
+
+	path := writeConfigFile(t, ".yaml", "output-format: graphite\n")
+	defer os.Remove(path)
+
+	err := LoadConfigFile(path, flags)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "json", *outputFormat)
+}
+
+func TestLoadConfigFileUnknownOption(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	path := writeConfigFile(t, ".yml", "no-such-option: true\n")
+	defer os.Remove(path)
+
+	err := LoadConfigFile(path, flags)
+
+	assert.Error(t, err)
+}
+
+func TestLoadConfigFileLargeNumbers(t *testing.T) {
+	configs := map[string]string{
+		".yml":  "max-samples: 1000000\nmax-value: 1e7\nmin-value: 0.000001\n",
+		".toml": "max-samples = 1000000.0\nmax-value = 1e7\nmin-value = 0.000001\n",
+	}
+
+	for extension, content := range configs {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		maxSamples := flags.Int("max-samples", 0, "")
+		maxValue := flags.String("max-value", "", "")
+		minValue := flags.String("min-value", "", "")
+
+		path := writeConfigFile(t, extension, content)
+		defer os.Remove(path)
+
+		err := LoadConfigFile(path, flags)
+
+		assert.NoError(t, err, extension)
+		assert.Equal(t, 1000000, *maxSamples, extension)
+		assert.Equal(t, "10000000", *maxValue, extension)
+		assert.Equal(t, "0.000001", *minValue, extension)
+	}
+}
@@ -0,0 +1,202 @@
+package collector
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConsulConfig is the Consul agent of the catalog discovery.
+type ConsulConfig struct {
+	// Address is the agent URL, e.g. http://127.0.0.1:8500.
+	Address    string
+	Token      string
+	Datacenter string
+	TLSConfig  *tls.Config
+	Timeout    time.Duration
+}
+
+// ConsulConfigFromEnv returns the Consul configuration of the standard
+// Consul environment variables, CONSUL_HTTP_ADDR, CONSUL_HTTP_TOKEN,
+// CONSUL_HTTP_SSL, CONSUL_CACERT and CONSUL_HTTP_SSL_VERIFY, with address
+// overriding CONSUL_HTTP_ADDR if set.
+func ConsulConfigFromEnv(address string, timeout time.Duration) (ConsulConfig, error) {
+	if address == "" {
+		address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+
+	if address == "" {
+		address = "127.0.0.1:8500"
+	}
+
+	if !strings.Contains(address, "://") {
+		scheme := "http"
+		if ssl, _ := strconv.ParseBool(os.Getenv("CONSUL_HTTP_SSL")); ssl {
+			scheme = "https"
+		}
+		address = scheme + "://" + address
+	}
+
+	skipVerify := false
+	if verify := os.Getenv("CONSUL_HTTP_SSL_VERIFY"); verify != "" {
+		v, err := strconv.ParseBool(verify)
+
+		if err != nil {
+			return ConsulConfig{}, fmt.Errorf("invalid CONSUL_HTTP_SSL_VERIFY %q: %v", verify, err)
+		}
+
+		skipVerify = !v
+	}
+
+	tlsConfig, err := NewTLSConfig(os.Getenv("CONSUL_CACERT"), "", "", skipVerify)
+
+	if err != nil {
+		return ConsulConfig{}, err
+	}
+
+	return ConsulConfig{
+		Address:   address,
+		Token:     os.Getenv("CONSUL_HTTP_TOKEN"),
+		TLSConfig: tlsConfig,
+		Timeout:   timeout,
+	}, nil
+}
+
+// consulCatalogService is an instance of a service in the Consul catalog.
+type consulCatalogService struct {
+	Node           string            `json:"Node"`
+	Address        string            `json:"Address"`
+	Datacenter     string            `json:"Datacenter"`
+	NodeMeta       map[string]string `json:"NodeMeta"`
+	ServiceAddress string            `json:"ServiceAddress"`
+	ServicePort    int               `json:"ServicePort"`
+	ServiceTags    []string          `json:"ServiceTags"`
+}
+
+// consulInvalidLabelChars matches the characters of node metadata keys not
+// allowed in label names.
+var consulInvalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// DiscoverConsulTargets lists the instances of a service in the Consul
+// catalog having every tag, and returns their target groups, the service
+// address, or else the node address, and port. The samples are labeled
+// with the service, node and datacenter, and the node metadata as
+// node_meta_<key> labels.
+func DiscoverConsulTargets(config ConsulConfig, service string, tags []string) ([]TargetGroup, error) {
+	query := url.Values{}
+	for _, tag := range tags {
+		query.Add("tag", tag)
+	}
+	if config.Datacenter != "" {
+		query.Set("dc", config.Datacenter)
+	}
+
+	serviceURL := strings.TrimSuffix(config.Address, "/") + "/v1/catalog/service/" + url.PathEscape(service)
+	if len(query) > 0 {
+		serviceURL += "?" + query.Encode()
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config.TLSConfig,
+		},
+		Timeout: config.Timeout,
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequest("GET", serviceURL, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Token != "" {
+		req.Header.Set("X-Consul-Token", config.Token)
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return nil, &FailureError{Class: FailureUnreachable, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := errors.New("consul returned non 2xx HTTP response status: " + resp.Status + ": " + strings.TrimSpace(string(respBody)))
+
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized {
+			return nil, &FailureError{Class: FailureAuth, Err: err}
+		}
+
+		return nil, &FailureError{Class: FailureUnreachable, Err: err}
+	}
+
+	var instances []consulCatalogService
+
+	if err := json.NewDecoder(resp.Body).Decode(&instances); err != nil {
+		return nil, &FailureError{Class: FailureParse, Err: fmt.Errorf("failed to decode Consul catalog service: %v", err)}
+	}
+
+	var groups []TargetGroup
+
+	for _, instance := range instances {
+		// Older agents only filter on a single tag.
+		if !hasTags(instance.ServiceTags, tags) {
+			continue
+		}
+
+		address := instance.ServiceAddress
+		if address == "" {
+			address = instance.Address
+		}
+
+		labels := map[string]string{
+			"service":    service,
+			"node":       instance.Node,
+			"datacenter": instance.Datacenter,
+		}
+
+		for key, value := range instance.NodeMeta {
+			labels["node_meta_"+consulInvalidLabelChars.ReplaceAllString(key, "_")] = value
+		}
+
+		groups = append(groups, TargetGroup{
+			Targets: []string{net.JoinHostPort(address, strconv.Itoa(instance.ServicePort))},
+			Labels:  labels,
+		})
+	}
+
+	return groups, nil
+}
+
+func hasTags(tags []string, required []string) bool {
+	for _, r := range required {
+		found := false
+
+		for _, tag := range tags {
+			if tag == r {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsulConfigFromEnv(t *testing.T) {
+	for name, value := range map[string]string{"CONSUL_HTTP_ADDR": "consul:8501", "CONSUL_HTTP_SSL": "true", "CONSUL_HTTP_TOKEN": "token", "CONSUL_HTTP_SSL_VERIFY": "false", "CONSUL_CACERT": ""} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	config, err := ConsulConfigFromEnv("", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://consul:8501", config.Address)
+	assert.Equal(t, "token", config.Token)
+	assert.True(t, config.TLSConfig.InsecureSkipVerify)
+
+	config, err = ConsulConfigFromEnv("http://agent:8500", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://agent:8500", config.Address)
+
+	os.Setenv("CONSUL_HTTP_SSL_VERIFY", "maybe")
+	_, err = ConsulConfigFromEnv("", time.Second)
+	assert.Error(t, err)
+}
+
+func TestDiscoverConsulTargets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		assert.Equal(t, "/v1/catalog/service/node-exporter", r.URL.Path)
+		assert.Equal(t, []string{"metrics", "prod"}, r.URL.Query()["tag"])
+		assert.Equal(t, "eu1", r.URL.Query().Get("dc"))
+
+		w.Write([]byte(`[
+			{"Node":"server1","Address":"10.0.0.1","Datacenter":"eu1","NodeMeta":{"rack":"r1","consul-network-segment":""},"ServiceAddress":"","ServicePort":9100,"ServiceTags":["metrics","prod"]},
+			{"Node":"server2","Address":"10.0.0.2","Datacenter":"eu1","ServiceAddress":"192.168.0.2","ServicePort":9101,"ServiceTags":["prod","metrics"]},
+			{"Node":"server3","Address":"10.0.0.3","Datacenter":"eu1","ServicePort":9100,"ServiceTags":["metrics"]}
+		]`))
+	}))
+	defer server.Close()
+
+	config := ConsulConfig{Address: server.URL, Token: "token", Datacenter: "eu1", Timeout: time.Second}
+
+	groups, err := DiscoverConsulTargets(config, "node-exporter", []string{"metrics", "prod"})
+	assert.NoError(t, err)
+	assert.Equal(t, []TargetGroup{
+		{Targets: []string{"10.0.0.1:9100"}, Labels: map[string]string{"service": "node-exporter", "node": "server1", "datacenter": "eu1", "node_meta_rack": "r1", "node_meta_consul_network_segment": ""}},
+		{Targets: []string{"192.168.0.2:9101"}, Labels: map[string]string{"service": "node-exporter", "node": "server2", "datacenter": "eu1"}},
+	}, groups)
+
+	config.Token = ""
+	_, err = DiscoverConsulTargets(config, "node-exporter", []string{"metrics", "prod"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// Counter modes.
+const (
+	// CounterRaw outputs counters as exposed.
+	CounterRaw = "raw"
+	// CounterRate outputs the per second rate of counters since the
+	// previous run.
+	CounterRate = "rate"
+	// CounterDelta outputs the increase of counters since the previous run.
+	CounterDelta = "delta"
+)
+
+// CounterPoint is the value of a counter series at a time, in milliseconds.
+type CounterPoint struct {
+	Value     float64 `json:"value"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// CounterState are the counter values of the previous run, by series.
+type CounterState map[string]CounterPoint
+
+// CounterStatePath returns the path of the counter state file in dir of the
+// samples collected from a source, e.g. the exporter URLs or query, so
+// checks collecting different samples do not share a state file.
+func CounterStatePath(dir string, source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return filepath.Join(dir, "counters-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// LoadCounterState loads a counter state file, an empty state when it does
+// not exist yet.
+func LoadCounterState(path string) (CounterState, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return CounterState{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	state := CounterState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// SaveCounterState writes a counter state file.
+func SaveCounterState(path string, state CounterState) error {
+	data, err := json.Marshal(state)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(path, data)
+}
+
+// isCounter returns whether a sample name is of a counter family, or
+// untyped and ending in _total like counters, e.g. in query results.
+func isCounter(types MetricTypes, name string) bool {
+	switch types.Type(name) {
+	case "counter":
+		return true
+	case "untyped":
+		return strings.HasSuffix(name, "_total")
+	default:
+		return false
+	}
+}
+
+// ComputeCounters replaces the counter samples with their rate or delta
+// since the previous state, returning the state of this run. A counter
+// lower than before was reset, so its increase is its value. Counters
+// without a previous value, or a newer timestamp, are left out until the
+// next run.
+func ComputeCounters(samples model.Vector, types MetricTypes, mode string, previous CounterState) (model.Vector, CounterState) {
+	state := CounterState{}
+	computed := make(model.Vector, 0, len(samples))
+
+	for _, sample := range samples {
+		if !isCounter(types, string(sample.Metric[model.MetricNameLabel])) {
+			computed = append(computed, sample)
+			continue
+		}
+
+		value := float64(sample.Value)
+
+		if math.IsNaN(value) {
+			continue
+		}
+
+		key := sample.Metric.String()
+		state[key] = CounterPoint{Value: value, Timestamp: int64(sample.Timestamp)}
+
+		last, ok := previous[key]
+
+		if !ok || int64(sample.Timestamp) <= last.Timestamp {
+			continue
+		}
+
+		increase := value - last.Value
+		if increase < 0 {
+			increase = value
+		}
+
+		if mode == CounterRate {
+			increase /= float64(int64(sample.Timestamp)-last.Timestamp) / 1000
+		}
+
+		computed = append(computed, &model.Sample{
+			Metric:    sample.Metric,
+			Value:     model.SampleValue(increase),
+			Timestamp: sample.Timestamp,
+		})
+	}
+
+	return computed, state
+}
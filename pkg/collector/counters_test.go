@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeCounters(t *testing.T) {
+	types := MetricTypes{"http_requests": "counter", "temperature": "gauge"}
+
+	scrape := func(requests model.SampleValue, timestamp model.Time) model.Vector {
+		return model.Vector{
+			{Metric: model.Metric{model.MetricNameLabel: "http_requests_total", "code": "200"}, Value: requests, Timestamp: timestamp},
+			{Metric: model.Metric{model.MetricNameLabel: "temperature"}, Value: 21, Timestamp: timestamp},
+			{Metric: model.Metric{model.MetricNameLabel: "node_network_receive_bytes_total"}, Value: requests * 2, Timestamp: timestamp},
+		}
+	}
+
+	first := scrape(100, 10000)
+	computed, state := ComputeCounters(first, types, CounterRate, CounterState{})
+	assert.Equal(t, model.Vector{first[1]}, computed)
+	assert.Len(t, state, 2)
+
+	second := scrape(160, 40000)
+	computed, state = ComputeCounters(second, types, CounterRate, state)
+	assert.Len(t, computed, 3)
+	assert.Equal(t, model.SampleValue(2), computed[0].Value)
+	assert.Equal(t, second[1], computed[1])
+	assert.Equal(t, model.SampleValue(4), computed[2].Value)
+
+	// The counter was reset.
+	computed, _ = ComputeCounters(scrape(30, 70000), types, CounterDelta, state)
+	assert.Equal(t, model.SampleValue(30), computed[0].Value)
+	assert.Equal(t, model.SampleValue(60), computed[2].Value)
+
+	// Samples not newer than the state are left out.
+	computed, _ = ComputeCounters(scrape(160, 40000), types, CounterDelta, state)
+	assert.Len(t, computed, 1)
+}
+
+func TestCounterState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := CounterStatePath(dir, "http://localhost:9100/metrics")
+	assert.Equal(t, dir, filepath.Dir(path))
+	assert.NotEqual(t, path, CounterStatePath(dir, "http://localhost:9256/metrics"))
+
+	state, err := LoadCounterState(path)
+	assert.NoError(t, err)
+	assert.Empty(t, state)
+
+	state = CounterState{`http_requests_total{code="200"}`: {Value: 100, Timestamp: 10000}}
+	assert.NoError(t, SaveCounterState(path, state))
+
+	loaded, err := LoadCounterState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, state, loaded)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+	_, err = LoadCounterState(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,235 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// datadogBatchSize is the number of series per submission, keeping
+	// payloads well below the 5MB Datadog limit.
+	datadogBatchSize = 500
+	// datadogGauge is the Datadog metric intake type of gauges. Prometheus
+	// counters are cumulative, so they are submitted as gauges too, rather
+	// than as Datadog counts of the increase over the interval.
+	datadogGauge = 3
+)
+
+// DatadogConfig configures the datadog output.
+type DatadogConfig struct {
+	// URL is the Datadog API URL of the site, series are posted to
+	// /api/v2/series.
+	URL    string
+	APIKey string
+	// Host is the host resource of the series, if not empty.
+	Host string
+	// Compress gzips the request bodies.
+	Compress  bool
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+	// Retries is the number of times a submission failing with a network
+	// error, 429 or 5xx response is retried, waiting RetryDelay, doubled
+	// after every attempt, or the Retry-After of the response in between.
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// DatadogPoint is a point of the Datadog v2 series API.
+type DatadogPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// DatadogResource is a resource of the Datadog v2 series API.
+type DatadogResource struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// DatadogSeries is a series of the Datadog v2 series API.
+type DatadogSeries struct {
+	Metric    string            `json:"metric"`
+	Type      int               `json:"type"`
+	Points    []DatadogPoint    `json:"points"`
+	Tags      []string          `json:"tags,omitempty"`
+	Resources []DatadogResource `json:"resources,omitempty"`
+}
+
+// CreateDatadogSeries converts samples to Datadog series with the labels
+// and global tags as name:value tags. Datadog cannot store NaN or infinite
+// values, so those samples are skipped.
+func CreateDatadogSeries(samples model.Vector, metricPrefix string, globalTags []GlobalTag, host string) []DatadogSeries {
+	var tags []string
+	for _, tag := range globalTags {
+		tags = append(tags, tag.String())
+	}
+
+	var resources []DatadogResource
+	if host != "" {
+		resources = []DatadogResource{{Name: host, Type: "host"}}
+	}
+
+	series := []DatadogSeries{}
+
+	for _, sample := range samples {
+		value := float64(sample.Value)
+
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		sampleTags := append([]string{}, tags...)
+		for name, labelValue := range sample.Metric {
+			if name != "__name__" && labelValue != "" {
+				sampleTags = append(sampleTags, string(name)+":"+string(labelValue))
+			}
+		}
+		sort.Strings(sampleTags[len(tags):])
+
+		series = append(series, DatadogSeries{
+			Metric:    fmt.Sprintf("%s%s", metricPrefix, sample.Metric["__name__"]),
+			Type:      datadogGauge,
+			Points:    []DatadogPoint{{Timestamp: sample.Timestamp.Unix(), Value: value}},
+			Tags:      sampleTags,
+			Resources: resources,
+		})
+	}
+
+	return series
+}
+
+// SendToDatadog submits samples to the Datadog v2 /api/v2/series endpoint
+// in batches of datadogBatchSize series.
+func SendToDatadog(samples model.Vector, metricPrefix string, globalTags []GlobalTag, config DatadogConfig) error {
+	if config.APIKey == "" {
+		return errors.New("a Datadog API key is required")
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config.TLSConfig,
+		},
+		Timeout: config.Timeout,
+	}
+	defer client.CloseIdleConnections()
+
+	seriesURL := strings.TrimSuffix(config.URL, "/") + "/api/v2/series"
+	series := CreateDatadogSeries(samples, metricPrefix, globalTags, config.Host)
+
+	for start := 0; start < len(series); start += datadogBatchSize {
+		end := start + datadogBatchSize
+		if end > len(series) {
+			end = len(series)
+		}
+
+		body, err := json.Marshal(map[string][]DatadogSeries{"series": series[start:end]})
+
+		if err != nil {
+			return err
+		}
+
+		if config.Compress {
+			var compressed bytes.Buffer
+			gz := gzip.NewWriter(&compressed)
+			_, err = gz.Write(body)
+
+			if err == nil {
+				err = gz.Close()
+			}
+
+			if err != nil {
+				return err
+			}
+
+			body = compressed.Bytes()
+		}
+
+		if err := submitDatadog(client, seriesURL, config, body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func submitDatadog(client *http.Client, seriesURL string, config DatadogConfig, body []byte) error {
+	delay := config.RetryDelay
+	var err error
+
+	for attempt := 0; attempt <= config.Retries; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = postDatadog(client, seriesURL, config, body)
+
+		if err == nil {
+			return nil
+		}
+
+		if retryAfter < 0 || attempt == config.Retries {
+			break
+		}
+
+		if retryAfter == 0 {
+			retryAfter = delay
+			delay *= 2
+		}
+
+		time.Sleep(retryAfter)
+	}
+
+	return err
+}
+
+// postDatadog posts a batch of series, returning like postInfluxDB.
+func postDatadog(client *http.Client, seriesURL string, config DatadogConfig, body []byte) (time.Duration, error) {
+	req, err := http.NewRequest("POST", seriesURL, bytes.NewReader(body))
+
+	if err != nil {
+		return -1, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", config.APIKey)
+
+	if config.Compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return 0, nil
+	}
+
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	err = fmt.Errorf("datadog returned non 2xx HTTP response status: %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode/100 != 5 {
+		return -1, err
+	}
+
+	if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, err
+	}
+
+	return 0, err
+}
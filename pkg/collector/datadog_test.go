@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateDatadogSeries(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "node_load1", "instance": "localhost:9100", "job": ""}, Value: 0.5, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "node_scrape_ratio"}, Value: model.SampleValue(math.Inf(1)), Timestamp: model.Time(1506991233000)},
+	}
+
+	series := CreateDatadogSeries(samples, "node.", []GlobalTag{{Name: "dc", Value: "eu"}, {Name: "env", Value: "prod"}}, "server1")
+
+	assert.Equal(t, []DatadogSeries{{
+		Metric:    "node.node_load1",
+		Type:      datadogGauge,
+		Points:    []DatadogPoint{{Timestamp: 1506991233, Value: 0.5}},
+		Tags:      []string{"dc:eu", "env:prod", "instance:localhost:9100"},
+		Resources: []DatadogResource{{Name: "server1", Type: "host"}},
+	}}, series)
+}
+
+func TestSendToDatadog(t *testing.T) {
+	var payloads []map[string][]DatadogSeries
+	attempts := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+
+		assert.Equal(t, "/api/v2/series", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("DD-API-KEY"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+
+		// The first submission is rate limited and retried.
+		if attempts == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		gz, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+
+		var payload map[string][]DatadogSeries
+		assert.NoError(t, json.NewDecoder(gz).Decode(&payload))
+		payloads = append(payloads, payload)
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	samples := model.Vector{{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1, Timestamp: model.Time(1506991233000)}}
+
+	err := SendToDatadog(samples, "", nil, DatadogConfig{URL: ts.URL, APIKey: "secret", Compress: true, Retries: 1, RetryDelay: time.Millisecond})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string][]DatadogSeries{{"series": {{
+		Metric: "foo",
+		Type:   datadogGauge,
+		Points: []DatadogPoint{{Timestamp: 1506991233, Value: 1}},
+	}}}}, payloads)
+}
+
+func TestSendToDatadogError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors":["Forbidden"]}`, http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	samples := model.Vector{{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1}}
+
+	err := SendToDatadog(samples, "", nil, DatadogConfig{URL: ts.URL, APIKey: "wrong", Retries: 3})
+	assert.EqualError(t, err, `datadog returned non 2xx HTTP response status: 403 Forbidden: {"errors":["Forbidden"]}`)
+
+	err = SendToDatadog(samples, "", nil, DatadogConfig{URL: ts.URL})
+	assert.EqualError(t, err, "a Datadog API key is required")
+}
@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// TargetDiscovery discovers exporter targets, from a file_sd file,
+// Kubernetes, Consul, DNS SRV records and a Prometheus HTTP SD endpoint.
+type TargetDiscovery struct {
+	TargetsFile string
+	// KubeRole is KubePods or KubeServices, empty for no Kubernetes
+	// discovery, of the kubeconfig at KubeConfigPath.
+	KubeRole       string
+	KubeConfigPath string
+	KubeNamespace  string
+	KubeSelector   string
+	// ConsulService is the Consul catalog service of the targets, empty for
+	// no Consul discovery, of the agent at ConsulAddress, which overrides
+	// CONSUL_HTTP_ADDR if set.
+	ConsulService    string
+	ConsulTags       []string
+	ConsulAddress    string
+	ConsulDatacenter string
+	SRVNames         []string
+	HTTPSDURL        string
+	// TLSConfig is the TLS configuration of the HTTP SD endpoint.
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+}
+
+// Enabled reports whether any target discovery is configured.
+func (d *TargetDiscovery) Enabled() bool {
+	return d.TargetsFile != "" || d.KubeRole != "" || d.ConsulService != "" || len(d.SRVNames) > 0 || d.HTTPSDURL != ""
+}
+
+// Discover returns the targets of the targets file, then those discovered
+// in Kubernetes, Consul, DNS and the HTTP SD endpoint. Unless connect is
+// set, e.g. in dry runs, the targets file and configurations are loaded but
+// no target is discovered.
+func (d *TargetDiscovery) Discover(connect bool) ([]Target, error) {
+	var targets []Target
+
+	if d.TargetsFile != "" {
+		fileTargets, err := LoadTargetsFile(d.TargetsFile)
+
+		if err != nil {
+			return nil, Classify(err, FailureConfig)
+		}
+
+		targets = append(targets, fileTargets...)
+	}
+
+	discoverers := []func() ([]TargetGroup, error){}
+
+	if d.KubeRole != "" {
+		kubeConfig, err := LoadKubeConfig(d.KubeConfigPath)
+
+		if err != nil {
+			return nil, Classify(err, FailureConfig)
+		}
+
+		discoverers = append(discoverers, func() ([]TargetGroup, error) {
+			return DiscoverKubernetesTargets(kubeConfig, KubeDiscoveryOptions{
+				Role:      d.KubeRole,
+				Namespace: d.KubeNamespace,
+				Selector:  d.KubeSelector,
+				Timeout:   d.Timeout,
+			})
+		})
+	}
+
+	if d.ConsulService != "" {
+		consulConfig, err := ConsulConfigFromEnv(d.ConsulAddress, d.Timeout)
+
+		if err != nil {
+			return nil, Classify(err, FailureConfig)
+		}
+
+		consulConfig.Datacenter = d.ConsulDatacenter
+
+		discoverers = append(discoverers, func() ([]TargetGroup, error) {
+			return DiscoverConsulTargets(consulConfig, d.ConsulService, d.ConsulTags)
+		})
+	}
+
+	if len(d.SRVNames) > 0 {
+		discoverers = append(discoverers, func() ([]TargetGroup, error) {
+			return DiscoverSRVTargets(d.SRVNames, d.Timeout)
+		})
+	}
+
+	if d.HTTPSDURL != "" {
+		discoverers = append(discoverers, func() ([]TargetGroup, error) {
+			return DiscoverHTTPTargets(d.HTTPSDURL, d.TLSConfig, d.Timeout)
+		})
+	}
+
+	if !connect {
+		return targets, nil
+	}
+
+	for _, discover := range discoverers {
+		groups, err := discover()
+
+		if err != nil {
+			return nil, Classify(err, FailureUnreachable)
+		}
+
+		discovered, err := GroupTargets(groups)
+
+		if err != nil {
+			return nil, Classify(err, FailureUnreachable)
+		}
+
+		targets = append(targets, discovered...)
+	}
+
+	return targets, nil
+}
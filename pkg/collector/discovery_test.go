@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetDiscovery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/targets" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"targets":["server2:9100"]}]`))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	targetsFile := filepath.Join(dir, "targets.json")
+	assert.NoError(t, ioutil.WriteFile(targetsFile, []byte(`[{"targets":["server1:9100"]}]`), 0644))
+
+	discovery := &TargetDiscovery{TargetsFile: targetsFile, HTTPSDURL: server.URL + "/targets", Timeout: time.Second}
+	assert.True(t, discovery.Enabled())
+	assert.False(t, (&TargetDiscovery{}).Enabled())
+
+	targets, err := discovery.Discover(true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://server1:9100/metrics", "http://server2:9100/metrics"}, []string{targets[0].URL, targets[1].URL})
+
+	// Without connecting only the targets file is loaded.
+	targets, err = discovery.Discover(false)
+	assert.NoError(t, err)
+	assert.Len(t, targets, 1)
+
+	var failure *FailureError
+
+	discovery.HTTPSDURL = server.URL + "/missing"
+	_, err = discovery.Discover(true)
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureUnreachable, failure.Class)
+
+	discovery.TargetsFile = filepath.Join(dir, "missing.json")
+	_, err = discovery.Discover(false)
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureConfig, failure.Class)
+}
@@ -0,0 +1,45 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lookupSRV resolves SRV records, replaced by a fake resolver in tests.
+var lookupSRV = net.DefaultResolver.LookupSRV
+
+// DiscoverSRVTargets resolves the SRV records of every name, e.g.
+// _metrics._tcp.example.com, and returns a target group of the host:port
+// of each record, in the order of the records. Names
+// are resolved again on every run, so targets follow the published
+// records.
+func DiscoverSRVTargets(names []string, timeout time.Duration) ([]TargetGroup, error) {
+	var groups []TargetGroup
+
+	for _, name := range names {
+		ctx, cancel := context.WithCancel(context.Background())
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+
+		_, records, err := lookupSRV(ctx, "", "", name)
+		cancel()
+
+		if err != nil {
+			return nil, &FailureError{Class: FailureUnreachable, Err: err}
+		}
+
+		group := TargetGroup{}
+		for _, record := range records {
+			host := strings.TrimSuffix(record.Target, ".")
+			group.Targets = append(group.Targets, net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
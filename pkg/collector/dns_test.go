@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverSRVTargets(t *testing.T) {
+	defer func(lookup func(context.Context, string, string, string) (string, []*net.SRV, error)) {
+		lookupSRV = lookup
+	}(lookupSRV)
+
+	lookupSRV = func(ctx context.Context, service string, proto string, name string) (string, []*net.SRV, error) {
+		switch name {
+		case "_metrics._tcp.example.com":
+			return name, []*net.SRV{
+				{Target: "server1.example.com.", Port: 9100, Priority: 10, Weight: 5},
+				{Target: "server2.example.com.", Port: 9101, Priority: 10, Weight: 5},
+			}, nil
+		case "_metrics._tcp.example.org":
+			return name, []*net.SRV{{Target: "server3.example.org.", Port: 9100}}, nil
+		default:
+			return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		}
+	}
+
+	groups, err := DiscoverSRVTargets([]string{"_metrics._tcp.example.com", "_metrics._tcp.example.org"}, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, []TargetGroup{
+		{Targets: []string{"server1.example.com:9100", "server2.example.com:9101"}},
+		{Targets: []string{"server3.example.org:9100"}},
+	}, groups)
+
+	targets, err := GroupTargets(groups)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://server1.example.com:9100/metrics", targets[0].URL)
+
+	_, err = DiscoverSRVTargets([]string{"_metrics._tcp.missing.example.com"}, time.Second)
+	var failure *FailureError
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureUnreachable, failure.Class)
+}
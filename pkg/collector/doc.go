@@ -0,0 +1,36 @@
+// Package collector scrapes Prometheus exporters and queries Prometheus
+// APIs, filters the samples and encodes them in the output formats of the
+// sensu-prometheus-collector, for Sensu plugins to embed the collection
+// rather than shelling out to the collector.
+//
+// A run scrapes the samples with a Scraper, filters them with a Filter and
+// encodes them with an Encoder, as Collect does:
+//
+//	scraper := &collector.ExporterScraper{
+//		Targets: []collector.Target{{URL: "http://localhost:9100/metrics"}},
+//	}
+//	filter := collector.SampleFilter(func(samples model.Vector) (model.Vector, error) {
+//		return collector.FilterSampleNames(samples, "node_load1", "")
+//	})
+//	encoder := collector.FormatEncoder{
+//		Config: collector.OutputConfig{Format: "influx", TimestampPrecision: "ns"},
+//	}
+//
+//	output, err := collector.Collect(ctx, scraper, filter, encoder)
+//
+// A Run is a run of the collector command, processing the samples with a
+// Pipeline of the family policies, filters, counters, aggregations and the
+// other options between the scrape and the output, checking them against
+// the thresholds and writing them to Outputs:
+//
+//	run := &collector.Run{
+//		Scraper:  scraper,
+//		Pipeline: collector.Pipeline{Filter: &collector.FilterOptions{IncludeNames: "node_.*"}},
+//		Outputs:  collector.Outputs{Formats: []string{"influx"}},
+//	}
+//
+//	status, err := run.Collect(ctx)
+//
+// The lower level functions, e.g. QueryExporter, QueryPrometheus,
+// FilterSamples and CreateInfluxMetrics, are the steps of a Run.
+package collector
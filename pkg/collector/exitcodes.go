@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Failure classes, mapped to exit codes with -exit-code.
+const (
+	// FailureConfig is an invalid option, config file or TLS file.
+	FailureConfig = "config"
+	// FailureUnreachable is an exporter or Prometheus API that cannot be
+	// reached or fails the request.
+	FailureUnreachable = "unreachable"
+	// FailureAuth is an exporter or Prometheus API rejecting the
+	// credentials.
+	FailureAuth = "auth"
+	// FailureParse is an exposition or Sensu event that cannot be parsed.
+	FailureParse = "parse"
+	// FailureFilter is an invalid sample filter.
+	FailureFilter = "filter"
+	// FailureLimit is more samples than -max-samples.
+	FailureLimit = "limit"
+	// FailureOutput is an output that fails to send the samples.
+	FailureOutput = "output"
+	// FailureInterrupted is a run interrupted by SIGINT or SIGTERM.
+	FailureInterrupted = "interrupted"
+)
+
+// defaultExitCode is the exit code of failures, the Sensu critical status.
+const defaultExitCode = 2
+
+// interruptedExitCode is the exit code of interrupted runs, 128 + SIGINT as
+// shells exit, distinct from the failures of the checks.
+const interruptedExitCode = 130
+
+// ErrInterrupted is the error of scrapes and queries canceled on SIGINT or
+// SIGTERM.
+var ErrInterrupted = &FailureError{Class: FailureInterrupted, Err: errors.New("interrupted")}
+
+// FailureError is an error of a failure class.
+type FailureError struct {
+	Class string
+	Err   error
+}
+
+func (e *FailureError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *FailureError) Unwrap() error {
+	return e.Err
+}
+
+// Classify returns err as a FailureError of class, unless it already has a
+// class.
+func Classify(err error, class string) error {
+	var failure *FailureError
+	if err == nil || errors.As(err, &failure) {
+		return err
+	}
+
+	return &FailureError{Class: class, Err: err}
+}
+
+// ExitCodes maps failure classes to exit codes.
+type ExitCodes map[string]int
+
+// ParseExitCodes parses <class>=<code> mappings of the config, unreachable,
+// auth, parse, filter, limit, output and interrupted failure classes.
+func ParseExitCodes(mappings []string) (ExitCodes, error) {
+	exitCodes := ExitCodes{}
+
+	for _, mapping := range mappings {
+		kv := strings.SplitN(mapping, "=", 2)
+
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid exit code %q, expected <class>=<code>", mapping)
+		}
+
+		class := strings.TrimSpace(kv[0])
+
+		switch class {
+		case FailureConfig, FailureUnreachable, FailureAuth, FailureParse, FailureFilter, FailureLimit, FailureOutput, FailureInterrupted:
+		default:
+			return nil, fmt.Errorf("unknown failure class %q, expected config, unreachable, auth, parse, filter, limit, output or interrupted", class)
+		}
+
+		code, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+
+		if err != nil || code < 0 || code > 255 {
+			return nil, fmt.Errorf("invalid exit code %q, expected a number from 0 to 255", mapping)
+		}
+
+		exitCodes[class] = code
+	}
+
+	return exitCodes, nil
+}
+
+// Code returns the exit code of err, of its FailureError class or else of
+// defaultClass.
+func (c ExitCodes) Code(err error, defaultClass string) int {
+	class := defaultClass
+
+	var failure *FailureError
+	if errors.As(err, &failure) {
+		class = failure.Class
+	}
+
+	if code, ok := c[class]; ok {
+		return code
+	}
+
+	if class == FailureInterrupted {
+		return interruptedExitCode
+	}
+
+	return defaultExitCode
+}
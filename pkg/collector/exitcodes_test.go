@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExitCodes(t *testing.T) {
+	exitCodes, err := ParseExitCodes([]string{"unreachable=3", " auth = 3", "output=1", "interrupted=1"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, ExitCodes{FailureUnreachable: 3, FailureAuth: 3, FailureOutput: 1, FailureInterrupted: 1}, exitCodes)
+
+	for _, mapping := range []string{"unreachable", "timeout=3", "parse=three", "parse=256"} {
+		_, err := ParseExitCodes([]string{mapping})
+		assert.Error(t, err, mapping)
+	}
+}
+
+func TestExitCodesCode(t *testing.T) {
+	exitCodes := ExitCodes{FailureUnreachable: 3, FailureAuth: 4}
+
+	wrapped := fmt.Errorf("http://localhost:9100/metrics: %w", &FailureError{Class: FailureAuth, Err: errors.New("401 Unauthorized")})
+
+	assert.Equal(t, 4, exitCodes.Code(wrapped, FailureUnreachable))
+	assert.Equal(t, 3, exitCodes.Code(errors.New("connection refused"), FailureUnreachable))
+	assert.Equal(t, 2, exitCodes.Code(errors.New("invalid regex"), FailureFilter))
+	assert.Equal(t, 130, exitCodes.Code(ErrInterrupted, FailureUnreachable))
+	assert.Equal(t, 1, ExitCodes{FailureInterrupted: 1}.Code(ErrInterrupted, FailureUnreachable))
+}
+
+func TestQueryExporterFailureClasses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte("not an exposition {\n"))
+		}
+	}))
+
+	exitCodes := ExitCodes{FailureUnreachable: 3, FailureAuth: 4, FailureParse: 5}
+
+	for path, code := range map[string]int{"/auth": 4, "/error": 3, "/metrics": 5} {
+		_, err := QueryExporters([]string{ts.URL + path}, ExporterAuth{}, nil, ParseOptions{}, RequestOptions{})
+		assert.Equal(t, code, exitCodes.Code(err, FailureUnreachable), path)
+	}
+
+	ts.Close()
+
+	_, err := QueryExporters([]string{ts.URL + "/metrics"}, ExporterAuth{}, nil, ParseOptions{}, RequestOptions{})
+	assert.Equal(t, 3, exitCodes.Code(err, FailureConfig))
+}
+
+func TestQueryPrometheusFailureClasses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unauthorized/api/v1/query":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/forbidden/api/v1/query":
+			w.WriteHeader(http.StatusForbidden)
+		case "/missing/api/v1/query":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	exitCodes := ExitCodes{FailureUnreachable: 3, FailureAuth: 4}
+
+	for path, code := range map[string]int{"/unauthorized": 4, "/forbidden": 4, "/missing": 2, "/error": 2} {
+		_, err := QueryPrometheus(ts.URL+path, "up", PrometheusAuth{}, nil, RequestOptions{})
+		assert.Error(t, err, path)
+		assert.Equal(t, code, exitCodes.Code(err, FailureFilter), path)
+	}
+}
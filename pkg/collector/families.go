@@ -0,0 +1,153 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// Summary and histogram family policies.
+const (
+	// FamilyKeep outputs every sample of a family.
+	FamilyKeep = "keep"
+	// FamilyDrop drops the samples of a family.
+	FamilyDrop = "drop"
+	// FamilyCollapse replaces the samples of a family with a <family>_avg
+	// sample, _sum divided by _count, per series.
+	FamilyCollapse = "collapse"
+)
+
+// FamilyPolicies are the policies of summary and histogram families.
+type FamilyPolicies struct {
+	Summary   string
+	Histogram string
+	// Families are the policies of families by name, overriding Summary
+	// and Histogram.
+	Families map[string]string
+}
+
+func validFamilyPolicy(policy string) bool {
+	switch policy {
+	case FamilyKeep, FamilyDrop, FamilyCollapse:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseFamilyPolicies returns the policies of summary and histogram
+// families, the family policies are <family>=<keep|drop|collapse>.
+func ParseFamilyPolicies(summary string, histogram string, families []string) (FamilyPolicies, error) {
+	policies := FamilyPolicies{Summary: summary, Histogram: histogram, Families: map[string]string{}}
+
+	if !validFamilyPolicy(summary) {
+		return policies, fmt.Errorf("unknown summary policy %q, expected keep, drop or collapse", summary)
+	}
+
+	if !validFamilyPolicy(histogram) {
+		return policies, fmt.Errorf("unknown histogram policy %q, expected keep, drop or collapse", histogram)
+	}
+
+	for _, family := range families {
+		kv := strings.SplitN(family, "=", 2)
+
+		if len(kv) != 2 || !validFamilyPolicy(kv[1]) {
+			return policies, fmt.Errorf("invalid family policy %q, expected <family>=<keep|drop|collapse>", family)
+		}
+
+		policies.Families[kv[0]] = kv[1]
+	}
+
+	return policies, nil
+}
+
+// policy returns the policy of a family of a type.
+func (p FamilyPolicies) policy(family string, metricType string) string {
+	if policy, ok := p.Families[family]; ok {
+		return policy
+	}
+
+	switch metricType {
+	case "summary":
+		return p.Summary
+	case "histogram":
+		return p.Histogram
+	default:
+		return FamilyKeep
+	}
+}
+
+// ApplyFamilyPolicies drops or collapses the samples of the summary and
+// histogram families of types by their policy. A collapsed series is
+// output where its first sample was, with the labels of the series but the
+// quantile or le label, and the timestamp of its _sum.
+func ApplyFamilyPolicies(samples model.Vector, types MetricTypes, policies FamilyPolicies) model.Vector {
+	type series struct {
+		sample      *model.Sample
+		sum         float64
+		count       float64
+		hasSum      bool
+		hasCount    bool
+		isCollapsed bool
+	}
+
+	var output []*series
+	seriesIndex := map[model.Fingerprint]*series{}
+
+	for _, sample := range samples {
+		name := string(sample.Metric[model.MetricNameLabel])
+		family, metricType := types.Family(name)
+
+		if metricType != "summary" && metricType != "histogram" {
+			output = append(output, &series{sample: sample})
+			continue
+		}
+
+		switch policies.policy(family, metricType) {
+		case FamilyDrop:
+			continue
+		case FamilyKeep:
+			output = append(output, &series{sample: sample})
+			continue
+		}
+
+		metric := sample.Metric.Clone()
+		delete(metric, "quantile")
+		delete(metric, "le")
+		metric[model.MetricNameLabel] = model.LabelValue(family + "_avg")
+
+		fingerprint := metric.Fingerprint()
+		s, ok := seriesIndex[fingerprint]
+
+		if !ok {
+			s = &series{sample: &model.Sample{Metric: metric, Timestamp: sample.Timestamp}, isCollapsed: true}
+			output = append(output, s)
+			seriesIndex[fingerprint] = s
+		}
+
+		switch name {
+		case family + "_sum":
+			s.sum, s.hasSum = float64(sample.Value), true
+			s.sample.Timestamp = sample.Timestamp
+		case family + "_count":
+			s.count, s.hasCount = float64(sample.Value), true
+		}
+	}
+
+	collapsed := make(model.Vector, 0, len(output))
+
+	for _, s := range output {
+		if s.isCollapsed {
+			if !s.hasSum || !s.hasCount {
+				continue
+			}
+
+			s.sample.Value = model.SampleValue(s.sum / s.count)
+		}
+
+		collapsed = append(collapsed, s.sample)
+	}
+
+	return collapsed
+}
@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const testFamilies = `# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{service="a",quantile="0.5"} 0.2
+rpc_duration_seconds{service="a",quantile="0.99"} 0.9
+rpc_duration_seconds_sum{service="a"} 6
+rpc_duration_seconds_count{service="a"} 20
+rpc_duration_seconds_sum{service="b"} 0
+rpc_duration_seconds_count{service="b"} 0
+# TYPE request_size_bytes histogram
+request_size_bytes_bucket{le="100"} 3
+request_size_bytes_bucket{le="+Inf"} 4
+request_size_bytes_sum 500
+request_size_bytes_count 4
+# TYPE up gauge
+up 1
+`
+
+func familySamples(samples model.Vector) map[string]float64 {
+	values := map[string]float64{}
+	for _, sample := range samples {
+		values[sample.Metric.String()] = float64(sample.Value)
+	}
+	return values
+}
+
+func TestApplyFamilyPolicies(t *testing.T) {
+	types := MetricTypes{}
+	samples, err := ParseExposition(strings.NewReader(testFamilies), expfmt.FmtText, ParseOptions{Types: types})
+	assert.NoError(t, err)
+
+	policies, err := ParseFamilyPolicies(FamilyKeep, FamilyKeep, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, samples, ApplyFamilyPolicies(samples, types, policies))
+
+	policies, err = ParseFamilyPolicies(FamilyCollapse, FamilyDrop, nil)
+	assert.NoError(t, err)
+
+	values := familySamples(ApplyFamilyPolicies(samples, types, policies))
+	assert.Len(t, values, 3)
+	assert.Equal(t, 0.3, values[`rpc_duration_seconds_avg{service="a"}`])
+	assert.True(t, math.IsNaN(values[`rpc_duration_seconds_avg{service="b"}`]))
+	assert.Equal(t, 1.0, values[`up`])
+
+	policies, err = ParseFamilyPolicies(FamilyDrop, FamilyKeep, []string{"request_size_bytes=collapse"})
+	assert.NoError(t, err)
+
+	values = familySamples(ApplyFamilyPolicies(samples, types, policies))
+	assert.Equal(t, map[string]float64{`request_size_bytes_avg`: 125, `up`: 1}, values)
+}
+
+func TestParseFamilyPolicies(t *testing.T) {
+	_, err := ParseFamilyPolicies("average", FamilyKeep, nil)
+	assert.Error(t, err)
+
+	_, err = ParseFamilyPolicies(FamilyKeep, "", nil)
+	assert.Error(t, err)
+
+	_, err = ParseFamilyPolicies(FamilyKeep, FamilyKeep, []string{"request_size_bytes"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"crypto/tls"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// FederateURL returns the URL of the /federate endpoint of a Prometheus
+// server, selecting the series of every match[] selector.
+func FederateURL(promURL string, matches []string) (string, error) {
+	u, err := url.Parse(promURL)
+
+	if err != nil {
+		return "", err
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/federate"
+
+	query := u.Query()
+	for _, match := range matches {
+		query.Add("match[]", match)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// QueryFederate scrapes the series of the match[] selectors from the
+// /federate endpoint of a Prometheus server, keeping the job and instance
+// labels of the federated series.
+func QueryFederate(promURL string, matches []string, auth PrometheusAuth, tlsConfig *tls.Config, parseOptions ParseOptions, requestOptions RequestOptions) (model.Vector, error) {
+	federateURL, err := FederateURL(promURL, matches)
+
+	if err != nil {
+		return nil, &FailureError{Class: FailureConfig, Err: err}
+	}
+
+	exporterAuth := ExporterAuth{
+		User:     auth.User,
+		Password: auth.Password,
+		OAuth2:   auth.OAuth2,
+		Headers:  auth.Headers,
+	}
+
+	return QueryExporter(federateURL, exporterAuth, tlsConfig, parseOptions, requestOptions)
+}
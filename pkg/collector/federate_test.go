@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFederateURL(t *testing.T) {
+	federateURL, err := FederateURL("http://prom:9090/", []string{`{job="node"}`, `up{env=~"prod|staging"}`})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://prom:9090/federate?match%5B%5D=%7Bjob%3D%22node%22%7D&match%5B%5D=up%7Benv%3D~%22prod%7Cstaging%22%7D", federateURL)
+
+	federateURL, err = FederateURL("https://gateway.example.com/prometheus?tenant=a", []string{"up"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://gateway.example.com/prometheus/federate?match%5B%5D=up&tenant=a", federateURL)
+}
+
+func TestQueryFederate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/federate", r.URL.Path)
+		assert.Equal(t, []string{`{job="node"}`}, r.URL.Query()["match[]"])
+
+		user, password, _ := r.BasicAuth()
+		assert.Equal(t, "admin", user)
+		assert.Equal(t, "secret", password)
+
+		w.Write([]byte("# TYPE up untyped\nup{instance=\"10.0.0.1:9100\",job=\"node\"} 1 1600000000000\n"))
+	}))
+	defer server.Close()
+
+	samples, err := QueryFederate(server.URL, []string{`{job="node"}`}, PrometheusAuth{User: "admin", Password: "secret"}, nil, ParseOptions{Types: MetricTypes{}}, RequestOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+	assert.Equal(t, model.LabelValue("10.0.0.1:9100"), samples[0].Metric[model.InstanceLabel])
+	assert.Equal(t, model.LabelValue("node"), samples[0].Metric["job"])
+}
@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TenantHeader is the tenant header of multitenant Cortex, Mimir and Loki
+// APIs.
+const TenantHeader = "X-Scope-OrgID"
+
+// ParseHeaders parses "Name: value" HTTP headers, as given to -header. A
+// header may be repeated to send several values.
+func ParseHeaders(headers []string) (http.Header, error) {
+	parsed := http.Header{}
+
+	for _, header := range headers {
+		i := strings.Index(header, ":")
+
+		if i < 0 {
+			return nil, fmt.Errorf("invalid header %q, expected Name: value", header)
+		}
+
+		name := strings.TrimSpace(header[:i])
+
+		if name == "" || strings.ContainsAny(name, " \t\r\n") {
+			return nil, fmt.Errorf("invalid header name in %q, expected Name: value", header)
+		}
+
+		parsed.Add(name, strings.TrimSpace(header[i+1:]))
+	}
+
+	return parsed, nil
+}
+
+// WithTenant returns a copy of headers with the TenantHeader set to
+// tenant, overriding one set with -header.
+func WithTenant(headers http.Header, tenant string) http.Header {
+	withTenant := http.Header{}
+
+	for name, values := range headers {
+		withTenant[name] = append([]string(nil), values...)
+	}
+	withTenant.Set(TenantHeader, tenant)
+
+	return withTenant
+}
+
+// setHeaders sets the headers on req, replacing any it already has.
+func setHeaders(req *http.Request, headers http.Header) {
+	for name, values := range headers {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+}
+
+// headerTransport sets headers on the requests it round trips, as the
+// Prometheus API client has no option to.
+type headerTransport struct {
+	http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	withHeaders := req.WithContext(req.Context())
+	withHeaders.Header = make(http.Header, len(req.Header)+len(t.headers))
+	for name, values := range req.Header {
+		withHeaders.Header[name] = values
+	}
+	setHeaders(withHeaders, t.headers)
+
+	return t.RoundTripper.RoundTrip(withHeaders)
+}
@@ -0,0 +1,58 @@
+package collector
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders([]string{"X-Scope-OrgID: tenant-1", "x-route:  a:b ", "X-Scope-OrgID: tenant-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, http.Header{"X-Scope-Orgid": {"tenant-1", "tenant-2"}, "X-Route": {"a:b"}}, headers)
+
+	_, err = ParseHeaders([]string{"X-Scope-OrgID"})
+	assert.EqualError(t, err, `invalid header "X-Scope-OrgID", expected Name: value`)
+
+	_, err = ParseHeaders([]string{"X Scope: tenant"})
+	assert.EqualError(t, err, `invalid header name in "X Scope: tenant", expected Name: value`)
+}
+
+func TestQueryExporterHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "tenant-1", r.Header.Get("X-Scope-OrgID"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Write([]byte("up 1\n"))
+	}))
+	defer server.Close()
+
+	headers := http.Header{"X-Scope-Orgid": {"tenant-1"}, "Authorization": {"Bearer overridden"}}
+
+	samples, err := QueryExporter(server.URL, ExporterAuth{Header: "Bearer token", Headers: headers}, nil, ParseOptions{}, RequestOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+}
+
+func TestQueryPrometheusHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "tenant-1", r.Header.Get("X-Scope-OrgID"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` +
+			`{"metric":{"__name__":"up","job":"node"},"value":[1506991200,"1"]}]}}`))
+	}))
+	defer server.Close()
+
+	samples, err := QueryPrometheus(server.URL, "up", PrometheusAuth{Headers: http.Header{"X-Scope-Orgid": {"tenant-1"}}}, &tls.Config{}, RequestOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+}
+
+func TestWithTenant(t *testing.T) {
+	headers := http.Header{"X-Scope-Orgid": {"tenant-1"}, "X-Gateway": {"a"}}
+
+	assert.Equal(t, http.Header{"X-Scope-Orgid": {"tenant-2|tenant-3"}, "X-Gateway": {"a"}}, WithTenant(headers, "tenant-2|tenant-3"))
+	assert.Equal(t, "tenant-1", headers.Get(TenantHeader))
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DiscoverHTTPTargets fetches the target groups of a Prometheus HTTP SD
+// endpoint, a JSON list of target groups as in the file_sd format, served
+// with 200 OK and the application/json content type.
+func DiscoverHTTPTargets(sdURL string, tlsConfig *tls.Config, timeout time.Duration) ([]TargetGroup, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+		Timeout: timeout,
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequest("GET", sdURL, nil)
+
+	if err != nil {
+		return nil, &FailureError{Class: FailureConfig, Err: err}
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return nil, &FailureError{Class: FailureUnreachable, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := errors.New("HTTP SD endpoint returned non 200 HTTP response status: " + resp.Status + ": " + strings.TrimSpace(string(respBody)))
+
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized {
+			return nil, &FailureError{Class: FailureAuth, Err: err}
+		}
+
+		return nil, &FailureError{Class: FailureUnreachable, Err: err}
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "application/json" {
+		return nil, &FailureError{Class: FailureParse, Err: fmt.Errorf("HTTP SD endpoint returned unsupported content type %q", resp.Header.Get("Content-Type"))}
+	}
+
+	var groups []TargetGroup
+
+	if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
+		return nil, &FailureError{Class: FailureParse, Err: fmt.Errorf("failed to decode HTTP SD target groups: %v", err)}
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverHTTPTargets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/targets":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(`[{"targets":["10.0.0.1:9100","10.0.0.2:9100"],"labels":{"__metrics_path__":"/node/metrics","env":"production"}}]`))
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(`[]`))
+		case "/forbidden":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	groups, err := DiscoverHTTPTargets(server.URL+"/targets", nil, time.Second)
+	assert.NoError(t, err)
+
+	targets, err := GroupTargets(groups)
+	assert.NoError(t, err)
+	assert.Len(t, targets, 2)
+	assert.Equal(t, "http://10.0.0.1:9100/node/metrics", targets[0].URL)
+	assert.Equal(t, "production", string(targets[1].Labels["env"]))
+
+	var failure *FailureError
+
+	_, err = DiscoverHTTPTargets(server.URL+"/text", nil, time.Second)
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureParse, failure.Class)
+
+	_, err = DiscoverHTTPTargets(server.URL+"/forbidden", nil, time.Second)
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureAuth, failure.Class)
+
+	_, err = DiscoverHTTPTargets(server.URL+"/missing", nil, time.Second)
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureUnreachable, failure.Class)
+}
@@ -0,0 +1,163 @@
+package collector
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// InfluxDBConfig configures the sendtoinfluxdb output.
+type InfluxDBConfig struct {
+	// URL is the InfluxDB base URL, lines are posted to /api/v2/write.
+	URL       string
+	Org       string
+	Bucket    string
+	Token     string
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+	// BatchSize is the maximum number of lines per write request.
+	BatchSize int
+	// Retries is the number of times a write failing with a network error,
+	// 429 or 5xx response is retried, waiting RetryDelay, doubled after
+	// every attempt, or the Retry-After of the response in between.
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// influxLines formats samples in the line protocol, grouped into fields
+// when an influx measurement is configured.
+func influxLines(samples model.Vector, config OutputConfig) string {
+	if config.InfluxMeasurement != "" {
+		return CreateInfluxGroupedMetrics(samples, config.MetricPrefix, config.InfluxMeasurement, config.TimestampPrecision)
+	}
+
+	return CreateInfluxMetrics(samples, config.MetricPrefix, config.TimestampPrecision)
+}
+
+// SendToInfluxDB writes samples to the InfluxDB v2 /api/v2/write endpoint
+// in batches of config.InfluxDB.BatchSize lines.
+func SendToInfluxDB(samples model.Vector, config OutputConfig) error {
+	influxConfig := config.InfluxDB
+
+	if influxConfig.Bucket == "" {
+		return errors.New("an InfluxDB bucket is required")
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: influxConfig.TLSConfig,
+		},
+		Timeout: influxConfig.Timeout,
+	}
+	defer client.CloseIdleConnections()
+
+	query := url.Values{}
+	query.Set("bucket", influxConfig.Bucket)
+	query.Set("precision", config.TimestampPrecision)
+	if influxConfig.Org != "" {
+		query.Set("org", influxConfig.Org)
+	}
+
+	writeURL := strings.TrimSuffix(influxConfig.URL, "/") + "/api/v2/write?" + query.Encode()
+
+	lines := strings.SplitAfter(influxLines(samples, config), "\n")
+	lines = lines[:len(lines)-1]
+
+	batchSize := influxConfig.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(lines)
+	}
+
+	for start := 0; start < len(lines); start += batchSize {
+		end := start + batchSize
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		err := writeInfluxDB(client, writeURL, influxConfig, strings.Join(lines[start:end], ""))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeInfluxDB(client *http.Client, writeURL string, config InfluxDBConfig, body string) error {
+	delay := config.RetryDelay
+	var err error
+
+	for attempt := 0; attempt <= config.Retries; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = postInfluxDB(client, writeURL, config.Token, body)
+
+		if err == nil {
+			return nil
+		}
+
+		if retryAfter < 0 || attempt == config.Retries {
+			break
+		}
+
+		if retryAfter == 0 {
+			retryAfter = delay
+			delay *= 2
+		}
+
+		time.Sleep(retryAfter)
+	}
+
+	return err
+}
+
+// postInfluxDB posts a batch of lines. Failures that may succeed on retry
+// return the Retry-After of the response, or zero, while failures that
+// will not return a negative duration.
+func postInfluxDB(client *http.Client, writeURL string, token string, body string) (time.Duration, error) {
+	req, err := http.NewRequest("POST", writeURL, strings.NewReader(body))
+
+	if err != nil {
+		return -1, err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return 0, nil
+	}
+
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	err = fmt.Errorf("influxdb returned non 2xx HTTP response status: %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode/100 != 5 {
+		return -1, err
+	}
+
+	if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, err
+	}
+
+	return 0, err
+}
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendToInfluxDB(t *testing.T) {
+	var bodies []string
+	attempts := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+
+		assert.Equal(t, "/api/v2/write", r.URL.Path)
+		assert.Equal(t, "metrics", r.URL.Query().Get("bucket"))
+		assert.Equal(t, "example", r.URL.Query().Get("org"))
+		assert.Equal(t, "s", r.URL.Query().Get("precision"))
+		assert.Equal(t, "Token secret", r.Header.Get("Authorization"))
+
+		// The first write is rejected as overloaded and retried.
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "bar"}, Value: 2, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "baz"}, Value: 3, Timestamp: model.Time(1506991233000)},
+	}
+
+	config := OutputConfig{
+		TimestampPrecision: "s",
+		InfluxDB: InfluxDBConfig{
+			URL:        ts.URL,
+			Org:        "example",
+			Bucket:     "metrics",
+			Token:      "secret",
+			BatchSize:  2,
+			Retries:    1,
+			RetryDelay: time.Millisecond,
+		},
+	}
+
+	err := SendToInfluxDB(samples, config)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo value=1 1506991233\nbar value=2 1506991233\n", "baz value=3 1506991233\n"}, bodies)
+}
+
+func TestSendToInfluxDBError(t *testing.T) {
+	attempts := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, `{"code":"invalid","message":"unable to parse"}`, http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	samples := model.Vector{{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1}}
+
+	err := SendToInfluxDB(samples, OutputConfig{TimestampPrecision: "s", InfluxDB: InfluxDBConfig{URL: ts.URL, Bucket: "metrics", Retries: 3}})
+
+	assert.EqualError(t, err, `influxdb returned non 2xx HTTP response status: 400 Bad Request: {"code":"invalid","message":"unable to parse"}`)
+	assert.Equal(t, 1, attempts)
+}
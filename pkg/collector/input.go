@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// StdinInput is the input file, and exporter URL, of the exposition read
+// from stdin, e.g. piped in from curl or kubectl exec.
+const StdinInput = "-"
+
+// inputFileExt is the extension of the exposition files read from an input
+// directory, as with the node_exporter textfile collector.
+const inputFileExt = ".prom"
+
+// ReadInputFile parses a Prometheus text exposition file, or stdin if path
+// is StdinInput.
+func ReadInputFile(path string, parseOptions ParseOptions) (model.Vector, error) {
+	f := os.Stdin
+
+	if path != StdinInput {
+		var err error
+		f, err = os.Open(path)
+
+		if err != nil {
+			return nil, &FailureError{Class: FailureUnreachable, Err: err}
+		}
+		defer f.Close()
+	}
+
+	samples, err := ParseExposition(f, expfmt.FmtText, parseOptions)
+
+	if err != nil {
+		return nil, &FailureError{Class: FailureParse, Err: fmt.Errorf("error parsing input file %s: %v", inputName(path), err)}
+	}
+
+	return samples, nil
+}
+
+// InputDirFiles returns the .prom files of a directory, in name order.
+// Other files, e.g. those a batch job writes before renaming them into
+// place, are ignored.
+func InputDirFiles(dir string) ([]string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, &FailureError{Class: FailureUnreachable, Err: err}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+inputFileExt))
+
+	if err != nil {
+		return nil, &FailureError{Class: FailureConfig, Err: err}
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// ReadInputFiles parses every exposition file and merges the samples in
+// file order.
+func ReadInputFiles(paths []string, parseOptions ParseOptions) (model.Vector, error) {
+	samples := model.Vector{}
+
+	for _, path := range paths {
+		fileSamples, err := ReadInputFile(path, parseOptions)
+
+		if err != nil {
+			return nil, err
+		}
+
+		samples = append(samples, fileSamples...)
+	}
+
+	return samples, nil
+}
+
+func inputName(path string) string {
+	if path == StdinInput {
+		return "stdin"
+	}
+
+	return path
+}
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadInputFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"backup.prom":   "# TYPE backup_last_success_timestamp_seconds gauge\nbackup_last_success_timestamp_seconds 1.6e+09\n",
+		"batch.prom":    "# TYPE batch_records_total counter\nbatch_records_total{job=\"import\"} 42\n",
+		"batch.prom.$$": "batch_records_total{job=\"import\"} 43\n",
+		"README":        "not metrics\n",
+	}
+
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	paths, err := InputDirFiles(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "backup.prom"), filepath.Join(dir, "batch.prom")}, paths)
+
+	types := MetricTypes{}
+	samples, err := ReadInputFiles(paths, ParseOptions{Types: types})
+	assert.NoError(t, err)
+	assert.Len(t, samples, 2)
+	assert.Equal(t, model.LabelValue("backup_last_success_timestamp_seconds"), samples[0].Metric[model.MetricNameLabel])
+	assert.Equal(t, model.SampleValue(42), samples[1].Value)
+	assert.Equal(t, "counter", types["batch_records_total"])
+
+	var failure *FailureError
+
+	_, err = ReadInputFiles([]string{filepath.Join(dir, "missing.prom")}, ParseOptions{})
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureUnreachable, failure.Class)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "invalid.prom"), []byte("metric{ 1\n"), 0644))
+	_, err = ReadInputFiles([]string{filepath.Join(dir, "invalid.prom")}, ParseOptions{})
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureParse, failure.Class)
+
+	_, err = InputDirFiles(filepath.Join(dir, "missing"))
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureUnreachable, failure.Class)
+}
+
+func TestReadInputFileStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+
+	defer func(stdin *os.File) {
+		os.Stdin = stdin
+	}(os.Stdin)
+	os.Stdin = r
+
+	_, err = w.Write([]byte("up{job=\"node\"} 1\n"))
+	assert.NoError(t, err)
+	w.Close()
+
+	samples, err := ReadInputFile(StdinInput, ParseOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+	assert.Equal(t, model.SampleValue(1), samples[0].Value)
+}
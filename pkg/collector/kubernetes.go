@@ -0,0 +1,655 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// KubePods and KubeServices are the -kube-discovery roles.
+	KubePods     = "pod"
+	KubeServices = "service"
+
+	// kubeServiceAccountDir is the directory of the service account
+	// credentials mounted in pods.
+	kubeServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// The annotations of the pods and services to scrape, as understood
+	// by the Prometheus Helm charts.
+	kubeScrapeAnnotation = "prometheus.io/scrape"
+	kubePortAnnotation   = "prometheus.io/port"
+	kubePathAnnotation   = "prometheus.io/path"
+	kubeSchemeAnnotation = "prometheus.io/scheme"
+
+	// kubeExecCredentialKind is the kind of the objects exchanged with exec
+	// credential plugins.
+	kubeExecCredentialKind = "ExecCredential"
+)
+
+// KubeConfig is the API server and credentials of a Kubernetes cluster.
+type KubeConfig struct {
+	Server    string
+	Token     string
+	Username  string
+	Password  string
+	Namespace string
+	TLSConfig *tls.Config
+	// Exec is the exec credential plugin of the user, run for the
+	// credentials of every request, if any.
+	Exec *KubeExecConfig
+}
+
+// KubeExecConfig is an exec credential plugin of a kubeconfig user, e.g.
+// gke-gcloud-auth-plugin or aws eks get-token, printing an ExecCredential
+// of the client.authentication.k8s.io API.
+type KubeExecConfig struct {
+	APIVersion string `yaml:"apiVersion"`
+	// Command is looked up in PATH, or relative to the kubeconfig file if
+	// it has a path separator.
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	Env     []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"env"`
+	// ProvideClusterInfo passes the server and CA of the cluster to the
+	// plugin.
+	ProvideClusterInfo bool `yaml:"provideClusterInfo"`
+
+	certificateAuthorityData []byte
+}
+
+// kubeExecCluster is the cluster passed to exec credential plugins with
+// provideClusterInfo.
+type kubeExecCluster struct {
+	Server                   string `json:"server"`
+	CertificateAuthorityData []byte `json:"certificate-authority-data,omitempty"`
+	InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify,omitempty"`
+}
+
+// kubeExecCredential is the ExecCredential passed to, and printed by, exec
+// credential plugins.
+type kubeExecCredential struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Interactive bool             `json:"interactive"`
+		Cluster     *kubeExecCluster `json:"cluster,omitempty"`
+	} `json:"spec"`
+	Status *struct {
+		Token                 string `json:"token"`
+		ClientCertificateData string `json:"clientCertificateData"`
+		ClientKeyData         string `json:"clientKeyData"`
+	} `json:"status,omitempty"`
+}
+
+// kubeconfigFile is the part of a kubeconfig file used to connect to the
+// cluster of its current context.
+type kubeconfigFile struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string          `yaml:"token"`
+			TokenFile             string          `yaml:"tokenFile"`
+			Username              string          `yaml:"username"`
+			Password              string          `yaml:"password"`
+			ClientCertificate     string          `yaml:"client-certificate"`
+			ClientCertificateData string          `yaml:"client-certificate-data"`
+			ClientKey             string          `yaml:"client-key"`
+			ClientKeyData         string          `yaml:"client-key-data"`
+			Exec                  *KubeExecConfig `yaml:"exec"`
+			AuthProvider          interface{}     `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// LoadKubeConfig returns the configuration of the kubeconfig file at path,
+// or, when path is empty, of the KUBECONFIG environment variable, the
+// in-cluster service account when running in a pod, or ~/.kube/config.
+func LoadKubeConfig(path string) (KubeConfig, error) {
+	if path == "" {
+		path = os.Getenv("KUBECONFIG")
+	}
+
+	if path == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return InClusterKubeConfig()
+	}
+
+	if path == "" {
+		home, err := os.UserHomeDir()
+
+		if err != nil {
+			return KubeConfig{}, err
+		}
+
+		path = filepath.Join(home, ".kube", "config")
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return KubeConfig{}, err
+	}
+
+	config, err := ParseKubeConfig(data, filepath.Dir(path))
+
+	if err != nil {
+		return KubeConfig{}, fmt.Errorf("error parsing kubeconfig %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+// InClusterKubeConfig returns the configuration of the service account of
+// the pod running the collector.
+func InClusterKubeConfig() (KubeConfig, error) {
+	token, err := ioutil.ReadFile(filepath.Join(kubeServiceAccountDir, "token"))
+
+	if err != nil {
+		return KubeConfig{}, err
+	}
+
+	namespace, _ := ioutil.ReadFile(filepath.Join(kubeServiceAccountDir, "namespace"))
+
+	tlsConfig, err := NewTLSConfig(filepath.Join(kubeServiceAccountDir, "ca.crt"), "", "", false)
+
+	if err != nil {
+		return KubeConfig{}, err
+	}
+
+	return KubeConfig{
+		Server:    "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")),
+		Token:     strings.TrimSpace(string(token)),
+		Namespace: strings.TrimSpace(string(namespace)),
+		TLSConfig: tlsConfig,
+	}, nil
+}
+
+// ParseKubeConfig parses the cluster and user of the current context of a
+// kubeconfig file, relative file paths being relative to dir. Exec
+// credential plugins are supported, but not the auth provider plugins
+// deprecated by Kubernetes.
+func ParseKubeConfig(data []byte, dir string) (KubeConfig, error) {
+	var file kubeconfigFile
+
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return KubeConfig{}, err
+	}
+
+	config := KubeConfig{TLSConfig: &tls.Config{}}
+	contextFound := false
+	var clusterCA []byte
+
+	for _, context := range file.Contexts {
+		if context.Name != file.CurrentContext {
+			continue
+		}
+
+		contextFound = true
+		config.Namespace = context.Context.Namespace
+
+		for _, cluster := range file.Clusters {
+			if cluster.Name != context.Context.Cluster {
+				continue
+			}
+
+			config.Server = cluster.Cluster.Server
+			config.TLSConfig.InsecureSkipVerify = cluster.Cluster.InsecureSkipTLSVerify
+
+			ca, err := kubeconfigData(cluster.Cluster.CertificateAuthorityData, cluster.Cluster.CertificateAuthority, dir)
+
+			if err != nil {
+				return KubeConfig{}, err
+			}
+
+			clusterCA = ca
+
+			if ca != nil {
+				config.TLSConfig.RootCAs = x509.NewCertPool()
+
+				if !config.TLSConfig.RootCAs.AppendCertsFromPEM(ca) {
+					return KubeConfig{}, fmt.Errorf("no PEM encoded CA certificates found for cluster %s", cluster.Name)
+				}
+			}
+		}
+
+		for _, user := range file.Users {
+			if user.Name != context.Context.User {
+				continue
+			}
+
+			if user.User.AuthProvider != nil {
+				return KubeConfig{}, fmt.Errorf("user %s authenticates with an auth provider plugin, which is not supported, use an exec credential plugin", user.Name)
+			}
+
+			if execConfig := user.User.Exec; execConfig != nil {
+				if execConfig.Command == "" || execConfig.APIVersion == "" {
+					return KubeConfig{}, fmt.Errorf("user %s has an exec credential plugin without command or apiVersion", user.Name)
+				}
+
+				if strings.ContainsRune(execConfig.Command, filepath.Separator) {
+					execConfig.Command = kubeconfigPath(execConfig.Command, dir)
+				}
+
+				config.Exec = execConfig
+			}
+
+			config.Token = user.User.Token
+			config.Username = user.User.Username
+			config.Password = user.User.Password
+
+			if config.Token == "" && user.User.TokenFile != "" {
+				token, err := ioutil.ReadFile(kubeconfigPath(user.User.TokenFile, dir))
+
+				if err != nil {
+					return KubeConfig{}, err
+				}
+
+				config.Token = strings.TrimSpace(string(token))
+			}
+
+			cert, err := kubeconfigData(user.User.ClientCertificateData, user.User.ClientCertificate, dir)
+
+			if err != nil {
+				return KubeConfig{}, err
+			}
+
+			key, err := kubeconfigData(user.User.ClientKeyData, user.User.ClientKey, dir)
+
+			if err != nil {
+				return KubeConfig{}, err
+			}
+
+			if cert != nil || key != nil {
+				keyPair, err := tls.X509KeyPair(cert, key)
+
+				if err != nil {
+					return KubeConfig{}, err
+				}
+
+				config.TLSConfig.Certificates = []tls.Certificate{keyPair}
+			}
+		}
+	}
+
+	if !contextFound {
+		return KubeConfig{}, fmt.Errorf("current context %q not found", file.CurrentContext)
+	}
+
+	if config.Server == "" {
+		return KubeConfig{}, errors.New("no server for the cluster of the current context")
+	}
+
+	if config.Exec != nil {
+		config.Exec.certificateAuthorityData = clusterCA
+	}
+
+	return config, nil
+}
+
+// ExecCredentials runs the exec credential plugin of config, if any, and
+// returns config with the token or client certificate the plugin printed.
+func ExecCredentials(config KubeConfig, timeout time.Duration) (KubeConfig, error) {
+	execConfig := config.Exec
+
+	if execConfig == nil {
+		return config, nil
+	}
+
+	request := kubeExecCredential{APIVersion: execConfig.APIVersion, Kind: kubeExecCredentialKind}
+
+	if execConfig.ProvideClusterInfo {
+		request.Spec.Cluster = &kubeExecCluster{
+			Server:                   config.Server,
+			CertificateAuthorityData: execConfig.certificateAuthorityData,
+			InsecureSkipTLSVerify:    config.TLSConfig != nil && config.TLSConfig.InsecureSkipVerify,
+		}
+	}
+
+	execInfo, err := json.Marshal(request)
+
+	if err != nil {
+		return config, err
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stdout bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, execConfig.Command, execConfig.Args...)
+	cmd.Env = append(os.Environ(), "KUBERNETES_EXEC_INFO="+string(execInfo))
+	for _, env := range execConfig.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return config, fmt.Errorf("exec credential plugin %s failed: %v", execConfig.Command, err)
+	}
+
+	var credential kubeExecCredential
+	if err := json.Unmarshal(stdout.Bytes(), &credential); err != nil {
+		return config, fmt.Errorf("failed to decode the ExecCredential of exec credential plugin %s: %v", execConfig.Command, err)
+	}
+
+	if credential.Kind != kubeExecCredentialKind {
+		return config, fmt.Errorf("exec credential plugin %s printed a %q rather than an ExecCredential", execConfig.Command, credential.Kind)
+	}
+
+	if credential.APIVersion != execConfig.APIVersion {
+		return config, fmt.Errorf("exec credential plugin %s printed an ExecCredential of %s, expected %s", execConfig.Command, credential.APIVersion, execConfig.APIVersion)
+	}
+
+	if credential.Status == nil {
+		return config, fmt.Errorf("exec credential plugin %s printed no credentials", execConfig.Command)
+	}
+
+	config.Token = credential.Status.Token
+
+	if credential.Status.ClientCertificateData != "" || credential.Status.ClientKeyData != "" {
+		keyPair, err := tls.X509KeyPair([]byte(credential.Status.ClientCertificateData), []byte(credential.Status.ClientKeyData))
+
+		if err != nil {
+			return config, fmt.Errorf("exec credential plugin %s printed an invalid client certificate: %v", execConfig.Command, err)
+		}
+
+		if config.TLSConfig == nil {
+			config.TLSConfig = &tls.Config{}
+		}
+
+		config.TLSConfig = config.TLSConfig.Clone()
+		config.TLSConfig.Certificates = []tls.Certificate{keyPair}
+	}
+
+	return config, nil
+}
+
+// kubeconfigData returns the base64 encoded data, or else the content of
+// the file, if any.
+func kubeconfigData(data string, file string, dir string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+
+	if file != "" {
+		return ioutil.ReadFile(kubeconfigPath(file, dir))
+	}
+
+	return nil, nil
+}
+
+func kubeconfigPath(path string, dir string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(dir, path)
+}
+
+// KubeDiscoveryOptions configures the discovery of the pods or services to
+// scrape.
+type KubeDiscoveryOptions struct {
+	// Role is KubePods or KubeServices.
+	Role string
+	// Namespace is the namespace of the pods or services, the namespace of
+	// the configuration, or default, if empty.
+	Namespace string
+	// Selector is a label selector of the pods or services, e.g.
+	// app=node-exporter.
+	Selector string
+	Timeout  time.Duration
+}
+
+type kubeObjectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type kubePodList struct {
+	Items []struct {
+		Metadata kubeObjectMeta `json:"metadata"`
+		Spec     struct {
+			NodeName   string `json:"nodeName"`
+			Containers []struct {
+				Ports []struct {
+					ContainerPort int    `json:"containerPort"`
+					Protocol      string `json:"protocol"`
+				} `json:"ports"`
+			} `json:"containers"`
+		} `json:"spec"`
+		Status struct {
+			Phase string `json:"phase"`
+			PodIP string `json:"podIP"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+type kubeServiceList struct {
+	Items []struct {
+		Metadata kubeObjectMeta `json:"metadata"`
+		Spec     struct {
+			Ports []struct {
+				Port     int    `json:"port"`
+				Protocol string `json:"protocol"`
+			} `json:"ports"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// DiscoverKubernetesTargets lists the running pods, or the services, of
+// the options namespace and selector annotated with prometheus.io/scrape
+// "true", and returns the target groups of their metrics endpoints. The
+// port, path and scheme are those of the prometheus.io/port, path and
+// scheme annotations, by default the first TCP port, /metrics and http.
+// The samples are labeled with the namespace and the pod and node, or the
+// service.
+func DiscoverKubernetesTargets(config KubeConfig, options KubeDiscoveryOptions) ([]TargetGroup, error) {
+	namespace := options.Namespace
+	if namespace == "" {
+		namespace = config.Namespace
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	var resource string
+	switch options.Role {
+	case KubePods:
+		resource = "pods"
+	case KubeServices:
+		resource = "services"
+	default:
+		return nil, fmt.Errorf("unknown Kubernetes discovery role %q, expected pod or service", options.Role)
+	}
+
+	listURL := strings.TrimSuffix(config.Server, "/") + "/api/v1/namespaces/" + url.PathEscape(namespace) + "/" + resource
+	if options.Selector != "" {
+		listURL += "?labelSelector=" + url.QueryEscape(options.Selector)
+	}
+
+	var groups []TargetGroup
+
+	if options.Role == KubePods {
+		var pods kubePodList
+
+		if err := kubeGet(config, listURL, options.Timeout, &pods); err != nil {
+			return nil, err
+		}
+
+		for _, pod := range pods.Items {
+			if pod.Status.Phase != "Running" || pod.Status.PodIP == "" {
+				continue
+			}
+
+			var port int
+			for _, container := range pod.Spec.Containers {
+				for _, containerPort := range container.Ports {
+					if port == 0 && (containerPort.Protocol == "" || containerPort.Protocol == "TCP") {
+						port = containerPort.ContainerPort
+					}
+				}
+			}
+
+			group, ok := kubeTargetGroup(pod.Metadata, pod.Status.PodIP, port)
+
+			if ok {
+				group.Labels["pod"] = pod.Metadata.Name
+				group.Labels["node"] = pod.Spec.NodeName
+				groups = append(groups, group)
+			}
+		}
+	} else {
+		var services kubeServiceList
+
+		if err := kubeGet(config, listURL, options.Timeout, &services); err != nil {
+			return nil, err
+		}
+
+		for _, service := range services.Items {
+			var port int
+			for _, servicePort := range service.Spec.Ports {
+				if port == 0 && (servicePort.Protocol == "" || servicePort.Protocol == "TCP") {
+					port = servicePort.Port
+				}
+			}
+
+			group, ok := kubeTargetGroup(service.Metadata, service.Metadata.Name+"."+service.Metadata.Namespace+".svc", port)
+
+			if ok {
+				group.Labels["service"] = service.Metadata.Name
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// kubeTargetGroup returns the target group of a pod or service annotated
+// to be scraped.
+func kubeTargetGroup(metadata kubeObjectMeta, host string, port int) (TargetGroup, bool) {
+	annotations := metadata.Annotations
+
+	if annotations[kubeScrapeAnnotation] != "true" {
+		return TargetGroup{}, false
+	}
+
+	if annotated, err := strconv.Atoi(annotations[kubePortAnnotation]); err == nil {
+		port = annotated
+	}
+
+	if port == 0 {
+		return TargetGroup{}, false
+	}
+
+	labels := map[string]string{"namespace": metadata.Namespace}
+
+	if path := annotations[kubePathAnnotation]; path != "" {
+		labels[metricsPathLabel] = path
+	}
+
+	if scheme := annotations[kubeSchemeAnnotation]; scheme != "" {
+		labels[schemeLabel] = scheme
+	}
+
+	return TargetGroup{Targets: []string{net.JoinHostPort(host, strconv.Itoa(port))}, Labels: labels}, true
+}
+
+func kubeGet(config KubeConfig, listURL string, timeout time.Duration, v interface{}) error {
+	config, err := ExecCredentials(config, timeout)
+
+	if err != nil {
+		return &FailureError{Class: FailureAuth, Err: err}
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config.TLSConfig,
+		},
+		Timeout: timeout,
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequest("GET", listURL, nil)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Token)
+	} else if config.Username != "" {
+		req.SetBasicAuth(config.Username, config.Password)
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return &FailureError{Class: FailureUnreachable, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := errors.New("kubernetes API returned non 2xx HTTP response status: " + resp.Status + ": " + strings.TrimSpace(string(respBody)))
+
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return &FailureError{Class: FailureAuth, Err: err}
+		}
+
+		return &FailureError{Class: FailureUnreachable, Err: err}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return &FailureError{Class: FailureParse, Err: fmt.Errorf("failed to decode Kubernetes API response: %v", err)}
+	}
+
+	return nil
+}
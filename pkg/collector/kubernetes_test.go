@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKubeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("file-token\n"), 0600))
+
+	config, err := ParseKubeConfig([]byte(`
+apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: dev
+  cluster:
+    server: https://dev:6443
+- name: prod
+  cluster:
+    server: https://prod:6443
+    insecure-skip-tls-verify: true
+contexts:
+- name: dev
+  context: {cluster: dev, user: dev}
+- name: prod
+  context: {cluster: prod, user: collector, namespace: monitoring}
+users:
+- name: dev
+  user: {token: dev-token}
+- name: collector
+  user: {tokenFile: token}
+`), dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://prod:6443", config.Server)
+	assert.Equal(t, "file-token", config.Token)
+	assert.Equal(t, "monitoring", config.Namespace)
+	assert.True(t, config.TLSConfig.InsecureSkipVerify)
+
+	_, err = ParseKubeConfig([]byte("current-context: missing\n"), dir)
+	assert.EqualError(t, err, `current context "missing" not found`)
+
+	_, err = ParseKubeConfig([]byte(`
+current-context: gke
+clusters: [{name: gke, cluster: {server: "https://gke"}}]
+contexts: [{name: gke, context: {cluster: gke, user: gke}}]
+users: [{name: gke, user: {auth-provider: {name: gcp}}}]
+`), dir)
+	assert.EqualError(t, err, "user gke authenticates with an auth provider plugin, which is not supported, use an exec credential plugin")
+}
+
+func TestKubeExecCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "auth-plugin"), []byte(`#!/bin/sh
+echo "$KUBERNETES_EXEC_INFO" > "$(dirname "$0")/exec-info"
+echo '{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","status":{"token":"'"$1-$CLUSTER"'"}}'
+`), 0700))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer exec-token-prod", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"items":[]}`))
+	}))
+	defer server.Close()
+
+	config, err := ParseKubeConfig([]byte(`
+current-context: prod
+clusters: [{name: prod, cluster: {server: "`+server.URL+`"}}]
+contexts: [{name: prod, context: {cluster: prod, user: prod}}]
+users:
+- name: prod
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1
+      command: ./auth-plugin
+      args: [exec-token]
+      env: [{name: CLUSTER, value: prod}]
+      provideClusterInfo: true
+`), dir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "auth-plugin"), config.Exec.Command)
+
+	_, err = DiscoverKubernetesTargets(config, KubeDiscoveryOptions{Role: KubePods, Timeout: time.Second})
+	assert.NoError(t, err)
+
+	execInfo, err := ioutil.ReadFile(filepath.Join(dir, "exec-info"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","spec":{"interactive":false,"cluster":{"server":"`+server.URL+`"}}}`, string(execInfo))
+
+	config.Exec.APIVersion = "client.authentication.k8s.io/v1beta1"
+	_, err = DiscoverKubernetesTargets(config, KubeDiscoveryOptions{Role: KubePods, Timeout: time.Second})
+	assert.EqualError(t, err, "exec credential plugin "+config.Exec.Command+" printed an ExecCredential of client.authentication.k8s.io/v1, expected client.authentication.k8s.io/v1beta1")
+
+	var failure *FailureError
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureAuth, failure.Class)
+}
+
+func TestDiscoverKubernetesTargets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "app=exporter", r.URL.Query().Get("labelSelector"))
+
+		switch r.URL.Path {
+		case "/api/v1/namespaces/monitoring/pods":
+			w.Write([]byte(`{"items":[
+				{"metadata":{"name":"a","namespace":"monitoring","annotations":{"prometheus.io/scrape":"true"}},
+				 "spec":{"nodeName":"node1","containers":[{"ports":[{"containerPort":53,"protocol":"UDP"},{"containerPort":9100,"protocol":"TCP"}]}]},
+				 "status":{"phase":"Running","podIP":"10.0.0.1"}},
+				{"metadata":{"name":"b","namespace":"monitoring","annotations":{"prometheus.io/scrape":"true","prometheus.io/port":"8080","prometheus.io/path":"/stats","prometheus.io/scheme":"https"}},
+				 "spec":{"nodeName":"node2","containers":[]},
+				 "status":{"phase":"Running","podIP":"10.0.0.2"}},
+				{"metadata":{"name":"c","namespace":"monitoring","annotations":{"prometheus.io/scrape":"true"}},
+				 "spec":{"containers":[{"ports":[{"containerPort":9100}]}]},
+				 "status":{"phase":"Pending"}},
+				{"metadata":{"name":"d","namespace":"monitoring"},
+				 "spec":{"containers":[{"ports":[{"containerPort":9100}]}]},
+				 "status":{"phase":"Running","podIP":"10.0.0.4"}}
+			]}`))
+		case "/api/v1/namespaces/monitoring/services":
+			w.Write([]byte(`{"items":[
+				{"metadata":{"name":"exporter","namespace":"monitoring","annotations":{"prometheus.io/scrape":"true"}},
+				 "spec":{"ports":[{"port":9100,"protocol":"TCP"}]}}
+			]}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	config := KubeConfig{Server: server.URL, Token: "token", Namespace: "monitoring"}
+
+	groups, err := DiscoverKubernetesTargets(config, KubeDiscoveryOptions{Role: KubePods, Selector: "app=exporter", Timeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, []TargetGroup{
+		{Targets: []string{"10.0.0.1:9100"}, Labels: map[string]string{"namespace": "monitoring", "pod": "a", "node": "node1"}},
+		{Targets: []string{"10.0.0.2:8080"}, Labels: map[string]string{"namespace": "monitoring", "pod": "b", "node": "node2", "__metrics_path__": "/stats", "__scheme__": "https"}},
+	}, groups)
+
+	groups, err = DiscoverKubernetesTargets(config, KubeDiscoveryOptions{Role: KubeServices, Selector: "app=exporter", Timeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, []TargetGroup{
+		{Targets: []string{"exporter.monitoring.svc:9100"}, Labels: map[string]string{"namespace": "monitoring", "service": "exporter"}},
+	}, groups)
+
+	_, err = DiscoverKubernetesTargets(config, KubeDiscoveryOptions{Role: KubePods, Namespace: "kube-system", Selector: "app=exporter", Timeout: time.Second})
+	assert.Error(t, err)
+
+	targets, err := GroupTargets([]TargetGroup{groups[0]})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://exporter.monitoring.svc:9100/metrics", targets[0].URL)
+}
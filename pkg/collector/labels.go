@@ -0,0 +1,186 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// AddLabel returns the samples with a label, except those that already
+// have it. The samples that change are copied.
+func AddLabel(samples model.Vector, name model.LabelName, value model.LabelValue) model.Vector {
+	labeled := make(model.Vector, 0, len(samples))
+
+	for _, sample := range samples {
+		if _, ok := sample.Metric[name]; !ok {
+			copied := *sample
+			copied.Metric = sample.Metric.Clone()
+			copied.Metric[name] = value
+			sample = &copied
+		}
+
+		labeled = append(labeled, sample)
+	}
+
+	return labeled
+}
+
+// labelMatcherOperators are the PromQL label matcher operators, =~ before
+// = so it is not taken for an = matcher.
+var labelMatcherOperators = []string{"=~", "!~", "!=", "="}
+
+// LabelMatcher matches a label value like a PromQL label matcher, name=value,
+// name!=value, name=~regex or name!~regex. Regexes are anchored at both ends
+// and a missing label has an empty value.
+type LabelMatcher struct {
+	Name     model.LabelName
+	Operator string
+	Value    string
+	re       *regexp.Regexp
+}
+
+// ParseLabelMatcher parses a label matcher, e.g. job="node" or cpu=~"0|1".
+// The value may be a double quoted or backquoted Go string, or unquoted.
+func ParseLabelMatcher(matcher string) (*LabelMatcher, error) {
+	i := strings.IndexAny(matcher, "=!")
+
+	for _, operator := range labelMatcherOperators {
+		if i < 0 || !strings.HasPrefix(matcher[i:], operator) {
+			continue
+		}
+
+		m := &LabelMatcher{
+			Name:     model.LabelName(strings.TrimSpace(matcher[:i])),
+			Operator: operator,
+			Value:    strings.TrimSpace(matcher[i+len(operator):]),
+		}
+
+		if !m.Name.IsValid() {
+			return nil, fmt.Errorf("invalid label matcher %q, invalid label name %q", matcher, m.Name)
+		}
+
+		if strings.HasPrefix(m.Value, `"`) || strings.HasPrefix(m.Value, "`") {
+			value, err := strconv.Unquote(m.Value)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid label matcher %q, invalid quoted value %s", matcher, m.Value)
+			}
+
+			m.Value = value
+		}
+
+		if operator == "=~" || operator == "!~" {
+			re, err := regexp.Compile("^(?:" + m.Value + ")$")
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid label matcher %q: %v", matcher, err)
+			}
+
+			m.re = re
+		}
+
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("invalid label matcher %q, expected <label><=|!=|=~|!~><value>", matcher)
+}
+
+// Matches returns whether the label of metric matches.
+func (m *LabelMatcher) Matches(metric model.Metric) bool {
+	value := string(metric[m.Name])
+
+	switch m.Operator {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~":
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+// ParseLabelMatchers parses label matchers, see ParseLabelMatcher.
+func ParseLabelMatchers(matchers []string) ([]*LabelMatcher, error) {
+	var parsed []*LabelMatcher
+
+	for _, matcher := range matchers {
+		m, err := ParseLabelMatcher(matcher)
+
+		if err != nil {
+			return nil, err
+		}
+
+		parsed = append(parsed, m)
+	}
+
+	return parsed, nil
+}
+
+// FilterLabelMatchers keeps the samples matching every label matcher.
+func FilterLabelMatchers(samples model.Vector, matchers []*LabelMatcher) model.Vector {
+	var filteredSamples model.Vector
+
+	for _, sample := range samples {
+		matches := true
+
+		for _, m := range matchers {
+			if !m.Matches(sample.Metric) {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			filteredSamples = append(filteredSamples, sample)
+		}
+	}
+
+	return filteredSamples
+}
+
+// ProjectLabels returns the samples with only the keep labels, when any are
+// given, and without the drop labels. The metric name is always kept. The
+// samples whose labels change are copied.
+func ProjectLabels(samples model.Vector, keep []string, drop []string) model.Vector {
+	keepNames := map[model.LabelName]bool{model.MetricNameLabel: true}
+	for _, name := range keep {
+		keepNames[model.LabelName(name)] = true
+	}
+
+	dropNames := map[model.LabelName]bool{}
+	for _, name := range drop {
+		if name != model.MetricNameLabel {
+			dropNames[model.LabelName(name)] = true
+		}
+	}
+
+	projected := make(model.Vector, 0, len(samples))
+
+	for _, sample := range samples {
+		var metric model.Metric
+
+		for name := range sample.Metric {
+			if (len(keep) > 0 && !keepNames[name]) || dropNames[name] {
+				if metric == nil {
+					metric = sample.Metric.Clone()
+				}
+				delete(metric, name)
+			}
+		}
+
+		if metric != nil {
+			copied := *sample
+			copied.Metric = metric
+			sample = &copied
+		}
+
+		projected = append(projected, sample)
+	}
+
+	return projected
+}
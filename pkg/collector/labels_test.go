@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectLabels(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "container_cpu_usage_seconds_total", "namespace": "default", "pod": "web-1", "pod_uid": "4f1c", "id": "/kubepods/4f1c"}, Value: 1},
+		{Metric: model.Metric{model.MetricNameLabel: "up"}, Value: 1},
+	}
+
+	dropped := ProjectLabels(samples, nil, []string{"pod_uid", "id", model.MetricNameLabel})
+	assert.Equal(t, model.Metric{model.MetricNameLabel: "container_cpu_usage_seconds_total", "namespace": "default", "pod": "web-1"}, dropped[0].Metric)
+	assert.Equal(t, samples[1], dropped[1])
+
+	kept := ProjectLabels(samples, []string{"namespace", "pod"}, []string{"pod"})
+	assert.Equal(t, model.Metric{model.MetricNameLabel: "container_cpu_usage_seconds_total", "namespace": "default"}, kept[0].Metric)
+	assert.Equal(t, samples[1], kept[1])
+
+	// The samples are copied, not modified.
+	assert.Len(t, samples[0].Metric, 5)
+}
+
+func TestParseLabelMatcher(t *testing.T) {
+	m, err := ParseLabelMatcher(`cpu=~"0|1"`)
+	assert.NoError(t, err)
+	assert.Equal(t, model.LabelName("cpu"), m.Name)
+	assert.Equal(t, "=~", m.Operator)
+	assert.Equal(t, "0|1", m.Value)
+
+	m, err = ParseLabelMatcher("job = node")
+	assert.NoError(t, err)
+	assert.Equal(t, "=", m.Operator)
+	assert.Equal(t, "node", m.Value)
+
+	// Operators in the value are part of the value.
+	m, err = ParseLabelMatcher(`path!="a=b!=c"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "!=", m.Operator)
+	assert.Equal(t, "a=b!=c", m.Value)
+
+	for _, matcher := range []string{"job", "1job=node", `job="node`, "cpu=~(", "=node"} {
+		_, err := ParseLabelMatcher(matcher)
+		assert.Error(t, err, matcher)
+	}
+}
+
+func TestFilterLabelMatchers(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "node_cpu_seconds_total", "cpu": "0", "mode": "idle"}},
+		{Metric: model.Metric{model.MetricNameLabel: "node_cpu_seconds_total", "cpu": "10", "mode": "idle"}},
+		{Metric: model.Metric{model.MetricNameLabel: "node_cpu_seconds_total", "cpu": "1", "mode": "user"}},
+		{Metric: model.Metric{model.MetricNameLabel: "node_load1"}},
+	}
+
+	matchers, err := ParseLabelMatchers([]string{`cpu=~"0|1"`, "mode!=user"})
+	assert.NoError(t, err)
+	assert.Equal(t, model.Vector{samples[0]}, FilterLabelMatchers(samples, matchers))
+
+	// A missing label has an empty value.
+	matchers, err = ParseLabelMatchers([]string{`cpu=""`})
+	assert.NoError(t, err)
+	assert.Equal(t, model.Vector{samples[3]}, FilterLabelMatchers(samples, matchers))
+
+	matchers, err = ParseLabelMatchers([]string{"__name__!~node_cpu_.*"})
+	assert.NoError(t, err)
+	assert.Equal(t, model.Vector{samples[3]}, FilterLabelMatchers(samples, matchers))
+}
+
+func TestAddLabel(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "node_load1"}, Value: 0.5},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "host": "db-1"}, Value: 1},
+	}
+
+	labeled := AddLabel(samples, "host", "web-1")
+
+	assert.Equal(t, model.Metric{model.MetricNameLabel: "node_load1", "host": "web-1"}, labeled[0].Metric)
+	assert.Equal(t, samples[1], labeled[1])
+	assert.Len(t, samples[0].Metric, 1)
+}
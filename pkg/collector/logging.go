@@ -0,0 +1,168 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// LogLevel is the verbosity of the diagnostic logs, which are written to
+// stderr so stdout only carries the metrics output.
+type LogLevel int
+
+// Log levels, from the least to the most verbose. Errors are always
+// logged.
+const (
+	LogError LogLevel = iota
+	LogWarn
+	LogInfo
+	LogDebug
+)
+
+// logLevelNames are the -log-level names of the log levels.
+var logLevelNames = map[LogLevel]string{
+	LogError: "error",
+	LogWarn:  "warn",
+	LogInfo:  "info",
+	LogDebug: "debug",
+}
+
+// logLevel is the verbosity of the logs, set with -log-level or -v.
+var logLevel = LogInfo
+
+// ParseLogLevel parses a log level name, error, warn, info or debug.
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+
+	return LogInfo, fmt.Errorf("unknown log level %q, expected error, warn, info or debug", name)
+}
+
+// String returns the name of the log level.
+func (l LogLevel) String() string {
+	return logLevelNames[l]
+}
+
+// SetLogLevel sets the verbosity of the logs.
+func SetLogLevel(level LogLevel) {
+	logLevel = level
+}
+
+// LogEnabled returns whether messages of level are logged.
+func LogEnabled(level LogLevel) bool {
+	return level <= logLevel
+}
+
+// LogFields are the fields of a structured log entry, e.g. the target,
+// duration and number of samples of a scrape.
+type LogFields map[string]interface{}
+
+// jsonLogOutput is where JSON log entries are written, nil when logs are
+// written as text.
+var jsonLogOutput io.Writer
+
+// SetLogFormat sets the format of the logs written to w, text or json.
+// JSON logs are an object per line with the time, level, msg and the
+// fields of the entry. Messages logged with the log package, the errors
+// the collector exits on, are error level entries.
+func SetLogFormat(format string, w io.Writer) error {
+	switch format {
+	case "text":
+		jsonLogOutput = nil
+		log.SetFlags(log.LstdFlags)
+		log.SetOutput(w)
+	case "json":
+		jsonLogOutput = w
+		log.SetFlags(0)
+		log.SetOutput(jsonLogWriter{})
+	default:
+		return fmt.Errorf("unknown log format %q, expected text or json", format)
+	}
+
+	return nil
+}
+
+// jsonLogWriter writes the messages of the log package as error level
+// JSON log entries.
+type jsonLogWriter struct{}
+
+func (jsonLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimPrefix(strings.TrimSuffix(string(p), "\n"), "Error: ")
+	writeJSONLog(LogError, nil, msg)
+	return len(p), nil
+}
+
+// writeJSONLog writes a JSON log entry to jsonLogOutput.
+func writeJSONLog(level LogLevel, fields LogFields, msg string) {
+	entry := make(map[string]interface{}, len(fields)+3)
+	for name, value := range fields {
+		if d, ok := value.(time.Duration); ok {
+			value = d.Seconds()
+		}
+		entry[name] = value
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+
+	line, err := json.Marshal(entry)
+
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{"level": level.String(), "msg": msg})
+	}
+
+	jsonLogOutput.Write(append(line, '\n'))
+}
+
+// logf logs a message of level, prefixed with the level name, with the
+// fields of JSON logs, when the level is enabled.
+func (f LogFields) logf(level LogLevel, format string, args ...interface{}) {
+	if !LogEnabled(level) {
+		return
+	}
+
+	msg := fmt.Sprintf(format, args...)
+
+	if jsonLogOutput != nil {
+		writeJSONLog(level, f, msg)
+		return
+	}
+
+	log.Output(3, level.String()+": "+msg)
+}
+
+// Debugf logs a debug message with the fields.
+func (f LogFields) Debugf(format string, args ...interface{}) {
+	f.logf(LogDebug, format, args...)
+}
+
+// Infof logs an informational message with the fields.
+func (f LogFields) Infof(format string, args ...interface{}) {
+	f.logf(LogInfo, format, args...)
+}
+
+// Warnf logs a warning with the fields.
+func (f LogFields) Warnf(format string, args ...interface{}) {
+	f.logf(LogWarn, format, args...)
+}
+
+// Debugf logs a debug message, e.g. a request URL or a sample count.
+func Debugf(format string, args ...interface{}) {
+	LogFields(nil).logf(LogDebug, format, args...)
+}
+
+// Infof logs an informational message, e.g. the result of a dry run.
+func Infof(format string, args ...interface{}) {
+	LogFields(nil).logf(LogInfo, format, args...)
+}
+
+// Warnf logs a warning, e.g. of a retried request.
+func Warnf(format string, args ...interface{}) {
+	LogFields(nil).logf(LogWarn, format, args...)
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := ParseLogLevel("DEBUG")
+	assert.NoError(t, err)
+	assert.Equal(t, LogDebug, level)
+
+	_, err = ParseLogLevel("trace")
+	assert.EqualError(t, err, `unknown log level "trace", expected error, warn, info or debug`)
+}
+
+func TestLogLevels(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	defer SetLogLevel(LogInfo)
+
+	SetLogLevel(LogError)
+	Warnf("retrying")
+	assert.Empty(t, logged.String())
+
+	SetLogLevel(LogDebug)
+	Debugf("Scraping %s", "http://localhost:9100/metrics")
+	assert.Contains(t, logged.String(), "debug: Scraping http://localhost:9100/metrics")
+}
+
+func TestJSONLogs(t *testing.T) {
+	var logged bytes.Buffer
+	assert.NoError(t, SetLogFormat("json", &logged))
+	defer SetLogFormat("text", os.Stderr)
+	defer SetLogLevel(LogInfo)
+	SetLogLevel(LogDebug)
+
+	LogFields{"target": "http://localhost:9100/metrics", "duration": 1500 * time.Millisecond, "samples": 3}.Debugf("Scraped %d samples", 3)
+	log.Println("Error: Unknown output format")
+
+	lines := bytes.Split(bytes.TrimSpace(logged.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 2)
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(lines[0], &entry))
+	assert.Equal(t, "debug", entry["level"])
+	assert.Equal(t, "Scraped 3 samples", entry["msg"])
+	assert.Equal(t, "http://localhost:9100/metrics", entry["target"])
+	assert.Equal(t, 1.5, entry["duration"])
+	assert.Equal(t, 3.0, entry["samples"])
+	assert.NotEmpty(t, entry["time"])
+
+	entry = nil
+	assert.NoError(t, json.Unmarshal(lines[1], &entry))
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, "Unknown output format", entry["msg"])
+
+	assert.EqualError(t, SetLogFormat("logfmt", &logged), `unknown log format "logfmt", expected text or json`)
+}
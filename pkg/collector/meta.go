@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// The names of the -meta-metrics samples.
+const (
+	ScrapeDurationMetric  = "collector_scrape_duration_seconds"
+	SamplesScrapedMetric  = "collector_samples_scraped"
+	SamplesFilteredMetric = "collector_samples_filtered"
+)
+
+// MetaMetrics describe a run of the collector: how long the targets took to
+// scrape or query, how many samples they returned and how many of them the
+// filters dropped.
+type MetaMetrics struct {
+	ScrapeDuration  time.Duration
+	SamplesScraped  int
+	SamplesFiltered int
+}
+
+// Samples returns the gauge samples of the meta metrics.
+func (m MetaMetrics) Samples(timestamp model.Time) model.Vector {
+	sample := func(name string, value float64) *model.Sample {
+		return &model.Sample{
+			Metric:    model.Metric{model.MetricNameLabel: model.LabelValue(name)},
+			Value:     model.SampleValue(value),
+			Timestamp: timestamp,
+		}
+	}
+
+	return model.Vector{
+		sample(ScrapeDurationMetric, m.ScrapeDuration.Seconds()),
+		sample(SamplesScrapedMetric, float64(m.SamplesScraped)),
+		sample(SamplesFilteredMetric, float64(m.SamplesFiltered)),
+	}
+}
@@ -0,0 +1,19 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetaMetrics(t *testing.T) {
+	meta := MetaMetrics{ScrapeDuration: 1500 * time.Millisecond, SamplesScraped: 12, SamplesFiltered: 4}
+
+	samples := meta.Samples(1506991200000)
+
+	assert.Equal(t, 3, len(samples))
+	assert.Equal(t, "collector_scrape_duration_seconds => 1.5 @[1506991200]", samples[0].String())
+	assert.Equal(t, "collector_samples_scraped => 12 @[1506991200]", samples[1].String())
+	assert.Equal(t, "collector_samples_filtered => 4 @[1506991200]", samples[2].String())
+}
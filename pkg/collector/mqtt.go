@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/prometheus/common/model"
+)
+
+// MQTTConfig configures the sendtomqtt output.
+type MQTTConfig struct {
+	// URL is the broker URL, tcp://host:port, ssl://host:port or
+	// ws://host:port.
+	URL string
+	// TopicTemplate is the topic of the samples, filled in by MQTTTopic.
+	TopicTemplate string
+	// Format is the output format of the published messages.
+	Format   string
+	QoS      byte
+	Retain   bool
+	ClientID string
+	Username string
+	Password string
+	// Host fills in the {host} placeholder of TopicTemplate.
+	Host      string
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+}
+
+// mqttTopicReplacer replaces the characters that would split a label
+// value into topic levels or be taken for wildcards.
+var mqttTopicReplacer = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// MQTTTopic fills in the {label} placeholders of template with the sample
+// labels, {name} with the prefixed metric name and {host} with host.
+func MQTTTopic(template string, metric model.Metric, metricPrefix string, host string) string {
+	return fillTemplate(template, metric, metricPrefix, host, mqttTopicReplacer)
+}
+
+// SendToMQTT publishes samples to the MQTT broker, a message per topic
+// with its samples formatted in config.MQTT.Format.
+func SendToMQTT(samples model.Vector, config OutputConfig) error {
+	mqttConfig := config.MQTT
+
+	if mqttConfig.TopicTemplate == "" {
+		return errors.New("an MQTT topic is required")
+	}
+
+	formatConfig := config
+	formatConfig.Format = mqttConfig.Format
+
+	if _, ok := FormatMetrics(nil, formatConfig); !ok {
+		return fmt.Errorf("unknown MQTT message format %q", mqttConfig.Format)
+	}
+
+	topicSamples := map[string]model.Vector{}
+	for _, sample := range samples {
+		topic := MQTTTopic(mqttConfig.TopicTemplate, sample.Metric, config.MetricPrefix, mqttConfig.Host)
+		topicSamples[topic] = append(topicSamples[topic], sample)
+	}
+
+	topics := make([]string, 0, len(topicSamples))
+	for topic := range topicSamples {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	options := mqtt.NewClientOptions().
+		AddBroker(mqttConfig.URL).
+		SetClientID(mqttConfig.ClientID).
+		SetUsername(mqttConfig.Username).
+		SetPassword(mqttConfig.Password).
+		SetConnectTimeout(mqttConfig.Timeout).
+		SetWriteTimeout(mqttConfig.Timeout).
+		SetAutoReconnect(false)
+
+	if mqttConfig.TLSConfig != nil {
+		options.SetTLSConfig(mqttConfig.TLSConfig)
+	}
+
+	client := mqtt.NewClient(options)
+
+	if err := waitMQTT(client.Connect(), mqttConfig.Timeout); err != nil {
+		return err
+	}
+	defer client.Disconnect(uint(mqttConfig.Timeout / time.Millisecond))
+
+	for _, topic := range topics {
+		message, _ := FormatMetrics(topicSamples[topic], formatConfig)
+
+		if err := waitMQTT(client.Publish(topic, mqttConfig.QoS, mqttConfig.Retain, message), mqttConfig.Timeout); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func waitMQTT(token mqtt.Token, timeout time.Duration) error {
+	if !token.WaitTimeout(timeout) {
+		return errors.New("mqtt timed out waiting for the broker")
+	}
+
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("mqtt returned error: %v", err)
+	}
+
+	return nil
+}
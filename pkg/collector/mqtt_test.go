@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveMQTT accepts a connection on listener and plays an MQTT broker,
+// sending the topic and payload of the messages published to received.
+func serveMQTT(listener net.Listener) chan string {
+	received := make(chan string, 10)
+
+	go func() {
+		defer close(received)
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for {
+			header, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return
+			}
+
+			packet := make([]byte, length)
+			if _, err := io.ReadFull(r, packet); err != nil {
+				return
+			}
+
+			switch header >> 4 {
+			case 1: // CONNECT
+				conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+			case 3: // PUBLISH
+				topicLength := int(binary.BigEndian.Uint16(packet))
+				topic := string(packet[2 : 2+topicLength])
+				payload := packet[2+topicLength:]
+
+				if qos := (header >> 1) & 3; qos > 0 {
+					conn.Write([]byte{0x40, 0x02, payload[0], payload[1]})
+					payload = payload[2:]
+				}
+
+				received <- topic + " " + string(payload)
+			case 14: // DISCONNECT
+				return
+			}
+		}
+	}()
+
+	return received
+}
+
+func TestMQTTTopic(t *testing.T) {
+	metric := model.Metric{model.MetricNameLabel: "node_filesystem_avail_bytes", "mountpoint": "/var/lib", "device": "sda#1"}
+
+	assert.Equal(t, "metrics/server1/node.node_filesystem_avail_bytes/_var_lib", MQTTTopic("metrics/{host}/{name}/{mountpoint}", metric, "node.", "server1"))
+	assert.Equal(t, "metrics/sda_1/", MQTTTopic("metrics/{device}/{instance}", metric, "", "server1"))
+}
+
+func TestSendToMQTT(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	received := serveMQTT(listener)
+
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "foo", "instance": "a"}, Value: 1, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "bar", "instance": "b"}, Value: 2, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "baz", "instance": "a"}, Value: 3, Timestamp: model.Time(1506991233000)},
+	}
+
+	config := OutputConfig{
+		TimestampPrecision: "s",
+		MQTT: MQTTConfig{
+			URL:           "tcp://" + listener.Addr().String(),
+			TopicTemplate: "metrics/{host}/{instance}",
+			Format:        "graphite",
+			QoS:           1,
+			ClientID:      "test",
+			Host:          "server1",
+			Timeout:       time.Second,
+		},
+	}
+
+	assert.NoError(t, SendToMQTT(samples, config))
+	assert.Equal(t, "metrics/server1/a foo 1 1506991233\nbaz 3 1506991233\n", <-received)
+	assert.Equal(t, "metrics/server1/b bar 2 1506991233\n", <-received)
+}
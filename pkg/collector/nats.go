@@ -0,0 +1,155 @@
+package collector
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/common/model"
+)
+
+// NATSConfig configures the sendtonats output.
+type NATSConfig struct {
+	// URL is the NATS server URL, nats://[user:password@]host:port, or
+	// nats://token@host:port, tls:// connecting over TLS.
+	URL     string
+	Subject string
+	// Format is the output format of the published messages.
+	Format string
+	// BatchSize is the maximum number of samples per message.
+	BatchSize int
+	// JetStream waits for every message to be acknowledged by the
+	// JetStream stream of the subject.
+	JetStream bool
+	TLSConfig *tls.Config
+	// Timeout is the connection, flush and acknowledgement timeout, 0 for
+	// the defaults of the NATS client.
+	Timeout time.Duration
+}
+
+// NewNATSConn connects and authenticates to the NATS server in config. The
+// connection is not reconnected, so that the messages published after it is
+// lost fail rather than being buffered.
+func NewNATSConn(config NATSConfig) (*nats.Conn, error) {
+	options := []nats.Option{
+		nats.Name("sensu-prometheus-collector"),
+		nats.NoReconnect(),
+	}
+
+	if config.TLSConfig != nil {
+		// The TLS config is used if the URL is tls:// or the server
+		// requires TLS.
+		tlsConfig := config.TLSConfig
+		options = append(options, func(o *nats.Options) error {
+			o.TLSConfig = tlsConfig.Clone()
+			return nil
+		})
+	}
+
+	if config.Timeout > 0 {
+		options = append(options, nats.Timeout(config.Timeout))
+	}
+
+	return nats.Connect(config.URL, options...)
+}
+
+// natsPublisher publishes messages to a NATS subject, waiting for their
+// JetStream acknowledgements if enabled.
+type natsPublisher struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+	timeout time.Duration
+}
+
+func (p *natsPublisher) publish(data []byte) error {
+	if p.js == nil {
+		return p.conn.Publish(p.subject, data)
+	}
+
+	var options []nats.PubOpt
+	if p.timeout > 0 {
+		options = append(options, nats.AckWait(p.timeout))
+	}
+
+	_, err := p.js.Publish(p.subject, data, options...)
+
+	if err == nats.ErrTimeout {
+		return errors.New("nats timed out waiting for the JetStream acknowledgement, is there a stream for the subject?")
+	}
+
+	return err
+}
+
+// flush waits for the server to process the published messages and returns
+// the errors it returned for them, e.g. a permissions violation.
+func (p *natsPublisher) flush() error {
+	var err error
+
+	if p.timeout > 0 {
+		err = p.conn.FlushTimeout(p.timeout)
+	} else {
+		err = p.conn.Flush()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return p.conn.LastError()
+}
+
+// SendToNATS publishes samples, formatted in config.NATS.Format, to the
+// NATS subject in messages of up to config.NATS.BatchSize samples.
+func SendToNATS(samples model.Vector, config OutputConfig) error {
+	natsConfig := config.NATS
+
+	if natsConfig.Subject == "" {
+		return errors.New("a NATS subject is required")
+	}
+
+	formatConfig := config
+	formatConfig.Format = natsConfig.Format
+
+	if _, ok := FormatMetrics(nil, formatConfig); !ok {
+		return fmt.Errorf("unknown NATS message format %q", natsConfig.Format)
+	}
+
+	conn, err := NewNATSConn(natsConfig)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	publisher := &natsPublisher{conn: conn, subject: natsConfig.Subject, timeout: natsConfig.Timeout}
+
+	if natsConfig.JetStream {
+		if publisher.js, err = conn.JetStream(); err != nil {
+			return err
+		}
+	}
+
+	batchSize := natsConfig.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(samples)
+	}
+
+	for start := 0; start < len(samples); start += batchSize {
+		end := start + batchSize
+		if end > len(samples) {
+			end = len(samples)
+		}
+
+		message, _ := FormatMetrics(samples[start:end], formatConfig)
+
+		if err := publisher.publish([]byte(message)); err != nil {
+			return err
+		}
+	}
+
+	return publisher.flush()
+}
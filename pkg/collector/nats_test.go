@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveNATS accepts a connection on listener and plays a NATS server,
+// sending the messages published to received and acknowledging them with
+// ack when they have a reply subject, or returning pubErr for them.
+func serveNATS(listener net.Listener, ack string, pubErr string) chan string {
+	received := make(chan string, 10)
+
+	go func() {
+		defer close(received)
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		fmt.Fprint(conn, `INFO {"server_id":"test","max_payload":1048576}`+"\r\n")
+
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			fields := strings.Fields(line)
+			switch fields[0] {
+			case "CONNECT":
+				received <- strings.TrimSpace(line)
+			case "PING":
+				fmt.Fprint(conn, "PONG\r\n")
+			case "PUB":
+				size, _ := strconv.Atoi(fields[len(fields)-1])
+				payload := make([]byte, size+2)
+				io.ReadFull(r, payload)
+				received <- fields[1] + " " + string(payload[:size])
+
+				if pubErr != "" {
+					fmt.Fprintf(conn, "-ERR '%s'\r\n", pubErr)
+				} else if len(fields) == 4 {
+					fmt.Fprintf(conn, "MSG %s 1 %d\r\n%s\r\n", fields[2], len(ack), ack)
+				}
+			}
+		}
+	}()
+
+	return received
+}
+
+func TestSendToNATS(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	received := serveNATS(listener, "", "")
+
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "bar"}, Value: 2, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "baz"}, Value: 3, Timestamp: model.Time(1506991233000)},
+	}
+
+	config := OutputConfig{
+		TimestampPrecision: "s",
+		NATS: NATSConfig{
+			URL:       "nats://user:secret@" + listener.Addr().String(),
+			Subject:   "metrics",
+			Format:    "graphite",
+			BatchSize: 2,
+			Timeout:   time.Second,
+		},
+	}
+
+	assert.NoError(t, SendToNATS(samples, config))
+	assert.Contains(t, <-received, `"user":"user","pass":"secret"`)
+	assert.Equal(t, "metrics foo 1 1506991233\nbar 2 1506991233\n", <-received)
+	assert.Equal(t, "metrics baz 3 1506991233\n", <-received)
+}
+
+func TestSendToNATSJetStream(t *testing.T) {
+	samples := model.Vector{{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1, Timestamp: model.Time(1506991233000)}}
+
+	for ack, expectedErr := range map[string]string{
+		`{"stream":"METRICS","seq":1}`:                              "",
+		`{"error":{"code":503,"description":"stream unavailable"}}`: "nats: stream unavailable",
+	} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+
+		received := serveNATS(listener, ack, "")
+
+		config := OutputConfig{
+			TimestampPrecision: "s",
+			NATS: NATSConfig{
+				URL:       "nats://token@" + listener.Addr().String(),
+				Subject:   "metrics",
+				Format:    "graphite",
+				JetStream: true,
+				Timeout:   time.Second,
+			},
+		}
+
+		err = SendToNATS(samples, config)
+
+		if expectedErr == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, expectedErr)
+		}
+
+		assert.Contains(t, <-received, `"auth_token":"token"`)
+		assert.Equal(t, "metrics foo 1 1506991233\n", <-received)
+
+		listener.Close()
+	}
+}
+
+func TestSendToNATSPublishError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	received := serveNATS(listener, "", `Permissions Violation for Publish to "metrics"`)
+
+	samples := model.Vector{{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1, Timestamp: model.Time(1506991233000)}}
+
+	config := OutputConfig{
+		TimestampPrecision: "s",
+		NATS: NATSConfig{
+			URL:     "nats://" + listener.Addr().String(),
+			Subject: "metrics",
+			Format:  "graphite",
+		},
+	}
+
+	err = SendToNATS(samples, config)
+
+	assert.EqualError(t, err, `nats: Permissions Violation for Publish to "metrics"`)
+	<-received
+	assert.Equal(t, "metrics foo 1 1506991233\n", <-received)
+}
@@ -0,0 +1,198 @@
+package collector
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// oauth2TokenTimeout is the timeout of the token requests.
+	oauth2TokenTimeout = 10 * time.Second
+	// oauth2ExpiryDelta is how long before its expiry a token is refreshed,
+	// so it does not expire in flight.
+	oauth2ExpiryDelta = 10 * time.Second
+)
+
+// OAuth2Config configures the OAuth2 client credentials grant of the
+// tokens authenticating requests to metrics endpoints behind an OIDC
+// protected gateway.
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	TLSConfig    *tls.Config
+}
+
+// OAuth2TokenSource gets access tokens with the client credentials grant,
+// reusing a token until it expires.
+type OAuth2TokenSource struct {
+	config OAuth2Config
+	client *http.Client
+	now    func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewOAuth2TokenSource returns a token source of the client in config, the
+// first token is requested by the first Token call.
+func NewOAuth2TokenSource(config OAuth2Config) *OAuth2TokenSource {
+	return &OAuth2TokenSource{
+		config: config,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: config.TLSConfig,
+			},
+			Timeout: oauth2TokenTimeout,
+		},
+		now: time.Now,
+	}
+}
+
+// Token returns the current access token, requesting a new one when there
+// is none or it is about to expire.
+func (s *OAuth2TokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && (s.expiry.IsZero() || s.now().Before(s.expiry)) {
+		return s.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", s.config.ClientID)
+	form.Set("client_secret", s.config.ClientSecret)
+	if len(s.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+
+	req, err := http.NewRequest("POST", s.config.TokenURL, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	// Tokens are requested once per expiry, so the connection is not kept
+	// alive until the next request.
+	defer s.client.CloseIdleConnections()
+
+	resp, err := s.client.Do(req)
+
+	if err != nil {
+		return "", &FailureError{Class: FailureAuth, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", &FailureError{Class: FailureAuth, Err: errors.New("oauth2 token endpoint returned non 2xx HTTP response status: " + resp.Status + ": " + strings.TrimSpace(string(respBody)))}
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", &FailureError{Class: FailureAuth, Err: fmt.Errorf("failed to decode OAuth2 token: %v", err)}
+	}
+
+	if token.AccessToken == "" {
+		return "", &FailureError{Class: FailureAuth, Err: errors.New("oauth2 token endpoint returned no access token")}
+	}
+
+	s.token = token.AccessToken
+	s.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		s.expiry = s.now().Add(time.Duration(token.ExpiresIn)*time.Second - oauth2ExpiryDelta)
+	}
+
+	return s.token, nil
+}
+
+// Invalidate discards the current token, e.g. when it is rejected before
+// its expiry, so the next Token call requests a new one.
+func (s *OAuth2TokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token = ""
+}
+
+// OAuth2Transport authenticates requests with the bearer tokens of Source,
+// unless they already have an Authorization header. A request rejected
+// with 401 Unauthorized is retried once with a new token, if it has no
+// body or its body can be replayed.
+type OAuth2Transport struct {
+	Base   http.RoundTripper
+	Source *OAuth2TokenSource
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *OAuth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return t.Base.RoundTrip(req)
+	}
+
+	resp, err := t.roundTrip(req)
+
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	retry := req
+	if req.Body != nil {
+		body, err := req.GetBody()
+
+		if err != nil {
+			return resp, nil
+		}
+
+		retry = req.WithContext(req.Context())
+		retry.Body = body
+	}
+
+	resp.Body.Close()
+	t.Source.Invalidate()
+
+	return t.roundTrip(retry)
+}
+
+func (t *OAuth2Transport) roundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Source.Token()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTrippers must not modify the request, so the token is set on a
+	// copy.
+	authorized := req.WithContext(req.Context())
+	authorized.Header = make(http.Header, len(req.Header)+1)
+	for name, values := range req.Header {
+		authorized.Header[name] = values
+	}
+	authorized.Header.Set("Authorization", "Bearer "+token)
+
+	return t.Base.RoundTrip(authorized)
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newOAuth2TokenServer(t *testing.T, issued *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+
+		if r.PostForm.Get("client_id") != "collector" || r.PostForm.Get("client_secret") != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+
+		assert.Equal(t, "metrics:read openid", r.PostForm.Get("scope"))
+
+		*issued++
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":60}`, *issued)
+	}))
+}
+
+func TestOAuth2TokenSource(t *testing.T) {
+	issued := 0
+	server := newOAuth2TokenServer(t, &issued)
+	defer server.Close()
+
+	source := NewOAuth2TokenSource(OAuth2Config{TokenURL: server.URL, ClientID: "collector", ClientSecret: "s3cret", Scopes: []string{"metrics:read", "openid"}})
+	now := time.Unix(1600000000, 0)
+	source.now = func() time.Time { return now }
+
+	token, err := source.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+
+	now = now.Add(49 * time.Second)
+	token, err = source.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+
+	now = now.Add(time.Second)
+	token, err = source.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+
+	source.Invalidate()
+	token, err = source.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-3", token)
+
+	source = NewOAuth2TokenSource(OAuth2Config{TokenURL: server.URL, ClientID: "collector", ClientSecret: "wrong"})
+	_, err = source.Token()
+	var failure *FailureError
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureAuth, failure.Class)
+}
+
+func TestOAuth2Transport(t *testing.T) {
+	issued := 0
+	tokenServer := newOAuth2TokenServer(t, &issued)
+	defer tokenServer.Close()
+
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+
+		// The first token is revoked before its expiry.
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte("up 1\n"))
+	}))
+	defer server.Close()
+
+	source := NewOAuth2TokenSource(OAuth2Config{TokenURL: tokenServer.URL, ClientID: "collector", ClientSecret: "s3cret", Scopes: []string{"metrics:read", "openid"}})
+	client := &http.Client{Transport: &OAuth2Transport{Base: http.DefaultTransport, Source: source}}
+
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"Bearer token-1", "Bearer token-2"}, authorizations)
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Authorization", "Basic YWRtaW46cGFzcw==")
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Basic YWRtaW46cGFzcw==", authorizations[2])
+}
+
+func TestQueryExporterOAuth2(t *testing.T) {
+	issued := 0
+	tokenServer := newOAuth2TokenServer(t, &issued)
+	defer tokenServer.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token-1", r.Header.Get("Authorization"))
+		w.Write([]byte("up 1\n"))
+	}))
+	defer server.Close()
+
+	auth := ExporterAuth{OAuth2: NewOAuth2TokenSource(OAuth2Config{TokenURL: tokenServer.URL, ClientID: "collector", ClientSecret: "s3cret", Scopes: []string{"metrics:read", "openid"}})}
+
+	samples, err := QueryExporter(server.URL, auth, nil, ParseOptions{}, RequestOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+
+	auth = ExporterAuth{OAuth2: NewOAuth2TokenSource(OAuth2Config{TokenURL: tokenServer.URL, ClientID: "collector", ClientSecret: "wrong"})}
+
+	_, err = QueryExporter(server.URL, auth, nil, ParseOptions{}, RequestOptions{})
+	var failure *FailureError
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureAuth, failure.Class)
+}
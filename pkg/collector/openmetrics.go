@@ -0,0 +1,247 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// FmtOpenMetrics is the OpenMetrics text exposition format.
+const FmtOpenMetrics expfmt.Format = `application/openmetrics-text; version=1.0.0; charset=utf-8`
+
+// responseFormat extends expfmt.ResponseFormat with the OpenMetrics text
+// format.
+func responseFormat(h http.Header) expfmt.Format {
+	mediatype, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+
+	if err == nil && mediatype == "application/openmetrics-text" {
+		return FmtOpenMetrics
+	}
+
+	return expfmt.ResponseFormat(h)
+}
+
+// ParseOpenMetrics parses the OpenMetrics text format into samples.
+// Metadata lines are skipped and every sample line, including the _created
+// series carrying created timestamps, becomes a sample. Sample timestamps
+// are given in seconds, samples without one are stamped with now. When
+// exemplars is set, each exemplar is returned as an additional
+// <series>_exemplar sample carrying the series and exemplar labels. The
+// metric family types are added to types when it is not nil.
+func ParseOpenMetrics(r io.Reader, now model.Time, exemplars bool, types MetricTypes) (model.Vector, error) {
+	samples := model.Vector{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	lineNumber := 0
+	eof := false
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNumber++
+
+		if eof {
+			return nil, fmt.Errorf("openmetrics line %d: unexpected data after # EOF", lineNumber)
+		}
+
+		if line == "# EOF" {
+			eof = true
+			continue
+		}
+
+		if strings.HasPrefix(line, "# TYPE ") {
+			if fields := strings.Fields(line); len(fields) == 4 && types != nil {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sample, exemplar, err := parseOpenMetricsLine(line, now)
+
+		if err != nil {
+			return nil, fmt.Errorf("openmetrics line %d: %v", lineNumber, err)
+		}
+
+		samples = append(samples, sample)
+
+		if exemplars && exemplar != nil {
+			samples = append(samples, exemplar)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !eof {
+		return nil, errors.New("openmetrics exposition does not end with # EOF")
+	}
+
+	return samples, nil
+}
+
+func parseOpenMetricsLine(line string, now model.Time) (*model.Sample, *model.Sample, error) {
+	nameEnd := strings.IndexAny(line, "{ ")
+
+	if nameEnd <= 0 {
+		return nil, nil, fmt.Errorf("invalid sample %q", line)
+	}
+
+	name := line[:nameEnd]
+
+	if !model.IsValidMetricName(model.LabelValue(name)) {
+		return nil, nil, fmt.Errorf("invalid metric name %q", name)
+	}
+
+	metric := model.Metric{model.MetricNameLabel: model.LabelValue(name)}
+	rest := line[nameEnd:]
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		rest, err = parseOpenMetricsLabels(rest, metric)
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	exemplarText := ""
+
+	if i := strings.Index(rest, " # "); i >= 0 {
+		rest, exemplarText = rest[:i], rest[i+3:]
+	}
+
+	value, timestamp, err := parseOpenMetricsValue(strings.TrimPrefix(rest, " "), now)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sample := &model.Sample{Metric: metric, Value: value, Timestamp: timestamp}
+
+	if exemplarText == "" {
+		return sample, nil, nil
+	}
+
+	exemplarMetric := metric.Clone()
+	exemplarMetric[model.MetricNameLabel] = model.LabelValue(name + "_exemplar")
+
+	if !strings.HasPrefix(exemplarText, "{") {
+		return nil, nil, fmt.Errorf("invalid exemplar %q", exemplarText)
+	}
+
+	exemplarText, err = parseOpenMetricsLabels(exemplarText, exemplarMetric)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exemplarValue, exemplarTimestamp, err := parseOpenMetricsValue(strings.TrimPrefix(exemplarText, " "), now)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exemplar := &model.Sample{Metric: exemplarMetric, Value: exemplarValue, Timestamp: exemplarTimestamp}
+
+	return sample, exemplar, nil
+}
+
+// parseOpenMetricsLabels parses a {name="value",...} label set at the start
+// of text into metric and returns the remaining text.
+func parseOpenMetricsLabels(text string, metric model.Metric) (string, error) {
+	i := 1
+
+	for {
+		if i >= len(text) {
+			return "", errors.New("unterminated label set")
+		}
+
+		if text[i] == '}' {
+			return text[i+1:], nil
+		}
+
+		nameEnd := strings.Index(text[i:], `="`)
+
+		if nameEnd < 0 {
+			return "", fmt.Errorf("invalid label set %q", text)
+		}
+
+		labelName := model.LabelName(text[i : i+nameEnd])
+
+		if !labelName.IsValid() {
+			return "", fmt.Errorf("invalid label name %q", labelName)
+		}
+
+		i += nameEnd + 2
+
+		var value strings.Builder
+		for ; i < len(text) && text[i] != '"'; i++ {
+			if text[i] == '\\' && i+1 < len(text) {
+				i++
+				switch text[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(text[i])
+				}
+				continue
+			}
+			value.WriteByte(text[i])
+		}
+
+		if i >= len(text) {
+			return "", fmt.Errorf("unterminated label value for %q", labelName)
+		}
+
+		metric[labelName] = model.LabelValue(value.String())
+		i++
+
+		if i < len(text) && text[i] == ',' {
+			i++
+		}
+	}
+}
+
+// parseOpenMetricsValue parses "value [timestamp]", where the timestamp is
+// in seconds.
+func parseOpenMetricsValue(text string, now model.Time) (model.SampleValue, model.Time, error) {
+	fields := strings.Split(text, " ")
+
+	if len(fields) < 1 || len(fields) > 2 || fields[0] == "" {
+		return 0, 0, fmt.Errorf("invalid value %q", text)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid value %q", fields[0])
+	}
+
+	timestamp := now
+
+	if len(fields) == 2 {
+		seconds, err := strconv.ParseFloat(fields[1], 64)
+
+		if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return 0, 0, fmt.Errorf("invalid timestamp %q", fields[1])
+		}
+
+		timestamp = model.TimeFromUnixNano(int64(seconds * 1e9))
+	}
+
+	return model.SampleValue(value), timestamp, nil
+}
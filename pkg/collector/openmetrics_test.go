@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const testOpenMetrics = `# TYPE http_requests counter
+# HELP http_requests Requests served.
+http_requests_total{code="200",path="/a\"b"} 1027 1506991233.5 # {trace_id="abc123"} 0.67 1506991230
+http_requests_created{code="200",path="/a\"b"} 1506990000
+# TYPE build info
+build_info{version="1.0"} 1
+# TYPE door stateset
+door{door="open"} 1
+door{door="closed"} 0
+# EOF
+`
+
+func TestParseOpenMetrics(t *testing.T) {
+	now := model.TimeFromUnix(1506991300)
+
+	types := MetricTypes{}
+
+	samples, err := ParseOpenMetrics(strings.NewReader(testOpenMetrics), now, false, types)
+
+	assert.NoError(t, err)
+	assert.Len(t, samples, 5)
+	assert.Equal(t, "counter", types.Type("http_requests_total"))
+	assert.Equal(t, "info", types.Type("build_info"))
+	assert.Equal(t, "stateset", types.Type("door"))
+
+	requests := samples[0]
+	assert.Equal(t, model.LabelValue("http_requests_total"), requests.Metric[model.MetricNameLabel])
+	assert.Equal(t, model.LabelValue(`/a"b`), requests.Metric["path"])
+	assert.Equal(t, model.SampleValue(1027), requests.Value)
+	assert.Equal(t, model.Time(1506991233500), requests.Timestamp)
+
+	created := samples[1]
+	assert.Equal(t, model.LabelValue("http_requests_created"), created.Metric[model.MetricNameLabel])
+	assert.Equal(t, model.SampleValue(1506990000), created.Value)
+	assert.Equal(t, now, created.Timestamp)
+}
+
+func TestParseOpenMetricsExemplars(t *testing.T) {
+	samples, err := ParseOpenMetrics(strings.NewReader(testOpenMetrics), model.Now(), true, nil)
+
+	assert.NoError(t, err)
+	assert.Len(t, samples, 6)
+
+	exemplar := samples[1]
+	assert.Equal(t, model.LabelValue("http_requests_total_exemplar"), exemplar.Metric[model.MetricNameLabel])
+	assert.Equal(t, model.LabelValue("abc123"), exemplar.Metric["trace_id"])
+	assert.Equal(t, model.LabelValue("200"), exemplar.Metric["code"])
+	assert.Equal(t, model.SampleValue(0.67), exemplar.Value)
+	assert.Equal(t, model.TimeFromUnix(1506991230), exemplar.Timestamp)
+}
+
+func TestParseOpenMetricsErrors(t *testing.T) {
+	for _, exposition := range []string{
+		"foo 1\n",
+		"foo 1\n# EOF\nbar 2\n",
+		"foo{bar=\"baz} 1\n# EOF\n",
+		"foo one\n# EOF\n",
+	} {
+		_, err := ParseOpenMetrics(strings.NewReader(exposition), model.Now(), false, nil)
+		assert.Error(t, err, exposition)
+	}
+}
+
+func TestQueryExporterOpenMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.Header.Get("Accept"), "application/openmetrics-text")
+		w.Header().Set("Content-Type", string(FmtOpenMetrics))
+		w.Write([]byte(testOpenMetrics))
+	}))
+	defer server.Close()
+
+	samples, err := QueryExporter(server.URL, ExporterAuth{}, &tls.Config{}, ParseOptions{}, RequestOptions{})
+
+	assert.NoError(t, err)
+	assert.Len(t, samples, 5)
+}
@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// opentsdbBatchSize is the number of data points per /api/put request.
+	opentsdbBatchSize = 50
+)
+
+// OpenTSDBConfig configures the sendtoopentsdb output.
+type OpenTSDBConfig struct {
+	// URL is the OpenTSDB base URL, data points are posted to /api/put.
+	URL       string
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+}
+
+// OpenTSDBDataPoint is a data point of the OpenTSDB /api/put JSON format.
+type OpenTSDBDataPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     float64           `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// opentsdbInvalidChars matches the characters OpenTSDB does not allow in
+// metric names and tags.
+var opentsdbInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9\-_./]`)
+
+// CreateOpenTSDBDataPoints converts samples to OpenTSDB data points with
+// the labels as tags. OpenTSDB cannot store NaN or infinite values, so
+// those samples are skipped, as are labels with an empty value.
+func CreateOpenTSDBDataPoints(samples model.Vector, metricPrefix string, timestampPrecision string) []OpenTSDBDataPoint {
+	dataPoints := []OpenTSDBDataPoint{}
+
+	for _, sample := range samples {
+		value := float64(sample.Value)
+
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		tags := map[string]string{}
+		for name, labelValue := range sample.Metric {
+			if name != "__name__" && labelValue != "" {
+				tags[opentsdbInvalidChars.ReplaceAllString(string(name), "_")] = opentsdbInvalidChars.ReplaceAllString(string(labelValue), "_")
+			}
+		}
+
+		dataPoints = append(dataPoints, OpenTSDBDataPoint{
+			Metric:    opentsdbInvalidChars.ReplaceAllString(metricPrefix+string(sample.Metric["__name__"]), "_"),
+			Timestamp: FormatTimestamp(sample.Timestamp, timestampPrecision),
+			Value:     value,
+			Tags:      tags,
+		})
+	}
+
+	return dataPoints
+}
+
+// CreateOpenTSDBMetrics formats samples as OpenTSDB telnet put commands,
+// put <metric> <timestamp> <value> <tagk=tagv> ...
+func CreateOpenTSDBMetrics(samples model.Vector, metricPrefix string, timestampPrecision string) string {
+	metrics := ""
+
+	for _, dataPoint := range CreateOpenTSDBDataPoints(samples, metricPrefix, timestampPrecision) {
+		value := strconv.FormatFloat(dataPoint.Value, 'f', -1, 64)
+		metric := fmt.Sprintf("put %s %d %s", dataPoint.Metric, dataPoint.Timestamp, value)
+
+		names := make([]string, 0, len(dataPoint.Tags))
+		for name := range dataPoint.Tags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			metric += fmt.Sprintf(" %s=%s", name, dataPoint.Tags[name])
+		}
+
+		metrics += metric + "\n"
+	}
+
+	return metrics
+}
+
+// SendToOpenTSDB posts samples to the OpenTSDB HTTP /api/put endpoint in
+// batches of opentsdbBatchSize data points.
+func SendToOpenTSDB(samples model.Vector, metricPrefix string, timestampPrecision string, config OpenTSDBConfig) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config.TLSConfig,
+		},
+		Timeout: config.Timeout,
+	}
+	defer client.CloseIdleConnections()
+
+	putURL := strings.TrimSuffix(config.URL, "/") + "/api/put"
+	dataPoints := CreateOpenTSDBDataPoints(samples, metricPrefix, timestampPrecision)
+
+	for start := 0; start < len(dataPoints); start += opentsdbBatchSize {
+		end := start + opentsdbBatchSize
+		if end > len(dataPoints) {
+			end = len(dataPoints)
+		}
+
+		body, err := json.Marshal(dataPoints[start:end])
+
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Post(putURL, "application/json", bytes.NewReader(body))
+
+		if err != nil {
+			return err
+		}
+
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		if resp.StatusCode/100 != 2 {
+			return errors.New("opentsdb returned non 2xx HTTP response status: " + resp.Status + ": " + strings.TrimSpace(string(respBody)))
+		}
+	}
+
+	return nil
+}
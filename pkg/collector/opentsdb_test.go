@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateOpenTSDBMetrics(t *testing.T) {
+	samples := model.Vector{
+		{
+			Metric:    model.Metric{model.MetricNameLabel: "node_load1", "instance": "host1:9100", "job": "node", "empty": ""},
+			Value:     0.5,
+			Timestamp: model.Time(1506991233000),
+		},
+		{
+			Metric:    model.Metric{model.MetricNameLabel: "node_load5"},
+			Value:     model.SampleValue(math.NaN()),
+			Timestamp: model.Time(1506991233000),
+		},
+	}
+
+	assert.Equal(t, "put prefix.node_load1 1506991233 0.5 instance=host1_9100 job=node\n", CreateOpenTSDBMetrics(samples, "prefix.", "s"))
+}
+
+func TestSendToOpenTSDB(t *testing.T) {
+	var requests [][]OpenTSDBDataPoint
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/put", r.URL.Path)
+
+		var dataPoints []OpenTSDBDataPoint
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&dataPoints))
+		requests = append(requests, dataPoints)
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	samples := model.Vector{}
+	for i := 0; i <= opentsdbBatchSize; i++ {
+		samples = append(samples, &model.Sample{
+			Metric:    model.Metric{model.MetricNameLabel: "up", "job": "node"},
+			Value:     1,
+			Timestamp: model.Time(1506991233000),
+		})
+	}
+
+	err := SendToOpenTSDB(samples, "", "ms", OpenTSDBConfig{URL: ts.URL})
+
+	assert.NoError(t, err)
+	assert.Len(t, requests, 2)
+	assert.Len(t, requests[0], opentsdbBatchSize)
+	assert.Equal(t, OpenTSDBDataPoint{Metric: "up", Timestamp: 1506991233000, Value: 1, Tags: map[string]string{"job": "node"}}, requests[1][0])
+}
+
+func TestSendToOpenTSDBError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid data point", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	samples := model.Vector{{Metric: model.Metric{model.MetricNameLabel: "up"}, Value: 1}}
+
+	err := SendToOpenTSDB(samples, "", "s", OpenTSDBConfig{URL: ts.URL})
+
+	assert.EqualError(t, err, "opentsdb returned non 2xx HTTP response status: 400 Bad Request: invalid data point")
+}
@@ -0,0 +1,197 @@
+package collector
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/common/model"
+)
+
+// FilterOptions selects samples with the regexes of FilterSamples, then
+// those of FilterSampleNames, the label matchers and the value bounds of
+// FilterValues. It implements Filter.
+type FilterOptions struct {
+	IncludeRegex  string
+	ExcludeRegex  string
+	IncludeNames  string
+	ExcludeNames  string
+	Matchers      []*LabelMatcher
+	DropNonFinite bool
+	// Min and Max are the bounds of the values kept, nil for none.
+	Min *float64
+	Max *float64
+}
+
+// Filter implements Filter.
+func (f *FilterOptions) Filter(samples model.Vector) (model.Vector, error) {
+	var err error
+
+	if f.IncludeRegex != "" || f.ExcludeRegex != "" {
+		before := len(samples)
+
+		if samples, err = FilterSamples(samples, f.IncludeRegex, f.ExcludeRegex); err != nil {
+			return nil, err
+		}
+
+		Debugf("-include-regex and -exclude-regex kept %d of %d samples", len(samples), before)
+	}
+
+	if f.IncludeNames != "" || f.ExcludeNames != "" {
+		before := len(samples)
+
+		if samples, err = FilterSampleNames(samples, f.IncludeNames, f.ExcludeNames); err != nil {
+			return nil, err
+		}
+
+		Debugf("-include-names and -exclude-names kept %d of %d samples", len(samples), before)
+	}
+
+	if len(f.Matchers) > 0 {
+		before := len(samples)
+		samples = FilterLabelMatchers(samples, f.Matchers)
+		Debugf("-match kept %d of %d samples", len(samples), before)
+	}
+
+	if f.DropNonFinite || f.Min != nil || f.Max != nil {
+		min, max := math.Inf(-1), math.Inf(1)
+
+		if f.Min != nil {
+			min = *f.Min
+		}
+
+		if f.Max != nil {
+			max = *f.Max
+		}
+
+		before := len(samples)
+		samples = FilterValues(samples, f.DropNonFinite, min, max)
+		Debugf("-drop-non-finite, -min-value and -max-value kept %d of %d samples", len(samples), before)
+	}
+
+	return samples, nil
+}
+
+// Pipeline processes the collected samples before they are output, in
+// order: the family policies, the filter, the counter mode, the label
+// projection, the aggregations, unit conversions and value transforms, the
+// deduplication, the sample limit, the renames and the host label.
+type Pipeline struct {
+	// Types are the metric types of the samples, of the family policies and
+	// counter mode.
+	Types          MetricTypes
+	FamilyPolicies FamilyPolicies
+	// Filter selects the samples, nil to keep them all.
+	Filter Filter
+	// CounterMode is CounterRaw, CounterRate or CounterDelta, the counter
+	// values of the previous run being kept in CounterStatePath. Counters
+	// are left raw without a state path, e.g. in dry runs, which must not
+	// change the rates and deltas of the next run.
+	CounterMode      string
+	CounterStatePath string
+	KeepLabels       []string
+	DropLabels       []string
+	Aggregations     []*Aggregation
+	UnitConversions  []UnitConversion
+	ValueTransforms  []ValueTransform
+	// Duplicates is the handling of samples with the same metric name and
+	// labels, newest, error or keep, newest if empty.
+	Duplicates string
+	// MaxSamples is the maximum number of samples, 0 for unlimited, more
+	// failing the run unless TruncateSamples is set.
+	MaxSamples      int
+	TruncateSamples bool
+	Renames         map[model.LabelValue]model.LabelValue
+	// HostLabel is the label set to Host on every sample without one, none
+	// if empty.
+	HostLabel model.LabelName
+	Host      model.LabelValue
+}
+
+// Process returns the processed samples, sorted, and the number of samples
+// kept by the family policies and filter. matrix is set when the samples
+// hold every point of range query or subquery series, which are aggregated
+// per point and not deduped.
+func (p *Pipeline) Process(samples model.Vector, matrix bool) (model.Vector, int, error) {
+	samples = ApplyFamilyPolicies(samples, p.Types, p.FamilyPolicies)
+
+	var err error
+
+	if p.Filter != nil {
+		if samples, err = p.Filter.Filter(samples); err != nil {
+			return nil, 0, Classify(err, FailureFilter)
+		}
+	}
+
+	selected := len(samples)
+
+	if p.CounterMode != "" && p.CounterMode != CounterRaw && p.CounterStatePath != "" {
+		if samples, err = p.computeCounters(samples); err != nil {
+			return nil, 0, Classify(err, FailureConfig)
+		}
+	}
+
+	if len(p.KeepLabels) > 0 || len(p.DropLabels) > 0 {
+		samples = ProjectLabels(samples, p.KeepLabels, p.DropLabels)
+	}
+
+	if len(p.Aggregations) > 0 {
+		samples = AggregateSamples(samples, p.Aggregations, matrix)
+	}
+
+	if len(p.UnitConversions) > 0 {
+		samples = ConvertUnits(samples, p.UnitConversions)
+	}
+
+	if len(p.ValueTransforms) > 0 {
+		samples = TransformValues(samples, p.ValueTransforms)
+	}
+
+	if p.Duplicates != "keep" && !matrix {
+		before := len(samples)
+
+		if samples, err = DedupeSamples(samples, p.Duplicates == "error"); err != nil {
+			return nil, 0, Classify(err, FailureFilter)
+		}
+
+		Debugf("Dropped %d duplicate samples", before-len(samples))
+	}
+
+	SortSamples(samples)
+
+	if samples, err = LimitSamples(samples, p.MaxSamples, p.TruncateSamples); err != nil {
+		return nil, 0, Classify(err, FailureLimit)
+	}
+
+	if p.Renames != nil {
+		samples = RenameSamples(samples, p.Renames)
+	}
+
+	if p.HostLabel != "" {
+		samples = AddLabel(samples, p.HostLabel, p.Host)
+	}
+
+	return samples, selected, nil
+}
+
+// computeCounters replaces the counters with their rate or delta since the
+// previous run and saves their values for the next one.
+func (p *Pipeline) computeCounters(samples model.Vector) (model.Vector, error) {
+	if err := os.MkdirAll(filepath.Dir(p.CounterStatePath), 0755); err != nil {
+		return nil, err
+	}
+
+	previous, err := LoadCounterState(p.CounterStatePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	samples, state := ComputeCounters(samples, p.Types, p.CounterMode, previous)
+
+	if err := SaveCounterState(p.CounterStatePath, state); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterOptions(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "node_load1", "instance": "a"}, Value: 0.5},
+		{Metric: model.Metric{model.MetricNameLabel: "node_load5", "instance": "b"}, Value: 2},
+		{Metric: model.Metric{model.MetricNameLabel: "node_load15", "instance": "a"}, Value: model.SampleValue(math.NaN())},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "instance": "a"}, Value: 1},
+	}
+
+	matchers, err := ParseLabelMatchers([]string{"instance=a"})
+	assert.NoError(t, err)
+
+	max := 1.0
+	filter := &FilterOptions{IncludeNames: "node_.*", Matchers: matchers, DropNonFinite: true, Max: &max}
+
+	filtered, err := filter.Filter(samples)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Vector{samples[0]}, filtered)
+
+	filtered, err = (&FilterOptions{}).Filter(samples)
+	assert.NoError(t, err)
+	assert.Equal(t, samples, filtered)
+
+	_, err = (&FilterOptions{IncludeRegex: "("}).Filter(samples)
+	assert.Error(t, err)
+}
+
+func TestPipeline(t *testing.T) {
+	samples := func() model.Vector {
+		return model.Vector{
+			{Metric: model.Metric{model.MetricNameLabel: "requests_total"}, Value: 10, Timestamp: 1000},
+			{Metric: model.Metric{model.MetricNameLabel: "temperature"}, Value: 21, Timestamp: 1000},
+			{Metric: model.Metric{model.MetricNameLabel: "temperature"}, Value: 22, Timestamp: 2000},
+			{Metric: model.Metric{model.MetricNameLabel: "up"}, Value: 1, Timestamp: 1000},
+		}
+	}
+
+	pipeline := &Pipeline{
+		Types:     MetricTypes{"requests": "counter"},
+		Filter:    &FilterOptions{ExcludeNames: "up"},
+		HostLabel: "host",
+		Host:      "server1",
+	}
+
+	processed, selected, err := pipeline.Process(samples(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, selected)
+	assert.Equal(t, []string{
+		`requests_total{host="server1"} => 10 @[1]`,
+		`temperature{host="server1"} => 22 @[2]`,
+	}, []string{processed[0].String(), processed[1].String()})
+
+	// Matrix samples are not deduped.
+	processed, _, err = pipeline.Process(samples(), true)
+	assert.NoError(t, err)
+	assert.Len(t, processed, 3)
+
+	pipeline.MaxSamples = 1
+	_, _, err = pipeline.Process(samples(), false)
+
+	var failure *FailureError
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureLimit, failure.Class)
+
+	pipeline.TruncateSamples = true
+	processed, _, err = pipeline.Process(samples(), false)
+	assert.NoError(t, err)
+	assert.Len(t, processed, 2)
+	assert.Equal(t, model.LabelValue(TruncatedSamplesMetric), processed[1].Metric[model.MetricNameLabel])
+}
+
+func TestPipelineCounters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	samples := func(value model.SampleValue, timestamp model.Time) model.Vector {
+		return model.Vector{{Metric: model.Metric{model.MetricNameLabel: "requests_total"}, Value: value, Timestamp: timestamp}}
+	}
+
+	// Counters are left raw without a state path.
+	pipeline := &Pipeline{Types: MetricTypes{}, CounterMode: CounterDelta}
+
+	processed, _, err := pipeline.Process(samples(10, 1000), false)
+	assert.NoError(t, err)
+	assert.Len(t, processed, 1)
+
+	pipeline.CounterStatePath = filepath.Join(dir, "state", "counters.json")
+
+	processed, _, err = pipeline.Process(samples(10, 1000), false)
+	assert.NoError(t, err)
+	assert.Empty(t, processed)
+
+	processed, _, err = pipeline.Process(samples(15, 2000), false)
+	assert.NoError(t, err)
+	assert.Equal(t, model.SampleValue(5), processed[0].Value)
+}
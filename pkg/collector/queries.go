@@ -0,0 +1,180 @@
+package collector
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/prometheus/common/model"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// namedQueryRegex matches a query named name=<query>. A single = is not
+// valid PromQL outside of label matchers, so queries are never mistaken
+// for names.
+var namedQueryRegex = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*=([^=~].*)$`)
+
+// PromQuery is a Prometheus API query, with the name its samples are
+// labeled with.
+type PromQuery struct {
+	Name  string
+	Query string
+	// ScalarMetric names the sample of a scalar or string result,
+	// DefaultScalarMetric if empty.
+	ScalarMetric string
+	// Prefix is prepended to the metric names of the samples.
+	Prefix string
+	// Warning and Critical, if set, are the thresholds of the samples of
+	// the query, in addition to -warning and -critical.
+	Warning  *Threshold
+	Critical *Threshold
+}
+
+// QueryFileEntry is a query of a -queries-file.
+type QueryFileEntry struct {
+	Name     string `yaml:"name"`
+	Query    string `yaml:"query"`
+	Prefix   string `yaml:"prefix"`
+	Warning  string `yaml:"warning"`
+	Critical string `yaml:"critical"`
+}
+
+// QueryResults are the merged samples of queries.
+type QueryResults struct {
+	Samples model.Vector
+	// Matrix reports whether any query returned a matrix, with a sample
+	// per point of its series.
+	Matrix bool
+	// Status is the worst check status of the query thresholds.
+	Status int
+}
+
+// ParsePromQueries parses -prom-query values, queries optionally named
+// name=<query>. The name of an unnamed query is the query itself.
+func ParsePromQueries(values []string) []PromQuery {
+	queries := make([]PromQuery, 0, len(values))
+
+	for _, value := range values {
+		query := PromQuery{Name: value, Query: value}
+
+		if match := namedQueryRegex.FindStringSubmatch(value); match != nil {
+			query = PromQuery{Name: match[1], Query: match[2]}
+		}
+
+		queries = append(queries, query)
+	}
+
+	return queries
+}
+
+// LoadQueriesFile loads the queries of a YAML file, a list of queries
+// with a query, and an optional name, defaulting to the query, metric
+// name prefix and warning and critical thresholds.
+func LoadQueriesFile(path string) ([]PromQuery, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []QueryFileEntry
+
+	if err := yaml.UnmarshalStrict(data, &entries); err != nil {
+		return nil, fmt.Errorf("error parsing queries file %s: %v", path, err)
+	}
+
+	queries := make([]PromQuery, 0, len(entries))
+
+	for i, entry := range entries {
+		query, err := entry.PromQuery()
+
+		if err != nil {
+			return nil, fmt.Errorf("error parsing queries file %s: query %d: %v", path, i+1, err)
+		}
+
+		queries = append(queries, query)
+	}
+
+	return queries, nil
+}
+
+// PromQuery returns the query of the entry, with its thresholds parsed.
+func (e QueryFileEntry) PromQuery() (PromQuery, error) {
+	query := PromQuery{Name: e.Name, Query: e.Query, Prefix: e.Prefix}
+
+	if e.Query == "" {
+		return query, errors.New("missing query")
+	}
+
+	if query.Name == "" {
+		query.Name = e.Query
+	}
+
+	var err error
+
+	if e.Warning != "" {
+		if query.Warning, err = ParseThreshold(e.Warning); err != nil {
+			return query, err
+		}
+	}
+
+	if e.Critical != "" {
+		if query.Critical, err = ParseThreshold(e.Critical); err != nil {
+			return query, err
+		}
+	}
+
+	return query, nil
+}
+
+// QueryPrometheusQueries runs every query, requestOptions.Concurrency at a
+// time, and merges the samples in query order. The metric names of the
+// samples of a query are prefixed with its prefix, and when nameLabel is
+// set the samples are labeled with the name of their query; as with target
+// labels, a label of the result is kept as exported_<label>. The errors of
+// every failing query are returned as a MultiError.
+func QueryPrometheusQueries(promURL string, queries []PromQuery, nameLabel string, auth PrometheusAuth, tlsConfig *tls.Config, requestOptions RequestOptions) (*QueryResults, error) {
+	results := make([]model.Vector, len(queries))
+	matrices := make([]bool, len(queries))
+	errs := make([]error, len(queries))
+
+	runConcurrently(len(queries), requestOptions.Concurrency, func(i int) {
+		var err error
+		results[i], matrices[i], err = queryPrometheus(promURL, queries[i].Query, queries[i].ScalarMetric, auth, tlsConfig, requestOptions)
+
+		if err != nil && len(queries) > 1 {
+			errs[i] = fmt.Errorf("query %s: %w", queries[i].Name, err)
+		} else {
+			errs[i] = err
+		}
+	})
+
+	if err := multiError(errs); err != nil {
+		return nil, err
+	}
+
+	merged := &QueryResults{Samples: model.Vector{}, Status: CheckOK}
+
+	for i, query := range queries {
+		if status := CheckStatus(results[i], query.Warning, query.Critical); status > merged.Status {
+			merged.Status = status
+		}
+
+		if query.Prefix != "" {
+			for _, sample := range results[i] {
+				sample.Metric[model.MetricNameLabel] = model.LabelValue(query.Prefix) + sample.Metric[model.MetricNameLabel]
+			}
+		}
+
+		if nameLabel != "" {
+			addTargetLabels(results[i], model.LabelSet{model.LabelName(nameLabel): model.LabelValue(query.Name)})
+		}
+
+		merged.Samples = append(merged.Samples, results[i]...)
+		merged.Matrix = merged.Matrix || matrices[i]
+	}
+
+	return merged, nil
+}
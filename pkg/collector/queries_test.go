@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePromQueries(t *testing.T) {
+	assert.Equal(t, []PromQuery{
+		{Name: "up", Query: "up"},
+		{Name: "disk", Query: "node_filesystem_avail_bytes / node_filesystem_size_bytes"},
+		{Name: `up{job="node"} == 1`, Query: `up{job="node"} == 1`},
+		{Name: "up==1", Query: "up==1"},
+		{Name: "job:up:sum", Query: "job:up:sum"},
+		{Name: "load", Query: ` node_load1{instance="a"}`},
+	}, ParsePromQueries([]string{
+		"up",
+		"disk=node_filesystem_avail_bytes / node_filesystem_size_bytes",
+		`up{job="node"} == 1`,
+		"up==1",
+		"job:up:sum",
+		`load = node_load1{instance="a"}`,
+	}))
+}
+
+func TestQueryPrometheusQueries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.FormValue("query") {
+		case "up":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` +
+				`{"metric":{"__name__":"up","job":"node"},"value":[1506991200,"1"]}]}}`))
+		case "node_load1":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` +
+				`{"metric":{"__name__":"node_load1","query":"exposed"},"value":[1506991200,"0.5"]}]}}`))
+		default:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+		}
+	}))
+	defer server.Close()
+
+	queries := ParsePromQueries([]string{"up", "load=node_load1"})
+
+	results, err := QueryPrometheusQueries(server.URL, queries, "query", PrometheusAuth{}, &tls.Config{}, RequestOptions{Concurrency: 2})
+	assert.NoError(t, err)
+	assert.False(t, results.Matrix)
+	assert.Equal(t, CheckOK, results.Status)
+	assert.Equal(t, `up{job="node", query="up"} => 1 @[1506991200]`, results.Samples[0].String())
+	assert.Equal(t, `node_load1{exported_query="exposed", query="load"} => 0.5 @[1506991200]`, results.Samples[1].String())
+
+	results, err = QueryPrometheusQueries(server.URL, queries, "", PrometheusAuth{}, &tls.Config{}, RequestOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, `node_load1{query="exposed"} => 0.5 @[1506991200]`, results.Samples[1].String())
+
+	queries[1].Prefix = "host_"
+	queries[1].Warning = &Threshold{Operator: ">", Value: 0.4}
+	results, err = QueryPrometheusQueries(server.URL, queries, "", PrometheusAuth{}, &tls.Config{}, RequestOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, CheckWarning, results.Status)
+	assert.Equal(t, `host_node_load1{query="exposed"} => 0.5 @[1506991200]`, results.Samples[1].String())
+
+	_, err = QueryPrometheusQueries(server.URL, ParsePromQueries([]string{"up", "invalid=rate(up"}), "", PrometheusAuth{}, &tls.Config{}, RequestOptions{})
+	assert.EqualError(t, err, "query invalid: bad_data: parse error")
+}
+
+func TestLoadQueriesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "queries.yml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`
+- query: up
+- name: disk
+  query: node_filesystem_avail_bytes / node_filesystem_size_bytes
+  prefix: disk_
+  warning: value < 0.2
+  critical: value < 0.1
+`), 0644))
+
+	queries, err := LoadQueriesFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []PromQuery{
+		{Name: "up", Query: "up"},
+		{
+			Name:     "disk",
+			Query:    "node_filesystem_avail_bytes / node_filesystem_size_bytes",
+			Prefix:   "disk_",
+			Warning:  &Threshold{Operator: "<", Value: 0.2},
+			Critical: &Threshold{Operator: "<", Value: 0.1},
+		},
+	}, queries)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("- name: disk\n  warning: value < 0.2\n"), 0644))
+	_, err = LoadQueriesFile(path)
+	assert.EqualError(t, err, "error parsing queries file "+path+": query 1: missing query")
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("- query: up\n  threshold: value < 1\n"), 0644))
+	_, err = LoadQueriesFile(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,206 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// recordingExt is the extension of the recorded responses.
+	recordingExt = ".http"
+	// recordedURLHeader is the header of a recorded response holding the
+	// URL it was the response to.
+	recordedURLHeader = "X-Recorded-Url"
+)
+
+// Recorder saves the raw responses of the exporter scrapes and Prometheus
+// API queries of a run, for them to be replayed with ReplayRecording.
+type Recorder struct {
+	dir    string
+	prefix string
+	seq    uint32
+}
+
+// NewRecorder returns a recorder saving the responses to dir, created if
+// missing.
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create record directory: %v", err)
+	}
+
+	return &Recorder{
+		dir:    dir,
+		prefix: time.Now().UTC().Format("20060102T150405.000000000Z"),
+	}, nil
+}
+
+// Record saves a response, with the URL of its request, to a file named
+// after the start of the run and the sequence of the response in the run,
+// and returns the response with its body restored. A failure to record is
+// logged rather than failing the request.
+func (r *Recorder) Record(req *http.Request, resp *http.Response) *http.Response {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		// The error is left for the reader of the response.
+		resp.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+		return resp
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	recorded := *resp
+	recorded.Header = resp.Header.Clone()
+	recorded.Header.Set(recordedURLHeader, req.URL.String())
+	recorded.Body = ioutil.NopCloser(bytes.NewReader(body))
+	recorded.ContentLength = int64(len(body))
+	recorded.TransferEncoding = nil
+
+	path := filepath.Join(r.dir, fmt.Sprintf("%s-%d%s", r.prefix, atomic.AddUint32(&r.seq, 1), recordingExt))
+
+	if err := writeResponse(path, &recorded); err != nil {
+		Warnf("failed to record response of %s: %v", req.URL, err)
+	}
+
+	return resp
+}
+
+func writeResponse(path string, resp *http.Response) error {
+	f, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	err = resp.Write(f)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// errReader returns err once its data is read.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// recordTransport records the responses it round trips.
+type recordTransport struct {
+	Base     http.RoundTripper
+	Recorder *Recorder
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+
+	if err != nil {
+		return resp, err
+	}
+
+	return t.Recorder.Record(req, resp), nil
+}
+
+// ReplayRecording parses a response saved by a Recorder into samples, as
+// they were scraped or queried: a Prometheus API query response if it is
+// JSON, an exposition otherwise.
+func ReplayRecording(path string, parseOptions ParseOptions) (model.Vector, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, &FailureError{Class: FailureConfig, Err: err}
+	}
+	defer f.Close()
+
+	resp, err := http.ReadResponse(bufio.NewReader(f), nil)
+
+	if err != nil {
+		return nil, &FailureError{Class: FailureParse, Err: fmt.Errorf("error reading recording %s: %v", path, err)}
+	}
+	defer resp.Body.Close()
+
+	var samples model.Vector
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/json" {
+		samples, err = decodeQueryResponse(resp.Body, parseOptions.ScalarMetric)
+	} else {
+		samples, err = decodeExpositionResponse(resp, parseOptions)
+	}
+
+	if err != nil {
+		return nil, &FailureError{Class: FailureParse, Err: fmt.Errorf("error replaying recording %s: %v", path, err)}
+	}
+
+	return samples, nil
+}
+
+// decodeQueryResponse decodes the result of a Prometheus API query
+// response into samples as ValueToVector.
+func decodeQueryResponse(r io.Reader, scalarMetric string) (model.Vector, error) {
+	var response struct {
+		Status string `json:"status"`
+		Data   struct {
+			ResultType model.ValueType `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+		Error string `json:"error"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	if response.Status != "success" {
+		return nil, errors.New("query failed: " + response.Error)
+	}
+
+	var value model.Value
+	var err error
+
+	switch response.Data.ResultType {
+	case model.ValVector:
+		var vector model.Vector
+		err = json.Unmarshal(response.Data.Result, &vector)
+		value = vector
+	case model.ValMatrix:
+		var matrix model.Matrix
+		err = json.Unmarshal(response.Data.Result, &matrix)
+		value = matrix
+	case model.ValScalar:
+		var scalar model.Scalar
+		err = json.Unmarshal(response.Data.Result, &scalar)
+		value = &scalar
+	case model.ValString:
+		var str model.String
+		err = json.Unmarshal(response.Data.Result, &str)
+		value = &str
+	default:
+		return nil, fmt.Errorf("unexpected response type %s", response.Data.ResultType)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ValueToVector(value, scalarMetric)
+}
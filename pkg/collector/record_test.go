@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"compress/gzip"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metrics":
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			w.Header().Set("Content-Encoding", "gzip")
+			gzipWriter := gzip.NewWriter(w)
+			gzipWriter.Write([]byte("# TYPE node_load1 gauge\nnode_load1{cpu=\"all\"} 0.5\n"))
+			gzipWriter.Close()
+		case "/api/v1/query":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` +
+				`{"metric":{"__name__":"up","job":"node"},"value":[1506991200,"1"]}]}}`))
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recorder, err := NewRecorder(filepath.Join(dir, "recordings"))
+	assert.NoError(t, err)
+
+	scraped, err := QueryExporter(server.URL+"/metrics", ExporterAuth{}, &tls.Config{}, ParseOptions{HonorTimestamps: true}, RequestOptions{Recorder: recorder})
+	assert.NoError(t, err)
+
+	queried, err := QueryPrometheus(server.URL, "up", PrometheusAuth{}, &tls.Config{}, RequestOptions{Recorder: recorder})
+	assert.NoError(t, err)
+
+	recordings, err := filepath.Glob(filepath.Join(dir, "recordings", "*"+recordingExt))
+	assert.NoError(t, err)
+	assert.Len(t, recordings, 2)
+	sort.Strings(recordings)
+
+	types := MetricTypes{}
+	replayed, err := ReplayRecording(recordings[0], ParseOptions{HonorTimestamps: true, Types: types})
+	assert.NoError(t, err)
+	assert.Equal(t, CreateGraphiteMetrics(scraped, "", "", "s"), CreateGraphiteMetrics(replayed, "", "", "s"))
+	assert.Equal(t, "gauge", types["node_load1"])
+
+	replayed, err = ReplayRecording(recordings[1], ParseOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, queried, replayed)
+
+	data, err := ioutil.ReadFile(recordings[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), recordedURLHeader+": "+server.URL+"/api/v1/query")
+}
+
+func TestReplayRecordingQueryError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "error.http")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("HTTP/1.1 400 Bad Request\r\nContent-Type: application/json\r\nContent-Length: 63\r\n\r\n"+
+		`{"status":"error","errorType":"bad_data","error":"parse error"}`), 0644))
+
+	_, err = ReplayRecording(path, ParseOptions{})
+	assert.EqualError(t, err, "error replaying recording "+path+": query failed: parse error")
+
+	_, err = ReplayRecording(filepath.Join(dir, "missing.http"), ParseOptions{})
+	var failure *FailureError
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureConfig, failure.Class)
+}
+
+func TestReplayRecordingString(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	body := `{"status":"success","data":{"resultType":"string","result":[1506991200,"42"]}}`
+	path := filepath.Join(dir, "string.http")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body)), 0644))
+
+	samples, err := ReplayRecording(path, ParseOptions{ScalarMetric: "answer"})
+	assert.NoError(t, err)
+	assert.Equal(t, "answer 42 1506991200\n", CreateGraphiteMetrics(samples, "", "", "s"))
+}
@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// LoadRenameFile loads the metric renames of a rename file, see
+// ParseRenames.
+func LoadRenameFile(path string) (map[model.LabelValue]model.LabelValue, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	renames, err := ParseRenames(f)
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rename file %s: %v", path, err)
+	}
+
+	return renames, nil
+}
+
+// ParseRenames parses metric renames, a line per metric like
+// node_cpu_seconds_total -> system.cpu.seconds. Blank lines and lines
+// starting with # are ignored.
+func ParseRenames(r io.Reader) (map[model.LabelValue]model.LabelValue, error) {
+	renames := map[model.LabelValue]model.LabelValue{}
+	scanner := bufio.NewScanner(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		names := strings.SplitN(line, "->", 2)
+
+		if len(names) != 2 || strings.TrimSpace(names[0]) == "" || strings.TrimSpace(names[1]) == "" {
+			return nil, fmt.Errorf("line %d: expected <name> -> <new name>, got %q", n, line)
+		}
+
+		name := model.LabelValue(strings.TrimSpace(names[0]))
+
+		if _, ok := renames[name]; ok {
+			return nil, fmt.Errorf("line %d: %s is renamed more than once", n, name)
+		}
+
+		renames[name] = model.LabelValue(strings.TrimSpace(names[1]))
+	}
+
+	return renames, scanner.Err()
+}
+
+// RenameSamples returns the samples with their metric names renamed, the
+// samples that are renamed are copied.
+func RenameSamples(samples model.Vector, renames map[model.LabelValue]model.LabelValue) model.Vector {
+	renamed := make(model.Vector, 0, len(samples))
+
+	for _, sample := range samples {
+		if name, ok := renames[sample.Metric[model.MetricNameLabel]]; ok {
+			copied := *sample
+			copied.Metric = sample.Metric.Clone()
+			copied.Metric[model.MetricNameLabel] = name
+			sample = &copied
+		}
+
+		renamed = append(renamed, sample)
+	}
+
+	return renamed
+}
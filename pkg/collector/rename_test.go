@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRenames = `# legacy dashboard names
+node_cpu_seconds_total -> system.cpu.seconds
+
+node_load1->system.load.1
+`
+
+func TestParseRenames(t *testing.T) {
+	renames, err := ParseRenames(strings.NewReader(testRenames))
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[model.LabelValue]model.LabelValue{
+		"node_cpu_seconds_total": "system.cpu.seconds",
+		"node_load1":             "system.load.1",
+	}, renames)
+
+	_, err = ParseRenames(strings.NewReader("node_load1 system.load.1\n"))
+	assert.EqualError(t, err, `line 1: expected <name> -> <new name>, got "node_load1 system.load.1"`)
+
+	_, err = ParseRenames(strings.NewReader("node_load1 -> a\nnode_load1 -> b\n"))
+	assert.EqualError(t, err, "line 2: node_load1 is renamed more than once")
+}
+
+func TestLoadRenameFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "renames")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(testRenames), 0644))
+
+	renames, err := LoadRenameFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, renames, 2)
+
+	_, err = LoadRenameFile(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestRenameSamples(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "node_load1"}, Value: 0.5},
+		{Metric: model.Metric{model.MetricNameLabel: "node_load5"}, Value: 0.25},
+	}
+
+	renamed := RenameSamples(samples, map[model.LabelValue]model.LabelValue{"node_load1": "system.load.1"})
+
+	assert.Equal(t, model.LabelValue("system.load.1"), renamed[0].Metric[model.MetricNameLabel])
+	assert.Equal(t, model.SampleValue(0.5), renamed[0].Value)
+	assert.Equal(t, samples[1], renamed[1])
+	assert.Equal(t, model.LabelValue("node_load1"), samples[0].Metric[model.MetricNameLabel])
+}
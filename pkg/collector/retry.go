@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"time"
+)
+
+// retryableError marks the error of an attempt worth retrying, e.g. a
+// connection error or a 5xx response.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// retry calls attempt until it succeeds, fails with an error that is not a
+// retryableError or options.Retries retries were made, waiting
+// options.RetryBackoff, doubled after every retry, in between. The returned
+// error is unmarked, or ErrInterrupted once options.Context is canceled.
+func retry(options RequestOptions, attempt func() error) error {
+	delay := options.RetryBackoff
+
+	for retries := 0; ; retries++ {
+		err := attempt()
+
+		retryable, ok := err.(*retryableError)
+
+		if !ok {
+			return err
+		}
+
+		if err := options.interrupted(); err != nil {
+			return err
+		}
+
+		if retries >= options.Retries {
+			return retryable.err
+		}
+
+		Warnf("%v, retrying in %s", retryable.err, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-options.context().Done():
+			return ErrInterrupted
+		}
+
+		delay *= 2
+	}
+}
@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	err := retry(RequestOptions{Retries: 2, RetryBackoff: time.Millisecond}, func() error {
+		attempts++
+		return &retryableError{errors.New("connection refused")}
+	})
+	assert.EqualError(t, err, "connection refused")
+	_, marked := err.(*retryableError)
+	assert.False(t, marked)
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = retry(RequestOptions{Retries: 2, RetryBackoff: time.Millisecond}, func() error {
+		attempts++
+		return errors.New("bad request")
+	})
+	assert.EqualError(t, err, "bad request")
+	assert.Equal(t, 1, attempts)
+
+	attempts = 0
+	err = retry(RequestOptions{Retries: 2, RetryBackoff: time.Millisecond}, func() error {
+		attempts++
+		if attempts < 2 {
+			return &retryableError{errors.New("connection refused")}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestQueryExporterRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case requests < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("up 1\n"))
+		}
+	}))
+	defer server.Close()
+
+	samples, err := QueryExporter(server.URL, ExporterAuth{}, nil, ParseOptions{}, RequestOptions{Retries: 2, RetryBackoff: time.Millisecond})
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+	assert.Equal(t, 3, requests)
+
+	requests = 0
+	_, err = QueryExporter(server.URL+"/missing", ExporterAuth{}, nil, ParseOptions{}, RequestOptions{Retries: 2, RetryBackoff: time.Millisecond})
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests)
+}
+
+func TestQueryPrometheusRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.FormValue("query") == "invalid(":
+			w.WriteHeader(422)
+			w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+		case requests < 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` +
+				`{"metric":{"__name__":"up","job":"node"},"value":[1506991200,"1"]}]}}`))
+		}
+	}))
+	defer server.Close()
+
+	samples, err := QueryPrometheus(server.URL, "up", PrometheusAuth{}, &tls.Config{}, RequestOptions{Retries: 1, RetryBackoff: time.Millisecond})
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+	assert.Equal(t, 2, requests)
+
+	requests = 0
+	_, err = QueryPrometheus(server.URL, "invalid(", PrometheusAuth{}, &tls.Config{}, RequestOptions{Retries: 1, RetryBackoff: time.Millisecond})
+	assert.EqualError(t, err, "bad_data: parse error")
+	assert.Equal(t, 1, requests)
+}
+
+func TestRetryInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts := 0
+	err := retry(RequestOptions{Retries: 2, RetryBackoff: time.Hour, Context: ctx}, func() error {
+		attempts++
+		return &retryableError{errors.New("connection refused")}
+	})
+	assert.Equal(t, ErrInterrupted, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestQueryExporterInterrupted(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := QueryExporter(server.URL, ExporterAuth{}, nil, ParseOptions{}, RequestOptions{Retries: 2, Context: ctx})
+	assert.Equal(t, 130, ExitCodes{}.Code(err, FailureUnreachable))
+}
@@ -0,0 +1,212 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// Outputs outputs samples in several output formats. The output of the
+// formats printed to stdout is written to File or sent to Target instead,
+// if set.
+type Outputs struct {
+	Formats []string
+	// Config is the configuration of every output, Format and Status being
+	// set for each.
+	Config         OutputConfig
+	NameSanitizers []NameSanitizerOption
+	File           string
+	Target         string
+	TargetTimeout  time.Duration
+	// Stdout is where the formats printed to stdout are written, os.Stdout
+	// if nil.
+	Stdout io.Writer
+}
+
+// Write outputs samples of the check status in every format. Every output
+// is tried, so one failing destination does not stop the samples reaching
+// the others, the errors of the failing ones being returned as a
+// MultiError.
+func (o *Outputs) Write(samples model.Vector, status int) error {
+	var errs []error
+	stdout := ""
+
+	for _, format := range o.Formats {
+		config := o.Config
+		config.Format = format
+		config.Status = status
+
+		if config.TimestampPrecision == "" {
+			config.TimestampPrecision = DefaultTimestampPrecision(MessageFormat(config))
+		}
+
+		outputSamples := SanitizeSampleNames(samples, OutputNameSanitizer(config, o.NameSanitizers))
+
+		if output, ok := FormatMetrics(outputSamples, config); ok {
+			stdout += output
+			continue
+		}
+
+		if err := OutputMetrics(outputSamples, config); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if o.File != "" {
+		if err := WriteFileAtomic(o.File, []byte(stdout)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if o.Target != "" {
+		if err := SendToSocket(o.Target, []byte(stdout), o.TargetTimeout); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if o.File == "" && o.Target == "" {
+		w := o.Stdout
+		if w == nil {
+			w = os.Stdout
+		}
+
+		fmt.Fprint(w, stdout)
+	}
+
+	if err := multiError(errs); err != nil {
+		return &FailureError{Class: FailureOutput, Err: err}
+	}
+
+	return nil
+}
+
+// Run is a run of the collector command: the samples collected by Scraper
+// are processed by Pipeline, checked against the thresholds and written to
+// Outputs.
+type Run struct {
+	// Scraper collects the samples, none being collected if nil, e.g. in
+	// dry runs only validating the options.
+	Scraper  Scraper
+	Pipeline Pipeline
+	// Warning and Critical are the thresholds of the check status, either
+	// may be nil.
+	Warning  *Threshold
+	Critical *Threshold
+	// EmptyResult is the check status of a run without samples.
+	EmptyResult int
+	// Extra are samples output after the status is checked, e.g. the build
+	// info, so they do not breach the thresholds or hide an empty result.
+	// Their types must be in Outputs.Config.MetricTypes.
+	Extra model.Vector
+	// MetaMetrics outputs the MetaMetrics samples of the run, after the
+	// status is checked.
+	MetaMetrics bool
+	Outputs     Outputs
+	// DryRun logs the number of samples rather than outputting them.
+	DryRun bool
+	// Scraped, if not nil, is called once the samples are collected from
+	// every target.
+	Scraped func()
+}
+
+// Collect collects, processes and outputs the samples, returning the check
+// status. When some targets fail to be scraped, the samples of the others
+// are output and the scrape error returned with the status. Canceling ctx
+// cancels the scrapes and queries in flight, the samples collected so far
+// still being output before ErrInterrupted is returned.
+func (r *Run) Collect(ctx context.Context) (int, error) {
+	var samples model.Vector
+	var matrix bool
+	queryStatus := CheckOK
+	var scrapeErr error
+	start := time.Now()
+
+	if r.Scraper == nil {
+		Debugf("Dry run: not collecting samples")
+	} else {
+		if scraper, ok := r.Scraper.(resultsScraper); ok {
+			var results *QueryResults
+			if results, scrapeErr = scraper.ScrapeResults(ctx); scrapeErr == nil {
+				samples, matrix, queryStatus = results.Samples, results.Matrix, results.Status
+			}
+		} else {
+			samples, scrapeErr = r.Scraper.Scrape(ctx)
+		}
+
+		if scrapeErr != nil {
+			scrapeErr = Classify(scrapeErr, FailureUnreachable)
+
+			if len(samples) == 0 || r.DryRun {
+				return 0, scrapeErr
+			}
+		} else if r.Scraped != nil {
+			r.Scraped()
+		}
+	}
+
+	meta := MetaMetrics{ScrapeDuration: time.Since(start), SamplesScraped: len(samples)}
+
+	LogFields{"samples": len(samples)}.Debugf("Collected %d samples", len(samples))
+
+	samples, selected, err := r.Pipeline.Process(samples, matrix)
+
+	if err != nil {
+		return 0, err
+	}
+
+	meta.SamplesFiltered = meta.SamplesScraped - selected
+
+	LogFields{"samples": len(samples)}.Debugf("Outputting %d samples", len(samples))
+
+	status := CheckStatus(samples, r.Warning, r.Critical)
+
+	if queryStatus > status {
+		status = queryStatus
+	}
+
+	if len(samples) == 0 {
+		status = r.EmptyResult
+	}
+
+	extra := append(model.Vector{}, r.Extra...)
+
+	if r.MetaMetrics {
+		extra = append(extra, meta.Samples(model.Now())...)
+
+		if r.Outputs.Config.MetricTypes != nil {
+			for _, name := range []string{ScrapeDurationMetric, SamplesScrapedMetric, SamplesFilteredMetric} {
+				r.Outputs.Config.MetricTypes[name] = "gauge"
+			}
+		}
+	}
+
+	if r.Pipeline.HostLabel != "" {
+		extra = AddLabel(extra, r.Pipeline.HostLabel, r.Pipeline.Host)
+	}
+
+	samples = append(samples, extra...)
+
+	if r.DryRun {
+		if r.Scraper == nil {
+			Infof("Dry run: the options are valid")
+		} else {
+			LogFields{"samples": len(samples)}.Infof("Dry run: the options are valid and the targets reachable, %d samples would be output", len(samples))
+		}
+
+		return 0, nil
+	}
+
+	if err := r.Outputs.Write(samples, status); err != nil {
+		return 0, err
+	}
+
+	if ctx.Err() != nil {
+		return 0, ErrInterrupted
+	}
+
+	return status, scrapeErr
+}
@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCollect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("node_load1 0.5 1506991200000\nnode_load5 0.25 1506991200000\n"))
+	}))
+	defer server.Close()
+
+	warning, err := ParseThreshold("value > 0.4")
+	assert.NoError(t, err)
+
+	var stdout bytes.Buffer
+	run := &Run{
+		Scraper: &ExporterScraper{
+			Targets:      []Target{{URL: server.URL}},
+			ParseOptions: ParseOptions{HonorTimestamps: true},
+		},
+		Pipeline: Pipeline{Filter: &FilterOptions{IncludeNames: "node_load1"}},
+		Warning:  warning,
+		Extra:    model.Vector{{Metric: model.Metric{model.MetricNameLabel: "extra"}, Value: 1, Timestamp: 1506991200000}},
+		Outputs: Outputs{
+			Formats: []string{"graphite"},
+			Config:  OutputConfig{TimestampPrecision: "s"},
+			Stdout:  &stdout,
+		},
+	}
+
+	status, err := run.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, CheckWarning, status)
+	assert.Equal(t, "node_load1 0.5 1506991200\nextra 1 1506991200\n", stdout.String())
+
+	// Dry runs output nothing.
+	stdout.Reset()
+	run.DryRun = true
+
+	status, err = run.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, CheckOK, status)
+	assert.Empty(t, stdout.String())
+
+	// The samples of the scraped targets are output with the error of the
+	// others.
+	run.DryRun = false
+	run.Scraper.(*ExporterScraper).Targets = append(run.Scraper.(*ExporterScraper).Targets, Target{URL: "http://127.0.0.1:1"})
+	run.Extra = nil
+	run.EmptyResult = CheckCritical
+
+	status, err = run.Collect(context.Background())
+	assert.Equal(t, CheckWarning, status)
+	assert.Contains(t, stdout.String(), "node_load1 0.5 1506991200\n")
+
+	var failure *FailureError
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureUnreachable, failure.Class)
+
+	// Runs without samples have the empty result status.
+	stdout.Reset()
+	run.Scraper = VectorScraper{}
+
+	status, err = run.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, CheckCritical, status)
+}
+
+func TestRunCollectOutputFailure(t *testing.T) {
+	var stdout bytes.Buffer
+	run := &Run{
+		Scraper: VectorScraper{{Metric: model.Metric{model.MetricNameLabel: "up"}, Value: 1}},
+		Outputs: Outputs{
+			Formats: []string{"sendtocarbon", "influx"},
+			Config:  OutputConfig{Carbon: CarbonConfig{Protocol: "plaintext", Address: "127.0.0.1:1"}},
+			Stdout:  &stdout,
+		},
+	}
+
+	// The other outputs still get the samples.
+	_, err := run.Collect(context.Background())
+	assert.Contains(t, stdout.String(), "up value=1")
+
+	var failure *FailureError
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureOutput, failure.Class)
+}
+
+func TestRunCollectRangeQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[` +
+			`{"metric":{"__name__":"up","job":"node"},"values":[[1506991200,"1"],[1506991260,"0"]]}]}}`))
+	}))
+	defer server.Close()
+
+	end := time.Unix(1506991260, 0)
+
+	var stdout bytes.Buffer
+	run := &Run{
+		Scraper: &PrometheusRangeScraper{URL: server.URL, Query: "up", Range: v1.Range{Start: end.Add(-time.Minute), End: end, Step: time.Minute}},
+		Outputs: Outputs{Formats: []string{"graphite"}, Config: OutputConfig{TimestampPrecision: "s"}, Stdout: &stdout},
+	}
+
+	// Every point of the range is output, not deduped.
+	_, err := run.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "up 1 1506991200\nup 0 1506991260\n", stdout.String())
+}
@@ -0,0 +1,177 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/common/model"
+)
+
+var (
+	// graphiteInvalidNameChars are the metric name characters that would
+	// split a Graphite path or line.
+	graphiteInvalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:.\-]`)
+	// statsdInvalidNameChars are the metric name characters that would be
+	// taken for the value, type or tags separators of a statsd line.
+	statsdInvalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.\-]`)
+)
+
+// NameSanitizer rewrites metric names into the character set and length
+// an output accepts.
+type NameSanitizer struct {
+	// Invalid matches the characters replaced with Replacement.
+	Invalid     *regexp.Regexp
+	Replacement string
+	Lowercase   bool
+	// MaxLength is the maximum name length in bytes, 0 is unlimited.
+	MaxLength int
+}
+
+// NameSanitizerOption is an option of the name sanitizer of an output, or
+// of every output when Output is empty.
+type NameSanitizerOption struct {
+	Output string
+	Name   string
+	Value  string
+	regexp *regexp.Regexp
+}
+
+// DefaultNameSanitizer is the name sanitizer of an output format, replacing
+// the characters that would corrupt graphite and statsd lines with
+// underscores.
+func DefaultNameSanitizer(outputFormat string) NameSanitizer {
+	switch outputFormat {
+	case "graphite", "graphite-tagged", "sendtocarbon":
+		return NameSanitizer{Invalid: graphiteInvalidNameChars, Replacement: "_"}
+	case "sendtostatsd":
+		return NameSanitizer{Invalid: statsdInvalidNameChars, Replacement: "_"}
+	default:
+		return NameSanitizer{Replacement: "_"}
+	}
+}
+
+// ParseNameSanitizerOptions parses [<output>:]<option>[=<value>] name
+// sanitizer options, with option one of invalid, a regex, replacement,
+// lowercase, true if no value is given, or max-length.
+func ParseNameSanitizerOptions(options []string) ([]NameSanitizerOption, error) {
+	var parsed []NameSanitizerOption
+
+	for _, option := range options {
+		var o NameSanitizerOption
+
+		kv := strings.SplitN(option, "=", 2)
+		o.Name = kv[0]
+
+		if i := strings.Index(o.Name, ":"); i >= 0 {
+			o.Output, o.Name = o.Name[:i], o.Name[i+1:]
+		}
+
+		if len(kv) == 2 {
+			o.Value = kv[1]
+		}
+
+		switch o.Name {
+		case "invalid":
+			if o.Value != "" {
+				re, err := regexp.Compile(o.Value)
+
+				if err != nil {
+					return nil, fmt.Errorf("invalid name sanitizer option %q: %v", option, err)
+				}
+
+				o.regexp = re
+			}
+		case "replacement":
+		case "lowercase":
+			if len(kv) == 1 {
+				o.Value = "true"
+			}
+
+			if _, err := strconv.ParseBool(o.Value); err != nil {
+				return nil, fmt.Errorf("invalid name sanitizer option %q, expected lowercase=true or false", option)
+			}
+		case "max-length":
+			if n, err := strconv.Atoi(o.Value); err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid name sanitizer option %q, expected a max-length of 0 or more", option)
+			}
+		default:
+			return nil, fmt.Errorf("unknown name sanitizer option %q, expected invalid, replacement, lowercase or max-length", option)
+		}
+
+		parsed = append(parsed, o)
+	}
+
+	return parsed, nil
+}
+
+// OutputNameSanitizer returns the DefaultNameSanitizer of the message
+// format with the options of every output and of the output format
+// applied, in order.
+func OutputNameSanitizer(config OutputConfig, options []NameSanitizerOption) NameSanitizer {
+	sanitizer := DefaultNameSanitizer(MessageFormat(config))
+
+	for _, option := range options {
+		if option.Output != "" && option.Output != config.Format {
+			continue
+		}
+
+		switch option.Name {
+		case "invalid":
+			sanitizer.Invalid = option.regexp
+		case "replacement":
+			sanitizer.Replacement = option.Value
+		case "lowercase":
+			sanitizer.Lowercase, _ = strconv.ParseBool(option.Value)
+		case "max-length":
+			sanitizer.MaxLength, _ = strconv.Atoi(option.Value)
+		}
+	}
+
+	return sanitizer
+}
+
+// Sanitize returns the name lowercased, with the invalid characters
+// replaced and cut to the maximum length.
+func (s NameSanitizer) Sanitize(name string) string {
+	if s.Lowercase {
+		name = strings.ToLower(name)
+	}
+
+	if s.Invalid != nil {
+		name = s.Invalid.ReplaceAllLiteralString(name, s.Replacement)
+	}
+
+	if s.MaxLength > 0 && len(name) > s.MaxLength {
+		end := s.MaxLength
+		for end > 0 && !utf8.RuneStart(name[end]) {
+			end--
+		}
+		name = name[:end]
+	}
+
+	return name
+}
+
+// SanitizeSampleNames returns the samples with sanitized metric names, the
+// samples whose name changes are copied.
+func SanitizeSampleNames(samples model.Vector, sanitizer NameSanitizer) model.Vector {
+	sanitized := make(model.Vector, 0, len(samples))
+
+	for _, sample := range samples {
+		name := sample.Metric[model.MetricNameLabel]
+
+		if sanitizedName := model.LabelValue(sanitizer.Sanitize(string(name))); sanitizedName != name {
+			copied := *sample
+			copied.Metric = sample.Metric.Clone()
+			copied.Metric[model.MetricNameLabel] = sanitizedName
+			sample = &copied
+		}
+
+		sanitized = append(sanitized, sample)
+	}
+
+	return sanitized
+}
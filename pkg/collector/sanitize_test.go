@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNameSanitizer(t *testing.T) {
+	assert.Equal(t, "job_rate5m.total", DefaultNameSanitizer("sendtostatsd").Sanitize("job:rate5m.total"))
+	assert.Equal(t, "job:rate5m_total", DefaultNameSanitizer("graphite").Sanitize("job:rate5m total"))
+	assert.Equal(t, "job:rate5m total", DefaultNameSanitizer("influx").Sanitize("job:rate5m total"))
+
+	sanitizer := NameSanitizer{Lowercase: true, MaxLength: 6}
+	assert.Equal(t, "node_l", sanitizer.Sanitize("Node_Load1"))
+
+	// Names are not cut in the middle of a character.
+	assert.Equal(t, "node_", NameSanitizer{MaxLength: 6}.Sanitize("node_é"))
+}
+
+func TestOutputNameSanitizer(t *testing.T) {
+	options, err := ParseNameSanitizerOptions([]string{"lowercase", "sendtostatsd:invalid=[^a-z_]", "sendtostatsd:replacement=", "graphite:max-length=8", "graphite:lowercase=false"})
+	assert.NoError(t, err)
+
+	statsd := OutputNameSanitizer(OutputConfig{Format: "sendtostatsd"}, options)
+	assert.Equal(t, "jobratemtotal", statsd.Sanitize("Job:rate5m.total"))
+
+	graphite := OutputNameSanitizer(OutputConfig{Format: "graphite"}, options)
+	assert.Equal(t, "Job:rate", graphite.Sanitize("Job:rate5m total"))
+
+	// The defaults follow the message format of message bus outputs.
+	nats := OutputNameSanitizer(OutputConfig{Format: "sendtonats", NATS: NATSConfig{Format: "graphite"}}, nil)
+	assert.Equal(t, "job_rate", nats.Sanitize("job rate"))
+
+	for _, option := range []string{"invalid=[", "lowercase=maybe", "max-length=-1", "uppercase"} {
+		_, err := ParseNameSanitizerOptions([]string{option})
+		assert.Error(t, err, option)
+	}
+}
+
+func TestSanitizeSampleNames(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "job:up", "job": "node"}, Value: 1},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "job": "node"}, Value: 1},
+	}
+
+	sanitized := SanitizeSampleNames(samples, DefaultNameSanitizer("sendtostatsd"))
+
+	assert.Equal(t, model.LabelValue("job_up"), sanitized[0].Metric[model.MetricNameLabel])
+	assert.Equal(t, model.LabelValue("node"), sanitized[0].Metric["job"])
+	assert.Equal(t, samples[1], sanitized[1])
+
+	// The samples are copied, not modified.
+	assert.Equal(t, model.LabelValue("job:up"), samples[0].Metric[model.MetricNameLabel])
+}
@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// SecretFlags are the flags of credentials which may instead be read from
+// the file of a <flag>-file flag, keeping them out of ps output and check
+// definitions.
+var SecretFlags = []string{
+	"exporter-password",
+	"exporter-authorization",
+	"exporter-oauth2-client-secret",
+	"prom-password",
+	"prom-oauth2-client-secret",
+	"influxdb-token",
+	"nats-url",
+	"mqtt-password",
+	"amqp-url",
+	"azure-client-secret",
+	"datadog-api-key",
+	"sensu-api-key",
+}
+
+// ReadSecretFile reads a secret from a file, without the trailing newline
+// most editors and echo add.
+func ReadSecretFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %v", err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// ApplySecretFiles sets the named flags to the secrets read from the files
+// of their <name>-file flags, if given. Setting both a flag and its file is
+// an error, rather than silently preferring one.
+func ApplySecretFiles(flags *flag.FlagSet, names []string) error {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for _, name := range names {
+		fileFlag := flags.Lookup(name + "-file")
+
+		if fileFlag == nil || fileFlag.Value.String() == "" {
+			continue
+		}
+
+		if set[name] {
+			return fmt.Errorf("-%s and -%s-file are mutually exclusive", name, name)
+		}
+
+		secret, err := ReadSecretFile(fileFlag.Value.String())
+
+		if err != nil {
+			return fmt.Errorf("-%s-file: %v", name, err)
+		}
+
+		if err := flags.Lookup(name).Value.Set(secret); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSecretFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "password")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(" s3cret \r\n"), 0600))
+
+	secret, err := ReadSecretFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, " s3cret ", secret)
+
+	_, err = ReadSecretFile(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestApplySecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "password")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("s3cret\n"), 0600))
+
+	newFlags := func() (*flag.FlagSet, *string, *string) {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		password := flags.String("password", "", "")
+		flags.String("password-file", "", "")
+		url := flags.String("url", "nats://localhost:4222", "")
+		flags.String("url-file", "", "")
+		return flags, password, url
+	}
+
+	flags, password, url := newFlags()
+	assert.NoError(t, flags.Parse([]string{"-password-file", path}))
+	assert.NoError(t, ApplySecretFiles(flags, []string{"password", "url"}))
+	assert.Equal(t, "s3cret", *password)
+	assert.Equal(t, "nats://localhost:4222", *url)
+
+	flags, _, url = newFlags()
+	assert.NoError(t, flags.Parse([]string{"-url-file", path}))
+	assert.NoError(t, ApplySecretFiles(flags, []string{"password", "url"}))
+	assert.Equal(t, "s3cret", *url)
+
+	flags, _, _ = newFlags()
+	assert.NoError(t, flags.Parse([]string{"-password", "plain", "-password-file", path}))
+	assert.EqualError(t, ApplySecretFiles(flags, []string{"password"}), "-password and -password-file are mutually exclusive")
+
+	flags, _, _ = newFlags()
+	assert.NoError(t, flags.Parse([]string{"-password-file", filepath.Join(dir, "missing")}))
+	assert.Error(t, ApplySecretFiles(flags, []string{"password"}))
+}
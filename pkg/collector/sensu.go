@@ -0,0 +1,434 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// SensuObjectMeta is the metadata of a Sensu Go resource.
+type SensuObjectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// SensuEntity is the entity of a Sensu Go event.
+type SensuEntity struct {
+	EntityClass string          `json:"entity_class"`
+	ObjectMeta  SensuObjectMeta `json:"metadata"`
+}
+
+// SensuCheck is the check of a Sensu Go event.
+type SensuCheck struct {
+	ObjectMeta SensuObjectMeta `json:"metadata"`
+	Status     uint32          `json:"status"`
+	Output     string          `json:"output"`
+	Handlers   []string        `json:"handlers,omitempty"`
+}
+
+// SensuMetricTag is a tag of a Sensu Go metric point.
+type SensuMetricTag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SensuMetricPoint is a Sensu Go metric point.
+type SensuMetricPoint struct {
+	Name      string           `json:"name"`
+	Value     float64          `json:"value"`
+	Timestamp int64            `json:"timestamp"`
+	Tags      []SensuMetricTag `json:"tags"`
+}
+
+// SensuMetrics are the metrics of a Sensu Go event.
+type SensuMetrics struct {
+	Handlers []string           `json:"handlers,omitempty"`
+	Points   []SensuMetricPoint `json:"points"`
+}
+
+// SensuEvent is a Sensu Go event carrying metrics.
+type SensuEvent struct {
+	Entity  *SensuEntity  `json:"entity,omitempty"`
+	Check   *SensuCheck   `json:"check,omitempty"`
+	Metrics *SensuMetrics `json:"metrics,omitempty"`
+}
+
+// SensuAnnotationPrefix is the prefix of the check and entity annotations
+// overriding options, followed by the option name, e.g.
+// sensu.io/plugins/prometheus-collector/config/include-names.
+const SensuAnnotationPrefix = "sensu.io/plugins/prometheus-collector/config/"
+
+// SensuAnnotationOptions are the options annotations may override, like
+// the options of the Sensu plugin SDK marked for annotations: filters,
+// thresholds and the presentation of the samples. Anyone able to annotate
+// an entity must not be able to choose where the collector sends requests,
+// credentials or outputs, or which files it reads and writes, nor expand
+// Go templates, whose env function reads the collector environment, as
+// -metric-prefix does.
+var SensuAnnotationOptions = []string{
+	"warning", "critical", "empty-result",
+	"include-regex", "exclude-regex", "include-names", "exclude-names", "match",
+	"drop-non-finite", "min-value", "max-value", "keep-labels", "drop-labels",
+	"duplicate-samples", "max-samples", "max-samples-action",
+	"summary-policy", "histogram-policy", "family-policy",
+	"aggregate", "unit-conversion", "value-transform", "name-sanitizer",
+	"add-host-tag", "host-tag-name", "global-tags", "influx-measurement", "json-schema", "graphite-template", "statsd-type",
+	"timestamp-precision", "honor-timestamps", "exemplars",
+	"scrape-timeout", "query-timeout", "build-info", "meta-metrics", "log-level",
+}
+
+// SensuConfig configures the sensu-agent and sensu-backend outputs.
+type SensuConfig struct {
+	// AgentURL is the Sensu agent events API URL.
+	AgentURL string
+	// BackendURL is the Sensu backend API URL, events are created in
+	// Namespace for the proxy entity named Entity, authenticating with
+	// APIKey.
+	BackendURL string
+	Namespace  string
+	APIKey     string
+	Entity     string
+	CheckName  string
+	// Handlers are the handlers of the event metrics.
+	Handlers  []string
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+}
+
+// CreateSensuMetricPoints converts samples to Sensu metric points, with the
+// labels and global tags as tags. JSON cannot carry NaN or infinite values,
+// so those samples are skipped.
+func CreateSensuMetricPoints(samples model.Vector, metricPrefix string, globalTags []GlobalTag, timestampPrecision string) []SensuMetricPoint {
+	var tags []SensuMetricTag
+	for _, tag := range globalTags {
+		tags = append(tags, SensuMetricTag{Name: tag.Name, Value: tag.Value})
+	}
+
+	points := []SensuMetricPoint{}
+
+	for _, sample := range samples {
+		value := float64(sample.Value)
+
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		point := SensuMetricPoint{
+			Name:      fmt.Sprintf("%s%s", metricPrefix, sample.Metric["__name__"]),
+			Value:     value,
+			Timestamp: FormatTimestamp(sample.Timestamp, timestampPrecision),
+			Tags:      append([]SensuMetricTag{}, tags...),
+		}
+
+		for _, name := range sortedLabelNames(sample.Metric) {
+			point.Tags = append(point.Tags, SensuMetricTag{Name: string(name), Value: string(sample.Metric[name])})
+		}
+
+		points = append(points, point)
+	}
+
+	return points
+}
+
+// CreateSensuEvent returns an event of the check named in config, of the
+// config status, with the samples as metric points.
+func CreateSensuEvent(samples model.Vector, config OutputConfig) *SensuEvent {
+	points := CreateSensuMetricPoints(samples, config.MetricPrefix, config.GlobalTags, config.TimestampPrecision)
+
+	return &SensuEvent{
+		Check: &SensuCheck{
+			ObjectMeta: SensuObjectMeta{Name: config.Sensu.CheckName},
+			Status:     uint32(config.Status),
+			Output:     fmt.Sprintf("collected %d metric points", len(points)),
+		},
+		Metrics: &SensuMetrics{
+			Handlers: config.Sensu.Handlers,
+			Points:   points,
+		},
+	}
+}
+
+// SendToSensuAgent posts samples as an event to the Sensu agent events
+// API.
+func SendToSensuAgent(samples model.Vector, config OutputConfig) error {
+	client := &http.Client{Timeout: config.Sensu.Timeout}
+
+	return postSensuEvent(client, "POST", config.Sensu.AgentURL, "", CreateSensuEvent(samples, config))
+}
+
+// SendToSensuBackend creates or updates the event of the configured proxy
+// entity and check through the Sensu backend events API.
+func SendToSensuBackend(samples model.Vector, config OutputConfig) error {
+	sensuConfig := config.Sensu
+
+	if sensuConfig.Entity == "" {
+		return errors.New("a Sensu entity name is required")
+	}
+
+	event := CreateSensuEvent(samples, config)
+	event.Entity = &SensuEntity{
+		EntityClass: "proxy",
+		ObjectMeta:  SensuObjectMeta{Name: sensuConfig.Entity, Namespace: sensuConfig.Namespace},
+	}
+	event.Check.ObjectMeta.Namespace = sensuConfig.Namespace
+
+	eventURL := fmt.Sprintf("%s/api/core/v2/namespaces/%s/events/%s/%s",
+		strings.TrimSuffix(sensuConfig.BackendURL, "/"),
+		url.PathEscape(sensuConfig.Namespace),
+		url.PathEscape(sensuConfig.Entity),
+		url.PathEscape(sensuConfig.CheckName))
+
+	authorization := ""
+	if sensuConfig.APIKey != "" {
+		authorization = "Key " + sensuConfig.APIKey
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: sensuConfig.TLSConfig,
+		},
+		Timeout: sensuConfig.Timeout,
+	}
+	defer client.CloseIdleConnections()
+
+	return postSensuEvent(client, "PUT", eventURL, authorization, event)
+}
+
+func postSensuEvent(client *http.Client, method string, eventURL string, authorization string, event *SensuEvent) error {
+	body, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, eventURL, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return errors.New("sensu returned non 2xx HTTP response status: " + resp.Status + ": " + strings.TrimSpace(string(respBody)))
+	}
+
+	return nil
+}
+
+// ReadSensuEvent decodes a Sensu Go event, as passed to handlers on stdin.
+func ReadSensuEvent(r io.Reader) (*SensuEvent, error) {
+	event := &SensuEvent{}
+
+	if err := json.NewDecoder(r).Decode(event); err != nil {
+		return nil, fmt.Errorf("failed to decode Sensu event: %v", err)
+	}
+
+	return event, nil
+}
+
+// SensuEventSamples converts the metric points of a Sensu event to samples,
+// with the tags as labels. Characters not allowed in Prometheus metric and
+// label names are replaced with underscores.
+func SensuEventSamples(event *SensuEvent) model.Vector {
+	samples := model.Vector{}
+
+	if event.Metrics == nil {
+		return samples
+	}
+
+	for _, point := range event.Metrics.Points {
+		samples = append(samples, sensuPointSample(point))
+	}
+
+	return samples
+}
+
+func sensuPointSample(point SensuMetricPoint) *model.Sample {
+	metric := model.Metric{model.MetricNameLabel: model.LabelValue(sanitizeSensuName(point.Name))}
+
+	for _, tag := range point.Tags {
+		metric[model.LabelName(sanitizeSensuName(tag.Name))] = model.LabelValue(tag.Value)
+	}
+
+	return &model.Sample{
+		Metric:    metric,
+		Value:     model.SampleValue(point.Value),
+		Timestamp: sensuTimestamp(point.Timestamp),
+	}
+}
+
+// MutateSensuEvent reads a Sensu Go event, as passed to mutators on stdin,
+// and writes it to w keeping only the metric points whose samples filter
+// keeps. The rest of the event, and the kept points, are written unchanged.
+func MutateSensuEvent(r io.Reader, w io.Writer, filter SampleFilter) error {
+	var event map[string]json.RawMessage
+
+	if err := json.NewDecoder(r).Decode(&event); err != nil {
+		return fmt.Errorf("failed to decode Sensu event: %v", err)
+	}
+
+	var metrics map[string]json.RawMessage
+	var rawPoints []json.RawMessage
+
+	if rawMetrics, ok := event["metrics"]; ok && string(rawMetrics) != "null" {
+		if err := json.Unmarshal(rawMetrics, &metrics); err != nil {
+			return fmt.Errorf("failed to decode Sensu event metrics: %v", err)
+		}
+
+		if points, ok := metrics["points"]; ok {
+			if err := json.Unmarshal(points, &rawPoints); err != nil {
+				return fmt.Errorf("failed to decode Sensu event metric points: %v", err)
+			}
+		}
+	}
+
+	if len(rawPoints) > 0 {
+		samples := model.Vector{}
+		pointsBySample := map[*model.Sample]json.RawMessage{}
+
+		for _, rawPoint := range rawPoints {
+			var point SensuMetricPoint
+
+			if err := json.Unmarshal(rawPoint, &point); err != nil {
+				return fmt.Errorf("failed to decode Sensu event metric point: %v", err)
+			}
+
+			sample := sensuPointSample(point)
+			samples = append(samples, sample)
+			pointsBySample[sample] = rawPoint
+		}
+
+		filteredSamples, err := filter(samples)
+
+		if err != nil {
+			return err
+		}
+
+		keptPoints := []json.RawMessage{}
+		for _, sample := range filteredSamples {
+			keptPoints = append(keptPoints, pointsBySample[sample])
+		}
+
+		if metrics["points"], err = json.Marshal(keptPoints); err != nil {
+			return err
+		}
+
+		if event["metrics"], err = json.Marshal(metrics); err != nil {
+			return err
+		}
+	}
+
+	return json.NewEncoder(w).Encode(event)
+}
+
+// sensuInvalidNameChars matches the characters not allowed in Prometheus
+// metric and label names, allowing colons.
+var sensuInvalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+func sanitizeSensuName(name string) string {
+	name = sensuInvalidNameChars.ReplaceAllString(name, "_")
+
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// sensuTimestamp converts a metric point timestamp, which checks may give
+// in seconds, milliseconds, microseconds or nanoseconds, to a sample
+// timestamp.
+func sensuTimestamp(timestamp int64) model.Time {
+	switch {
+	case timestamp > 1e17:
+		return model.TimeFromUnixNano(timestamp)
+	case timestamp > 1e14:
+		return model.TimeFromUnixNano(timestamp * 1e3)
+	case timestamp > 1e11:
+		return model.Time(timestamp)
+	default:
+		return model.TimeFromUnix(timestamp)
+	}
+}
+
+// ApplySensuAnnotations overrides options in flags with the values of the
+// SensuAnnotationPrefix annotations of the event check and then entity, so
+// entity annotations take precedence, like the Sensu plugin SDK. Unlike
+// config file values, annotations also override options given on the
+// command line, replacing rather than adding to repeatable options.
+// Annotations of options other than SensuAnnotationOptions are rejected,
+// rather than ignored, as they would not take effect.
+func ApplySensuAnnotations(event *SensuEvent, flags *flag.FlagSet) error {
+	allowed := make(map[string]bool, len(SensuAnnotationOptions))
+	for _, name := range SensuAnnotationOptions {
+		allowed[name] = true
+	}
+
+	var annotationSources []map[string]string
+
+	if event.Check != nil {
+		annotationSources = append(annotationSources, event.Check.ObjectMeta.Annotations)
+	}
+
+	if event.Entity != nil {
+		annotationSources = append(annotationSources, event.Entity.ObjectMeta.Annotations)
+	}
+
+	for _, annotations := range annotationSources {
+		keys := make([]string, 0, len(annotations))
+		for key := range annotations {
+			if strings.HasPrefix(key, SensuAnnotationPrefix) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			name := strings.TrimPrefix(key, SensuAnnotationPrefix)
+			f := flags.Lookup(name)
+
+			if f == nil || !allowed[name] {
+				return &FailureError{Class: FailureConfig, Err: fmt.Errorf("option %q of annotation %s cannot be overridden by annotations", name, key)}
+			}
+
+			if list, ok := f.Value.(interface{ Reset() }); ok {
+				list.Reset()
+			}
+
+			if err := flags.Set(name, annotations[key]); err != nil {
+				return fmt.Errorf("invalid value for option %q in annotation %s: %v", name, key, err)
+			}
+		}
+	}
+
+	return nil
+}
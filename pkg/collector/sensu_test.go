@@ -0,0 +1,196 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendToSensuAgent(t *testing.T) {
+	var event SensuEvent
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/events", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "up", "job": "node"}, Value: 1, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "ratio"}, Value: model.SampleValue(math.NaN()), Timestamp: model.Time(1506991233000)},
+	}
+
+	config := OutputConfig{
+		GlobalTags:         []GlobalTag{{Name: "dc", Value: "eu"}},
+		TimestampPrecision: "s",
+		Status:             CheckWarning,
+		Sensu:              SensuConfig{AgentURL: ts.URL + "/events", CheckName: "prometheus-collector", Handlers: []string{"influxdb"}},
+	}
+
+	err := SendToSensuAgent(samples, config)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "prometheus-collector", event.Check.ObjectMeta.Name)
+	assert.Equal(t, uint32(CheckWarning), event.Check.Status)
+	assert.Equal(t, []string{"influxdb"}, event.Metrics.Handlers)
+	assert.Equal(t, []SensuMetricPoint{{
+		Name:      "up",
+		Value:     1,
+		Timestamp: 1506991233,
+		Tags:      []SensuMetricTag{{Name: "dc", Value: "eu"}, {Name: "job", Value: "node"}},
+	}}, event.Metrics.Points)
+}
+
+func TestSendToSensuAgentError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	err := SendToSensuAgent(model.Vector{}, OutputConfig{Sensu: SensuConfig{AgentURL: ts.URL, CheckName: "prometheus-collector"}})
+
+	assert.EqualError(t, err, "sensu returned non 2xx HTTP response status: 400 Bad Request: invalid event")
+}
+
+func TestSendToSensuBackend(t *testing.T) {
+	var event SensuEvent
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PUT", r.Method)
+		assert.Equal(t, "/api/core/v2/namespaces/ops/events/server1/prometheus-collector", r.URL.Path)
+		assert.Equal(t, "Key secret", r.Header.Get("Authorization"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	samples := model.Vector{{Metric: model.Metric{model.MetricNameLabel: "up"}, Value: 1, Timestamp: model.Time(1506991233000)}}
+
+	config := OutputConfig{
+		TimestampPrecision: "s",
+		Sensu:              SensuConfig{BackendURL: ts.URL, Namespace: "ops", APIKey: "secret", Entity: "server1", CheckName: "prometheus-collector"},
+	}
+
+	err := SendToSensuBackend(samples, config)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &SensuEntity{EntityClass: "proxy", ObjectMeta: SensuObjectMeta{Name: "server1", Namespace: "ops"}}, event.Entity)
+	assert.Equal(t, "ops", event.Check.ObjectMeta.Namespace)
+	assert.Len(t, event.Metrics.Points, 1)
+
+	config.Sensu.Entity = ""
+	assert.Error(t, SendToSensuBackend(samples, config))
+}
+
+func TestSensuEventSamples(t *testing.T) {
+	eventJSON := `{
+  "entity": {"metadata": {"name": "server1"}},
+  "check": {"metadata": {"name": "disk"}, "status": 0},
+  "metrics": {
+    "handlers": ["prometheus-collector"],
+    "points": [
+      {"name": "disk.used_percent", "value": 42.5, "timestamp": 1506991233, "tags": [{"name": "mount.point", "value": "/"}]},
+      {"name": "disk.free_bytes", "value": 1024, "timestamp": 1506991233123, "tags": []}
+    ]
+  }
+}`
+
+	event, err := ReadSensuEvent(strings.NewReader(eventJSON))
+	assert.NoError(t, err)
+
+	samples := SensuEventSamples(event)
+
+	assert.Equal(t, model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "disk_used_percent", "mount_point": "/"}, Value: 42.5, Timestamp: model.Time(1506991233000)},
+		{Metric: model.Metric{model.MetricNameLabel: "disk_free_bytes"}, Value: 1024, Timestamp: model.Time(1506991233123)},
+	}, samples)
+
+	_, err = ReadSensuEvent(strings.NewReader("not an event"))
+	assert.Error(t, err)
+}
+
+func TestMutateSensuEvent(t *testing.T) {
+	eventJSON := `{"check":{"metadata":{"name":"node"},"status":0},"metrics":{"handlers":["influxdb"],"points":[` +
+		`{"name":"node.load1","value":0.5,"timestamp":1506991233,"tags":[]},` +
+		`{"name":"node.load5","value":0.25,"timestamp":1506991233,"tags":[{"name":"cpu","value":"all"}]},` +
+		`{"name":"go.goroutines","value":8,"timestamp":1506991233,"tags":null}]}}`
+
+	filter := func(samples model.Vector) (model.Vector, error) {
+		return FilterSamples(samples, "node_", "load5")
+	}
+
+	var out bytes.Buffer
+	err := MutateSensuEvent(strings.NewReader(eventJSON), &out, filter)
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{"check":{"metadata":{"name":"node"},"status":0},"metrics":{"handlers":["influxdb"],"points":[`+
+		`{"name":"node.load1","value":0.5,"timestamp":1506991233,"tags":[]}]}}`+"\n", out.String())
+
+	out.Reset()
+	err = MutateSensuEvent(strings.NewReader(`{"check":{"metadata":{"name":"node"}}}`), &out, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"check":{"metadata":{"name":"node"}}}`+"\n", out.String())
+
+	err = MutateSensuEvent(strings.NewReader(eventJSON), &out, func(samples model.Vector) (model.Vector, error) {
+		return FilterSamples(samples, "(", "")
+	})
+	assert.Error(t, err)
+}
+
+func TestApplySensuAnnotations(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	var keepLabels StringList
+	flags.Var(&keepLabels, "keep-labels", "")
+	critical := flags.String("critical", "", "")
+	metricPrefix := flags.String("metric-prefix", "", "")
+	flags.String("exporter-url", "", "")
+	flags.String("output-file", "", "")
+	flags.String("config", "", "")
+	flags.String("exit-code", "", "")
+	flags.Bool("honor-timestamps", true, "")
+	assert.NoError(t, flags.Parse([]string{"-keep-labels", "instance", "-metric-prefix", "node."}))
+
+	event, err := ReadSensuEvent(strings.NewReader(`{
+  "entity": {"metadata": {"name": "server1", "annotations": {
+    "sensu.io/plugins/prometheus-collector/config/critical": "value > 0.95"
+  }}},
+  "check": {"metadata": {"name": "node", "annotations": {
+    "sensu.io/plugins/prometheus-collector/config/keep-labels": "job,mountpoint",
+    "sensu.io/plugins/prometheus-collector/config/critical": "value > 0.9",
+    "sensu.io/plugins/other/config/metric-prefix": "other."
+  }}}
+}`))
+	assert.NoError(t, err)
+
+	assert.NoError(t, ApplySensuAnnotations(event, flags))
+	assert.Equal(t, StringList{"job", "mountpoint"}, keepLabels)
+	assert.Equal(t, "value > 0.95", *critical)
+	assert.Equal(t, "node.", *metricPrefix)
+
+	for _, name := range []string{"exporter-url", "output-file", "metric-prefix", "config", "exit-code", "unknown"} {
+		event.Check.ObjectMeta.Annotations = map[string]string{SensuAnnotationPrefix + name: "x"}
+		err = ApplySensuAnnotations(event, flags)
+		assert.EqualError(t, err, fmt.Sprintf("option %q of annotation %s cannot be overridden by annotations", name, SensuAnnotationPrefix+name))
+
+		var failure *FailureError
+		assert.True(t, errors.As(err, &failure))
+		assert.Equal(t, FailureConfig, failure.Class)
+	}
+
+	event.Check.ObjectMeta.Annotations = map[string]string{SensuAnnotationPrefix + "honor-timestamps": "maybe"}
+	assert.Error(t, ApplySensuAnnotations(event, flags))
+}
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+const (
+	// socketMaxDatagramSize is the maximum size of the datagrams sent to
+	// udp and unixgram targets, keeping them within an ethernet frame.
+	socketMaxDatagramSize = 1432
+)
+
+// SendToSocket sends data, a sequence of newline terminated lines, to the
+// tcp://host:port, udp://host:port, unix:///path or unixgram:///path
+// target. Datagrams carry whole lines, as many as fit.
+func SendToSocket(target string, data []byte, timeout time.Duration) error {
+	targetURL, err := url.Parse(target)
+
+	if err != nil {
+		return err
+	}
+
+	var address string
+	switch targetURL.Scheme {
+	case "tcp", "udp":
+		address = targetURL.Host
+	case "unix", "unixgram":
+		address = targetURL.Path
+	default:
+		return fmt.Errorf("unsupported output target %q, expected tcp://, udp://, unix:// or unixgram://", target)
+	}
+
+	conn, err := net.DialTimeout(targetURL.Scheme, address, timeout)
+
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if targetURL.Scheme == "tcp" || targetURL.Scheme == "unix" {
+		_, err = conn.Write(data)
+		return err
+	}
+
+	for len(data) > 0 {
+		datagram := data
+
+		if len(datagram) > socketMaxDatagramSize {
+			if i := bytes.LastIndexByte(datagram[:socketMaxDatagramSize], '\n'); i >= 0 {
+				datagram = datagram[:i+1]
+			} else if i := bytes.IndexByte(datagram, '\n'); i >= 0 {
+				datagram = datagram[:i+1]
+			}
+		}
+
+		if _, err := conn.Write(datagram); err != nil {
+			return err
+		}
+
+		data = data[len(datagram):]
+	}
+
+	return nil
+}
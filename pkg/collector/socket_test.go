@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendToSocketTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	err = SendToSocket("tcp://"+listener.Addr().String(), []byte("foo value=1 1506991233\n"), time.Second)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "foo value=1 1506991233\n", <-received)
+}
+
+func TestSendToSocketUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	line := "foo value=1 1506991233" + strings.Repeat(" ", 100) + "\n"
+	data := strings.Repeat(line, 20)
+
+	err = SendToSocket("udp://"+conn.LocalAddr().String(), []byte(data), time.Second)
+	assert.NoError(t, err)
+
+	received := ""
+	buf := make([]byte, 65536)
+	for len(received) < len(data) {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.True(t, n <= socketMaxDatagramSize)
+		assert.True(t, strings.HasSuffix(string(buf[:n]), "\n"))
+		received += string(buf[:n])
+	}
+
+	assert.Equal(t, data, received)
+
+	assert.EqualError(t, SendToSocket("http://localhost", nil, time.Second), `unsupported output target "http://localhost", expected tcp://, udp://, unix:// or unixgram://`)
+}
@@ -0,0 +1,474 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// The defaults of the sendtostatsd packet size and send queue options.
+const (
+	DefaultStatsdMaxPacketSize = 1432
+	DefaultStatsdSendQueueSize = 10
+)
+
+// StatsdConfig configures the sendtostatsd output.
+type StatsdConfig struct {
+	// Protocol is udp, tcp, unix or unixgram. Host is the socket path for
+	// unix and unixgram.
+	Protocol  string
+	Host      string
+	Port      string
+	TagFormat string
+	TypeRules []StatsdTypeRule
+	Options   StatsdClientOptions
+}
+
+// StatsdClientOptions tunes how the statsd client batches and sends lines.
+type StatsdClientOptions struct {
+	// MaxPacketSize is the maximum size of a batch of lines, 1432 bytes
+	// when zero so that UDP packets are not fragmented on Ethernet.
+	MaxPacketSize int
+	// FlushInterval sends buffered lines once they are this old, rather
+	// than waiting for a full packet. Zero disables the interval.
+	FlushInterval time.Duration
+	// SendQueueSize is the number of packets queued for sending. Callers
+	// wait for room in a full queue rather than dropping packets.
+	SendQueueSize int
+	// Timeout bounds connecting and writing every packet, so that a stalled
+	// server fails the output rather than blocking it. Zero disables it.
+	Timeout time.Duration
+}
+
+// StatsdTag is a statsd metric tag.
+type StatsdTag struct {
+	Name  string
+	Value string
+}
+
+// StatsdTagFormat describes how tags are appended to a statsd line, either
+// after the metric name or as a suffix after the metric type.
+type StatsdTagFormat struct {
+	Suffix            bool
+	FirstSeparator    string
+	OtherSeparator    string
+	KeyValueSeparator string
+}
+
+// statsdTagFormats are the supported statsd tag formats, tags are not sent
+// in the none format.
+var statsdTagFormats = map[string]*StatsdTagFormat{
+	// https://docs.datadoghq.com/developers/dogstatsd/datagram_shell/
+	"datadog": {Suffix: true, FirstSeparator: "|#", OtherSeparator: ",", KeyValueSeparator: ":"},
+	// https://github.com/influxdata/telegraf/tree/master/plugins/inputs/statsd
+	"influx": {FirstSeparator: ",", OtherSeparator: ",", KeyValueSeparator: "="},
+	// https://graphite.readthedocs.io/en/latest/tags.html
+	"graphite": {FirstSeparator: ";", OtherSeparator: ";", KeyValueSeparator: "="},
+	"none":     nil,
+}
+
+// StatsdClient writes statsd lines to a udp, tcp, unix or unixgram socket.
+// Lines are batched into packets of at most MaxPacketSize bytes, which are
+// written by a sender goroutine from the send queue. A packet failing to be
+// written is written again once on a new connection.
+type StatsdClient struct {
+	protocol      string
+	addr          string
+	timeout       time.Duration
+	conn          net.Conn
+	stream        bool
+	prefix        string
+	tagFormat     *StatsdTagFormat
+	maxPacketSize int
+	flushInterval time.Duration
+
+	mu  sync.Mutex
+	buf []byte
+	err error
+
+	queue chan []byte
+	done  chan struct{}
+}
+
+// NewStatsdClient connects to the statsd server at addr, a host:port or,
+// for the unix and unixgram protocols, a socket path.
+func NewStatsdClient(protocol string, addr string, prefix string, tagFormat *StatsdTagFormat, options StatsdClientOptions) (*StatsdClient, error) {
+	switch protocol {
+	case "udp", "tcp", "unix", "unixgram":
+	default:
+		return nil, fmt.Errorf("unknown statsd protocol %q", protocol)
+	}
+
+	if options.MaxPacketSize < 0 || options.FlushInterval < 0 || options.SendQueueSize < 0 || options.Timeout < 0 {
+		return nil, errors.New("statsd max packet size, flush interval, send queue size and timeout must not be negative")
+	}
+
+	if options.MaxPacketSize == 0 {
+		options.MaxPacketSize = DefaultStatsdMaxPacketSize
+	}
+
+	conn, err := net.DialTimeout(protocol, addr, options.Timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &StatsdClient{
+		protocol:      protocol,
+		addr:          addr,
+		timeout:       options.Timeout,
+		conn:          conn,
+		stream:        protocol == "tcp" || protocol == "unix",
+		prefix:        prefix,
+		tagFormat:     tagFormat,
+		maxPacketSize: options.MaxPacketSize,
+		flushInterval: options.FlushInterval,
+		queue:         make(chan []byte, options.SendQueueSize),
+		done:          make(chan struct{}),
+	}
+
+	go c.sender()
+
+	return c, nil
+}
+
+// Gauge sets a gauge.
+func (c *StatsdClient) Gauge(name string, value float64, tags []StatsdTag) error {
+	return c.send(name, formatStatsdValue(value), "g", tags)
+}
+
+// Count increments a counter.
+func (c *StatsdClient) Count(name string, value float64, tags []StatsdTag) error {
+	return c.send(name, formatStatsdValue(value), "c", tags)
+}
+
+// Timing records a timing in milliseconds.
+func (c *StatsdClient) Timing(name string, milliseconds float64, tags []StatsdTag) error {
+	return c.send(name, formatStatsdValue(milliseconds), "ms", tags)
+}
+
+// Histogram records a value in a DogStatsD histogram, aggregated by the
+// agent.
+func (c *StatsdClient) Histogram(name string, value float64, tags []StatsdTag) error {
+	return c.send(name, formatStatsdValue(value), "h", tags)
+}
+
+// Distribution records a value in a DogStatsD distribution, aggregated
+// globally by Datadog.
+func (c *StatsdClient) Distribution(name string, value float64, tags []StatsdTag) error {
+	return c.send(name, formatStatsdValue(value), "d", tags)
+}
+
+// Set adds a member to a set.
+func (c *StatsdClient) Set(name string, member string, tags []StatsdTag) error {
+	return c.send(name, member, "s", tags)
+}
+
+// Close sends buffered and queued lines and closes the connection.
+func (c *StatsdClient) Close() error {
+	c.mu.Lock()
+	packet := c.takePacket()
+	c.mu.Unlock()
+
+	if packet != nil {
+		c.queue <- packet
+	}
+
+	close(c.queue)
+	<-c.done
+
+	err := c.sendErr()
+
+	if closeErr := c.conn.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (c *StatsdClient) send(name string, value string, statsdType string, tags []StatsdTag) error {
+	line := c.prefix + name
+
+	if c.tagFormat != nil && !c.tagFormat.Suffix {
+		line += c.formatTags(tags)
+	}
+
+	line += ":" + value + "|" + statsdType
+
+	if c.tagFormat != nil && c.tagFormat.Suffix {
+		line += c.formatTags(tags)
+	}
+
+	if err := c.sendErr(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	var packet []byte
+	if len(c.buf) > 0 && len(c.buf)+len(line)+1 > c.maxPacketSize {
+		packet = c.takePacket()
+	}
+	c.buf = append(c.buf, line...)
+	c.buf = append(c.buf, '\n')
+	c.mu.Unlock()
+
+	if packet != nil {
+		c.queue <- packet
+	}
+
+	return nil
+}
+
+func (c *StatsdClient) formatTags(tags []StatsdTag) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	formatted := make([]string, len(tags))
+	for i, tag := range tags {
+		formatted[i] = tag.Name + c.tagFormat.KeyValueSeparator + tag.Value
+	}
+
+	return c.tagFormat.FirstSeparator + strings.Join(formatted, c.tagFormat.OtherSeparator)
+}
+
+// takePacket returns the buffered lines and empties the buffer, it must be
+// called with mu held. Streams keep the newline terminating the last line
+// while packets drop it.
+func (c *StatsdClient) takePacket() []byte {
+	if len(c.buf) == 0 {
+		return nil
+	}
+
+	packet := c.buf
+	if !c.stream {
+		packet = packet[:len(packet)-1]
+	}
+	c.buf = nil
+
+	return packet
+}
+
+// sender writes queued packets until the queue is closed, and buffered
+// lines on every flush interval.
+func (c *StatsdClient) sender() {
+	defer close(c.done)
+
+	var tick <-chan time.Time
+
+	if c.flushInterval > 0 {
+		ticker := time.NewTicker(c.flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case packet, ok := <-c.queue:
+			if !ok {
+				return
+			}
+			c.write(packet)
+		case <-tick:
+			c.mu.Lock()
+			packet := c.takePacket()
+			c.mu.Unlock()
+
+			if packet != nil {
+				c.write(packet)
+			}
+		}
+	}
+}
+
+// write sends a packet, reconnecting and writing it again once if it
+// fails, and keeps the first error for send and Close to return. Packets
+// are discarded after an error. The lines of a stream packet written in
+// part before the error are sent twice.
+func (c *StatsdClient) write(packet []byte) {
+	if c.sendErr() != nil {
+		return
+	}
+
+	err := c.writeConn(packet)
+
+	if err != nil {
+		c.conn.Close()
+
+		var conn net.Conn
+		conn, err = net.DialTimeout(c.protocol, c.addr, c.timeout)
+
+		if err == nil {
+			c.conn = conn
+			err = c.writeConn(packet)
+		}
+	}
+
+	if err != nil {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+	}
+}
+
+// writeConn writes a packet within the timeout, if any.
+func (c *StatsdClient) writeConn(packet []byte) error {
+	if c.timeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+
+	_, err := c.conn.Write(packet)
+
+	return err
+}
+
+func (c *StatsdClient) sendErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+func formatStatsdValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// StatsdTypeRule sends metrics with a name matching Pattern as the statsd
+// Type, one of gauge, counter, timing, set, or the DogStatsD histogram or
+// distribution.
+type StatsdTypeRule struct {
+	Pattern *regexp.Regexp
+	Type    string
+}
+
+// ParseStatsdTypeRules parses rules of the form <regex>=<type>.
+func ParseStatsdTypeRules(rules []string) ([]StatsdTypeRule, error) {
+	var typeRules []StatsdTypeRule
+
+	for _, rule := range rules {
+		i := strings.LastIndex(rule, "=")
+
+		if i < 0 {
+			return nil, fmt.Errorf("invalid statsd type rule %q, expected <regex>=<type>", rule)
+		}
+
+		statsdType := strings.TrimSpace(rule[i+1:])
+
+		switch statsdType {
+		case "gauge", "counter", "timing", "set", "histogram", "distribution":
+		default:
+			return nil, fmt.Errorf("invalid statsd type %q in rule %q, expected gauge, counter, timing, set, histogram or distribution", statsdType, rule)
+		}
+
+		pattern, err := regexp.Compile(rule[:i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		typeRules = append(typeRules, StatsdTypeRule{Pattern: pattern, Type: statsdType})
+	}
+
+	return typeRules, nil
+}
+
+// ValidateStatsdCounters checks that metrics are only sent as statsd
+// counters with the delta counter mode. Statsd counters are incremented by
+// the value sent, so the cumulative values of Prometheus counters would be
+// counted again on every run.
+func ValidateStatsdCounters(typeRules []StatsdTypeRule, counterMode string) error {
+	if counterMode == CounterDelta {
+		return nil
+	}
+
+	for _, rule := range typeRules {
+		if rule.Type == "counter" {
+			return &FailureError{Class: FailureConfig, Err: fmt.Errorf("statsd type counter of rule %s=counter requires -counter-mode delta, to send the increase since the previous run", rule.Pattern)}
+		}
+	}
+
+	return nil
+}
+
+// statsdType returns the type of the first rule matching the metric name,
+// metrics not matching any rule are gauges.
+func statsdType(name string, typeRules []StatsdTypeRule) string {
+	for _, rule := range typeRules {
+		if rule.Pattern.MatchString(name) {
+			return rule.Type
+		}
+	}
+
+	return "gauge"
+}
+
+// SendToStatsD sends samples as gauges, or as the type of the first
+// matching type rule. Counters are incremented by the sample value, the
+// increase since the previous run with the delta counter mode, timing
+// values are taken to be seconds, the Prometheus base unit, and sets add
+// the value as a member. Histogram and distribution values are sent as is.
+func SendToStatsD(samples model.Vector, metricPrefix string, globalTagsArr []GlobalTag, config StatsdConfig) error {
+	tagFormat, ok := statsdTagFormats[config.TagFormat]
+
+	if !ok {
+		return fmt.Errorf("unknown statsd tag format %q", config.TagFormat)
+	}
+
+	addr := config.Host
+	if config.Protocol != "unix" && config.Protocol != "unixgram" {
+		addr = net.JoinHostPort(config.Host, config.Port)
+	}
+
+	s, err := NewStatsdClient(config.Protocol, addr, metricPrefix, tagFormat, config.Options)
+
+	if err != nil {
+		return err
+	}
+
+	var globalTags []StatsdTag
+	for _, tag := range globalTagsArr {
+		globalTags = append(globalTags, StatsdTag{Name: tag.Name, Value: tag.Value})
+	}
+
+	for _, sample := range samples {
+		name := string(sample.Metric["__name__"])
+
+		var metricTags []StatsdTag
+		for _, name := range sortedLabelNames(sample.Metric) {
+			tag := StatsdTag{Name: string(name), Value: string(sample.Metric[name])}
+			metricTags = append(metricTags, tag)
+		}
+
+		tags := append(globalTags, metricTags...)
+		value := float64(sample.Value)
+
+		switch statsdType(name, config.TypeRules) {
+		case "counter":
+			err = s.Count(name, value, tags)
+		case "timing":
+			err = s.Timing(name, value*1000, tags)
+		case "set":
+			err = s.Set(name, formatStatsdValue(value), tags)
+		case "histogram":
+			err = s.Histogram(name, value, tags)
+		case "distribution":
+			err = s.Distribution(name, value, tags)
+		default:
+			err = s.Gauge(name, value, tags)
+		}
+
+		if err != nil {
+			s.Close()
+			return err
+		}
+	}
+
+	return s.Close()
+}
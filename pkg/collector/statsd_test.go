@@ -0,0 +1,380 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendToStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	host, port, err := net.SplitHostPort(conn.LocalAddr().String())
+	assert.NoError(t, err)
+
+	samples := model.Vector{{
+		Metric: model.Metric{model.MetricNameLabel: "foo_ratio", "bar": "baz"},
+		Value:  0.25,
+	}}
+
+	err = SendToStatsD(samples, "prefix.", []GlobalTag{{Name: "env", Value: "test"}}, StatsdConfig{Protocol: "udp", Host: host, Port: port, TagFormat: "datadog"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "prefix.foo_ratio:0.25|g|#env:test,bar:baz", readStatsdPacket(t, conn))
+}
+
+func readStatsdPacket(t *testing.T, conn net.PacketConn) string {
+	buf := make([]byte, 65536)
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+
+	return string(buf[:n])
+}
+
+func TestSendToStatsDTypeRules(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	host, port, err := net.SplitHostPort(conn.LocalAddr().String())
+	assert.NoError(t, err)
+
+	typeRules, err := ParseStatsdTypeRules([]string{"_total$=counter", "_seconds$=timing", "^foo_=set", "_bytes$=histogram", "_duration$=distribution"})
+	assert.NoError(t, err)
+
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "requests_total"}, Value: 3},
+		{Metric: model.Metric{model.MetricNameLabel: "latency_seconds"}, Value: 0.5},
+		{Metric: model.Metric{model.MetricNameLabel: "foo_id"}, Value: 7},
+		{Metric: model.Metric{model.MetricNameLabel: "response_bytes"}, Value: 512},
+		{Metric: model.Metric{model.MetricNameLabel: "request_duration"}, Value: 0.25},
+		{Metric: model.Metric{model.MetricNameLabel: "temperature"}, Value: 21.5},
+	}
+
+	err = SendToStatsD(samples, "", nil, StatsdConfig{Protocol: "udp", Host: host, Port: port, TagFormat: "datadog", TypeRules: typeRules})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "requests_total:3|c\nlatency_seconds:500|ms\nfoo_id:7|s\nresponse_bytes:512|h\nrequest_duration:0.25|d\ntemperature:21.5|g", readStatsdPacket(t, conn))
+
+	_, err = ParseStatsdTypeRules([]string{"_total$=summary"})
+	assert.Error(t, err)
+
+	_, err = ParseStatsdTypeRules([]string{"_total$"})
+	assert.Error(t, err)
+}
+
+func TestValidateStatsdCounters(t *testing.T) {
+	typeRules, err := ParseStatsdTypeRules([]string{"_seconds$=timing", "_total$=counter"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, ValidateStatsdCounters(typeRules, CounterDelta))
+	assert.NoError(t, ValidateStatsdCounters(typeRules[:1], CounterRaw))
+
+	var failure *FailureError
+
+	err = ValidateStatsdCounters(typeRules, CounterRaw)
+	assert.EqualError(t, err, "statsd type counter of rule _total$=counter requires -counter-mode delta, to send the increase since the previous run")
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureConfig, failure.Class)
+	assert.Error(t, ValidateStatsdCounters(typeRules, CounterRate))
+}
+
+func TestSendToStatsDClientOptions(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	host, port, err := net.SplitHostPort(conn.LocalAddr().String())
+	assert.NoError(t, err)
+
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1},
+		{Metric: model.Metric{model.MetricNameLabel: "bar"}, Value: 2},
+		{Metric: model.Metric{model.MetricNameLabel: "baz"}, Value: 3},
+	}
+
+	err = SendToStatsD(samples, "", nil, StatsdConfig{Protocol: "udp", Host: host, Port: port, TagFormat: "none", Options: StatsdClientOptions{MaxPacketSize: 12}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "foo:1|g", readStatsdPacket(t, conn))
+	assert.Equal(t, "bar:2|g", readStatsdPacket(t, conn))
+	assert.Equal(t, "baz:3|g", readStatsdPacket(t, conn))
+
+	client, err := NewStatsdClient("udp", conn.LocalAddr().String(), "", nil, StatsdClientOptions{FlushInterval: 10 * time.Millisecond})
+	assert.NoError(t, err)
+	defer client.Close()
+
+	assert.NoError(t, client.Gauge("foo", 1, nil))
+	assert.Equal(t, "foo:1|g", readStatsdPacket(t, conn))
+
+	_, err = NewStatsdClient("udp", conn.LocalAddr().String(), "", nil, StatsdClientOptions{SendQueueSize: -1})
+	assert.Error(t, err)
+}
+
+func TestSendToStatsDTagFormat(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	host, port, err := net.SplitHostPort(conn.LocalAddr().String())
+	assert.NoError(t, err)
+
+	samples := model.Vector{{
+		Metric: model.Metric{model.MetricNameLabel: "foo", "bar": "baz"},
+		Value:  1,
+	}}
+
+	for tagFormat, expected := range map[string]string{
+		"datadog":  "foo:1|g|#bar:baz",
+		"influx":   "foo,bar=baz:1|g",
+		"graphite": "foo;bar=baz:1|g",
+		"none":     "foo:1|g",
+	} {
+		err := SendToStatsD(samples, "", nil, StatsdConfig{Protocol: "udp", Host: host, Port: port, TagFormat: tagFormat})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, readStatsdPacket(t, conn), tagFormat)
+	}
+
+	err = SendToStatsD(samples, "", nil, StatsdConfig{Protocol: "udp", Host: host, Port: port, TagFormat: "carbon"})
+	assert.Error(t, err)
+}
+
+func TestSendToStatsDStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer tcpListener.Close()
+
+	unixListener, err := net.Listen("unix", filepath.Join(dir, "statsd.sock"))
+	assert.NoError(t, err)
+	defer unixListener.Close()
+
+	host, port, err := net.SplitHostPort(tcpListener.Addr().String())
+	assert.NoError(t, err)
+
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1},
+		{Metric: model.Metric{model.MetricNameLabel: "bar"}, Value: 2},
+	}
+
+	for _, test := range []struct {
+		listener net.Listener
+		config   StatsdConfig
+	}{
+		{tcpListener, StatsdConfig{Protocol: "tcp", Host: host, Port: port, TagFormat: "datadog"}},
+		{unixListener, StatsdConfig{Protocol: "unix", Host: unixListener.Addr().String(), TagFormat: "datadog"}},
+	} {
+		received := make(chan string)
+		go func(listener net.Listener) {
+			conn, err := listener.Accept()
+			if err != nil {
+				received <- err.Error()
+				return
+			}
+			defer conn.Close()
+			data, _ := ioutil.ReadAll(conn)
+			received <- string(data)
+		}(test.listener)
+
+		err := SendToStatsD(samples, "", nil, test.config)
+
+		assert.NoError(t, err, test.config.Protocol)
+		assert.Equal(t, "foo:1|g\nbar:2|g\n", <-received, test.config.Protocol)
+	}
+
+	err = SendToStatsD(samples, "", nil, StatsdConfig{Protocol: "sctp", TagFormat: "datadog"})
+	assert.Error(t, err)
+}
+
+func TestStatsdClientBatching(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	client, err := NewStatsdClient("udp", conn.LocalAddr().String(), "", nil, StatsdClientOptions{MaxPacketSize: 16})
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.Gauge("a", 1, nil))
+	assert.NoError(t, client.Gauge("b", 2, nil))
+	assert.NoError(t, client.Gauge("c", 3, nil))
+	assert.NoError(t, client.Gauge("long_metric_name", 4, nil))
+	assert.NoError(t, client.Gauge("d", 5, nil))
+	assert.NoError(t, client.Close())
+
+	// Packets hold as many whole lines as fit, a line longer than a
+	// packet is sent on its own.
+	assert.Equal(t, "a:1|g\nb:2|g", readStatsdPacket(t, conn))
+	assert.Equal(t, "c:3|g", readStatsdPacket(t, conn))
+	assert.Equal(t, "long_metric_name:4|g", readStatsdPacket(t, conn))
+	assert.Equal(t, "d:5|g", readStatsdPacket(t, conn))
+}
+
+func TestStatsdClientCloseFlush(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	client, err := NewStatsdClient("udp", conn.LocalAddr().String(), "prefix.", nil, StatsdClientOptions{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.Gauge("a", 1, nil))
+	assert.NoError(t, client.Count("b", 2, nil))
+
+	// Lines are buffered until a packet is full or the client is closed.
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, _, err = conn.ReadFrom(make([]byte, 65536))
+	assert.Error(t, err)
+
+	assert.NoError(t, client.Close())
+	assert.Equal(t, "prefix.a:1|g\nprefix.b:2|c", readStatsdPacket(t, conn))
+}
+
+func TestStatsdClientStreamFraming(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	// An unbuffered send queue and packets of two lines make the sender
+	// write every packet while lines are still being added.
+	client, err := NewStatsdClient("tcp", listener.Addr().String(), "", nil, StatsdClientOptions{MaxPacketSize: 16, SendQueueSize: 0})
+	assert.NoError(t, err)
+
+	var expected string
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, client.Gauge("m", float64(i), nil))
+		expected += fmt.Sprintf("m:%d|g\n", i)
+	}
+
+	assert.NoError(t, client.Close())
+
+	// Every packet of a stream ends with a newline, so that lines of
+	// consecutive packets are not joined.
+	assert.Equal(t, expected, <-received)
+}
+
+func TestStatsdClientUnixgram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conn, err := net.ListenPacket("unixgram", filepath.Join(dir, "dsd.sock"))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 1},
+		{Metric: model.Metric{model.MetricNameLabel: "bar"}, Value: 2},
+	}
+
+	err = SendToStatsD(samples, "", nil, StatsdConfig{Protocol: "unixgram", Host: conn.LocalAddr().String(), TagFormat: "datadog"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "foo:1|g\nbar:2|g", readStatsdPacket(t, conn))
+}
+
+func TestStatsdClientReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan string)
+	go func() {
+		// The first connection is closed by the server, the client
+		// reconnects when writing to it fails.
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		conn.Close()
+
+		conn, err = listener.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	client, err := NewStatsdClient("tcp", listener.Addr().String(), "", nil, StatsdClientOptions{FlushInterval: 10 * time.Millisecond, Timeout: time.Second})
+	assert.NoError(t, err)
+
+	// The first packet is accepted by the kernel before the server resets
+	// the connection, and lost.
+	for i, name := range []string{"a", "b", "c"} {
+		assert.NoError(t, client.Gauge(name, float64(i+1), nil))
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	assert.NoError(t, client.Close())
+	assert.Equal(t, "b:2|g\nc:3|g\n", <-received)
+}
+
+func TestStatsdClientWriteTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	// The server accepts connections but never reads them, so writes block
+	// once the socket buffers are full.
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	client, err := NewStatsdClient("tcp", listener.Addr().String(), "", nil, StatsdClientOptions{MaxPacketSize: 65536, Timeout: 100 * time.Millisecond})
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		name := strings.Repeat("m", 1000)
+
+		for i := 0; i < 20000; i++ {
+			if err := client.Gauge(name, 1, nil); err != nil {
+				break
+			}
+		}
+
+		done <- client.Close()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("statsd client blocked on a stalled server")
+	}
+}
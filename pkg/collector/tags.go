@@ -0,0 +1,174 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// GlobalTagsEnv is the environment variable of global tags merged with
+// those of -global-tags-file and -global-tags.
+const GlobalTagsEnv = "COLLECTOR_GLOBAL_TAGS"
+
+// GlobalTag is a tag added to all metrics.
+type GlobalTag struct {
+	Name  string
+	Value string
+}
+
+// String returns the tag as name:value.
+func (t GlobalTag) String() string {
+	return t.Name + ":" + t.Value
+}
+
+// splitUnquoted splits s around the separators outside double quotes and
+// not escaped by a backslash, into at most n parts when n > 0. The parts are
+// returned as is, quotes and escapes included.
+func splitUnquoted(s string, sep rune, n int) []string {
+	var parts []string
+	start := 0
+	quoted, escaped := false, false
+
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == sep && !quoted && (n <= 0 || len(parts) < n-1):
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// unquoteTag trims the spaces around a tag name or value and removes its
+// double quotes and backslash escapes.
+func unquoteTag(s string) (string, error) {
+	var unquoted strings.Builder
+	quoted, escaped := false, false
+
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case escaped:
+			unquoted.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		default:
+			unquoted.WriteRune(r)
+		}
+	}
+
+	if quoted || escaped {
+		return "", errors.New("unterminated quote or escape")
+	}
+
+	return unquoted.String(), nil
+}
+
+// ParseGlobalTags parses comma separated name:value global tags. A tag is
+// split at its first colon, so values may contain colons, e.g. URLs or IPv6
+// addresses. Commas, colons and spaces can be kept in names and values by
+// double quoting them or escaping them with a backslash, e.g.
+// url:"http://example.com/a,b" or path:a\,b. The error lists every
+// malformed tag.
+func ParseGlobalTags(tags string) ([]GlobalTag, error) {
+	var parsed []GlobalTag
+	var malformed []string
+
+	for _, tag := range splitUnquoted(tags, ',', 0) {
+		if strings.TrimSpace(tag) == "" {
+			continue
+		}
+
+		kv := splitUnquoted(tag, ':', 2)
+
+		if len(kv) != 2 {
+			malformed = append(malformed, fmt.Sprintf("%q", strings.TrimSpace(tag)))
+			continue
+		}
+
+		name, err := unquoteTag(kv[0])
+
+		var value string
+		if err == nil {
+			value, err = unquoteTag(kv[1])
+		}
+
+		if err != nil || name == "" {
+			malformed = append(malformed, fmt.Sprintf("%q", strings.TrimSpace(tag)))
+			continue
+		}
+
+		parsed = append(parsed, GlobalTag{Name: name, Value: value})
+	}
+
+	if len(malformed) > 0 {
+		return nil, fmt.Errorf("malformed global tags %s, expected name:value", strings.Join(malformed, ", "))
+	}
+
+	return parsed, nil
+}
+
+// LoadGlobalTagsFile loads the global tags of a file, one or more comma
+// separated tags per line, parsed by ParseGlobalTags. Blank lines and lines
+// starting with # are ignored.
+func LoadGlobalTagsFile(path string) ([]GlobalTag, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tags []GlobalTag
+	scanner := bufio.NewScanner(f)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lineTags, err := ParseGlobalTags(line)
+
+		if err != nil {
+			return nil, fmt.Errorf("error parsing global tags file %s line %d: %v", path, n, err)
+		}
+
+		tags = append(tags, lineTags...)
+	}
+
+	return tags, scanner.Err()
+}
+
+// MergeGlobalTags merges lists of global tags, a tag replacing the tag of
+// the same name of an earlier list, in its position.
+func MergeGlobalTags(lists ...[]GlobalTag) []GlobalTag {
+	var merged []GlobalTag
+	positions := map[string]int{}
+
+	for _, tags := range lists {
+		for _, tag := range tags {
+			if i, ok := positions[tag.Name]; ok {
+				merged[i] = tag
+				continue
+			}
+
+			positions[tag.Name] = len(merged)
+			merged = append(merged, tag)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGlobalTags(t *testing.T) {
+	tags, err := ParseGlobalTags(` foo:bar, ,baz:qux `)
+	assert.NoError(t, err)
+	assert.Equal(t, []GlobalTag{{Name: "foo", Value: "bar"}, {Name: "baz", Value: "qux"}}, tags)
+
+	tags, err = ParseGlobalTags("")
+	assert.NoError(t, err)
+	assert.Nil(t, tags)
+
+	tags, err = ParseGlobalTags(`url:http://example.com:8080/metrics,ip:fe80::1,empty:`)
+	assert.NoError(t, err)
+	assert.Equal(t, []GlobalTag{
+		{Name: "url", Value: "http://example.com:8080/metrics"},
+		{Name: "ip", Value: "fe80::1"},
+		{Name: "empty", Value: ""},
+	}, tags)
+
+	tags, err = ParseGlobalTags(`note:"a, b",a\:b:c,path:x\,y,"quoted name":" v "`)
+	assert.NoError(t, err)
+	assert.Equal(t, []GlobalTag{
+		{Name: "note", Value: "a, b"},
+		{Name: "a:b", Value: "c"},
+		{Name: "path", Value: "x,y"},
+		{Name: "quoted name", Value: " v "},
+	}, tags)
+}
+
+func TestParseGlobalTagsErrors(t *testing.T) {
+	_, err := ParseGlobalTags(`foo:bar,novalue,:empty,bad:"open`)
+	assert.EqualError(t, err, `malformed global tags "novalue", ":empty", "bad:\"open", expected name:value`)
+}
+
+func TestLoadGlobalTagsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tags")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("# platform tags\nregion:eu-west-1\n\nenvironment:production,team:sre\nconsole:https://console.example.com\n"), 0644))
+
+	tags, err := LoadGlobalTagsFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []GlobalTag{
+		{Name: "region", Value: "eu-west-1"},
+		{Name: "environment", Value: "production"},
+		{Name: "team", Value: "sre"},
+		{Name: "console", Value: "https://console.example.com"},
+	}, tags)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("region:eu-west-1\nteam\n"), 0644))
+
+	_, err = LoadGlobalTagsFile(path)
+	assert.EqualError(t, err, `error parsing global tags file `+path+` line 2: malformed global tags "team", expected name:value`)
+
+	_, err = LoadGlobalTagsFile(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestMergeGlobalTags(t *testing.T) {
+	merged := MergeGlobalTags(
+		[]GlobalTag{{Name: "region", Value: "eu-west-1"}, {Name: "environment", Value: "production"}},
+		[]GlobalTag{{Name: "environment", Value: "staging"}},
+		[]GlobalTag{{Name: "team", Value: "sre"}, {Name: "region", Value: "eu-central-1"}},
+	)
+
+	assert.Equal(t, []GlobalTag{
+		{Name: "region", Value: "eu-central-1"},
+		{Name: "environment", Value: "staging"},
+		{Name: "team", Value: "sre"},
+	}, merged)
+}
@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// schemeLabel and metricsPathLabel are the target labels of the scheme
+	// and path of the metrics URL, as in Prometheus.
+	schemeLabel      = "__scheme__"
+	metricsPathLabel = "__metrics_path__"
+)
+
+// Target is an exporter to scrape, with the labels added to its samples.
+type Target struct {
+	URL    string
+	Labels model.LabelSet
+}
+
+// TargetGroup is a group of targets sharing labels, as in the Prometheus
+// file_sd format.
+type TargetGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+}
+
+// URLTargets returns the targets of exporter URLs, without labels.
+func URLTargets(exporterURLs []string) []Target {
+	targets := make([]Target, 0, len(exporterURLs))
+
+	for _, exporterURL := range exporterURLs {
+		targets = append(targets, Target{URL: exporterURL})
+	}
+
+	return targets
+}
+
+// LoadTargetsFile loads the target groups of a Prometheus file_sd file, in
+// YAML if its extension is .yml or .yaml and in JSON otherwise.
+func LoadTargetsFile(path string) ([]Target, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []TargetGroup
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = yaml.UnmarshalStrict(data, &groups)
+	default:
+		err = json.Unmarshal(data, &groups)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing targets file %s: %v", path, err)
+	}
+
+	targets, err := GroupTargets(groups)
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing targets file %s: %v", path, err)
+	}
+
+	return targets, nil
+}
+
+// GroupTargets returns the targets of target groups. A target is a
+// host:port address, scraped at <__scheme__>://<address><__metrics_path__>,
+// http and /metrics by default, or a URL. The instance label defaults to
+// the address and labels starting with __ are not added to the samples.
+func GroupTargets(groups []TargetGroup) ([]Target, error) {
+	var targets []Target
+
+	for _, group := range groups {
+		for name := range group.Labels {
+			if !model.LabelName(name).IsValid() {
+				return nil, fmt.Errorf("invalid target label name %q", name)
+			}
+		}
+
+		scheme := group.Labels[schemeLabel]
+		if scheme == "" {
+			scheme = "http"
+		}
+
+		metricsPath := group.Labels[metricsPathLabel]
+		if metricsPath == "" {
+			metricsPath = "/metrics"
+		}
+
+		for _, address := range group.Targets {
+			if address == "" {
+				return nil, fmt.Errorf("empty target address")
+			}
+
+			target := Target{URL: address, Labels: model.LabelSet{model.InstanceLabel: model.LabelValue(address)}}
+
+			if !strings.Contains(address, "://") {
+				target.URL = scheme + "://" + address + metricsPath
+			} else if instance, err := exporterInstance(address); err == nil {
+				target.Labels[model.InstanceLabel] = instance
+			}
+
+			for name, value := range group.Labels {
+				if !strings.HasPrefix(name, model.ReservedLabelPrefix) {
+					target.Labels[model.LabelName(name)] = model.LabelValue(value)
+				}
+			}
+
+			targets = append(targets, target)
+		}
+	}
+
+	return targets, nil
+}
+
+// addTargetLabels sets the target labels on the samples. As with
+// Prometheus target labels, a conflicting label exposed by the exporter is
+// kept with the exported_ prefix.
+func addTargetLabels(samples model.Vector, labels model.LabelSet) {
+	for _, sample := range samples {
+		for name, value := range labels {
+			if exported, ok := sample.Metric[name]; ok {
+				sample.Metric[model.ExportedLabelPrefix+name] = exported
+			}
+			sample.Metric[name] = value
+		}
+	}
+}
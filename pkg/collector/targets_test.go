@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupTargets(t *testing.T) {
+	targets, err := GroupTargets([]TargetGroup{
+		{Targets: []string{"server1:9100", "server2:9100"}, Labels: map[string]string{"job": "node", "__meta_dc": "eu"}},
+		{Targets: []string{"server3:8443"}, Labels: map[string]string{"__scheme__": "https", "__metrics_path__": "/probe"}},
+		{Targets: []string{"http://server4:9100/metrics"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Target{
+		{URL: "http://server1:9100/metrics", Labels: model.LabelSet{"instance": "server1:9100", "job": "node"}},
+		{URL: "http://server2:9100/metrics", Labels: model.LabelSet{"instance": "server2:9100", "job": "node"}},
+		{URL: "https://server3:8443/probe", Labels: model.LabelSet{"instance": "server3:8443"}},
+		{URL: "http://server4:9100/metrics", Labels: model.LabelSet{"instance": "server4:9100"}},
+	}, targets)
+
+	_, err = GroupTargets([]TargetGroup{{Targets: []string{"server1:9100"}, Labels: map[string]string{"invalid-name": "a"}}})
+	assert.EqualError(t, err, `invalid target label name "invalid-name"`)
+}
+
+func TestLoadTargetsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensu-prometheus-collector")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	jsonPath := filepath.Join(dir, "targets.json")
+	assert.NoError(t, ioutil.WriteFile(jsonPath, []byte(`[{"targets":["server1:9100"],"labels":{"job":"node"}}]`), 0644))
+
+	targets, err := LoadTargetsFile(jsonPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []Target{{URL: "http://server1:9100/metrics", Labels: model.LabelSet{"instance": "server1:9100", "job": "node"}}}, targets)
+
+	yamlPath := filepath.Join(dir, "targets.yml")
+	assert.NoError(t, ioutil.WriteFile(yamlPath, []byte("- targets:\n  - server1:9100\n  labels:\n    job: node\n"), 0644))
+
+	targets, err = LoadTargetsFile(yamlPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []Target{{URL: "http://server1:9100/metrics", Labels: model.LabelSet{"instance": "server1:9100", "job": "node"}}}, targets)
+
+	assert.NoError(t, ioutil.WriteFile(jsonPath, []byte(`{"targets":[]}`), 0644))
+
+	_, err = LoadTargetsFile(jsonPath)
+	assert.Error(t, err)
+
+	_, err = LoadTargetsFile(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestQueryTargets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`up{job="exporter"} 1` + "\n"))
+	}))
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	targets, err := GroupTargets([]TargetGroup{{Targets: []string{address}, Labels: map[string]string{"job": "node", "dc": "eu"}}})
+	assert.NoError(t, err)
+
+	samples, err := QueryTargets(targets, ExporterAuth{}, nil, ParseOptions{}, RequestOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1)
+	assert.Equal(t, model.Metric{
+		model.MetricNameLabel: "up",
+		"instance":            model.LabelValue(address),
+		"job":                 "node",
+		"exported_job":        "exporter",
+		"dc":                  "eu",
+	}, samples[0].Metric)
+}
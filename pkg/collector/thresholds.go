@@ -0,0 +1,143 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// Check statuses, the exit codes of Sensu and Nagios checks.
+const (
+	CheckOK       = 0
+	CheckWarning  = 1
+	CheckCritical = 2
+)
+
+// checkStatusNames are the Nagios names of the check statuses.
+var checkStatusNames = map[int]string{
+	CheckOK:       "OK",
+	CheckWarning:  "WARNING",
+	CheckCritical: "CRITICAL",
+}
+
+// ParseCheckStatus parses a check status name, ok, warning or critical.
+func ParseCheckStatus(name string) (int, error) {
+	for status, statusName := range checkStatusNames {
+		if strings.EqualFold(name, statusName) {
+			return status, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown check status %q, expected ok, warning or critical", name)
+}
+
+// Threshold is a comparison of sample values with a number, e.g. value > 0.9.
+type Threshold struct {
+	Operator string
+	Value    float64
+}
+
+// thresholdOperators are the supported comparisons, two character
+// operators first so they are not taken for their first character.
+var thresholdOperators = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// ParseThreshold parses a threshold expression, value <operator> <number>,
+// where the value may be left out and the operator is one of >, >=, <, <=,
+// == or !=.
+func ParseThreshold(expr string) (*Threshold, error) {
+	s := strings.TrimSpace(expr)
+	s = strings.TrimSpace(strings.TrimPrefix(s, "value"))
+
+	for _, operator := range thresholdOperators {
+		if !strings.HasPrefix(s, operator) {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(s[len(operator):]), 64)
+
+		if err != nil {
+			break
+		}
+
+		return &Threshold{Operator: operator, Value: value}, nil
+	}
+
+	return nil, fmt.Errorf("invalid threshold %q, expected value <operator> <number>, e.g. value > 0.9", expr)
+}
+
+// Match returns whether value breaches the threshold.
+func (t *Threshold) Match(value float64) bool {
+	switch t.Operator {
+	case ">":
+		return value > t.Value
+	case ">=":
+		return value >= t.Value
+	case "<":
+		return value < t.Value
+	case "<=":
+		return value <= t.Value
+	case "==":
+		return value == t.Value
+	case "!=":
+		return value != t.Value
+	}
+
+	return false
+}
+
+// String returns the threshold expression.
+func (t *Threshold) String() string {
+	return fmt.Sprintf("value %s %s", t.Operator, strconv.FormatFloat(t.Value, 'f', -1, 64))
+}
+
+// NagiosRange returns the Nagios plugin range of the values breaching the
+// threshold, e.g. ~:0.9 for value > 0.9, or an empty string for a nil
+// threshold. A range alerts on the values outside of it, inclusive of its
+// ends, or inside of it with a leading @.
+func (t *Threshold) NagiosRange() string {
+	if t == nil {
+		return ""
+	}
+
+	value := strconv.FormatFloat(t.Value, 'f', -1, 64)
+
+	switch t.Operator {
+	case ">":
+		return "~:" + value
+	case ">=":
+		return "@" + value + ":~"
+	case "<":
+		return value + ":"
+	case "<=":
+		return "@~:" + value
+	case "==":
+		return "@" + value + ":" + value
+	case "!=":
+		return value + ":" + value
+	}
+
+	return ""
+}
+
+// CheckStatus returns CheckCritical when a sample value breaches the
+// critical threshold, CheckWarning when one breaches the warning threshold
+// and CheckOK otherwise. Either threshold may be nil.
+func CheckStatus(samples model.Vector, warning *Threshold, critical *Threshold) int {
+	status := CheckOK
+
+	for _, sample := range samples {
+		value := float64(sample.Value)
+
+		if critical != nil && critical.Match(value) {
+			return CheckCritical
+		}
+
+		if warning != nil && warning.Match(value) {
+			status = CheckWarning
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseThreshold(t *testing.T) {
+	for expr, expected := range map[string]Threshold{
+		"value > 0.9":  {">", 0.9},
+		"value>=1":     {">=", 1},
+		"< -5":         {"<", -5},
+		" value != 0 ": {"!=", 0},
+		"==1e3":        {"==", 1000},
+	} {
+		threshold, err := ParseThreshold(expr)
+
+		if assert.NoError(t, err, expr) {
+			assert.Equal(t, expected, *threshold, expr)
+		}
+	}
+
+	for _, expr := range []string{"", "value", "value ~ 1", "value > high", "count > 1"} {
+		_, err := ParseThreshold(expr)
+		assert.Error(t, err, expr)
+	}
+
+	threshold := &Threshold{">=", 0.9}
+	assert.True(t, threshold.Match(0.9))
+	assert.False(t, threshold.Match(0.8))
+	assert.Equal(t, "value >= 0.9", threshold.String())
+}
+
+func TestCheckStatus(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "foo"}, Value: 0.5},
+		{Metric: model.Metric{model.MetricNameLabel: "bar"}, Value: 0.95},
+	}
+
+	warning := &Threshold{">", 0.9}
+	critical := &Threshold{">", 0.99}
+
+	assert.Equal(t, CheckOK, CheckStatus(samples, nil, nil))
+	assert.Equal(t, CheckWarning, CheckStatus(samples, warning, critical))
+	assert.Equal(t, CheckCritical, CheckStatus(samples, warning, &Threshold{"<", 0.6}))
+	assert.Equal(t, CheckOK, CheckStatus(model.Vector{}, warning, critical))
+}
+
+func TestParseCheckStatus(t *testing.T) {
+	for name, expected := range map[string]int{"ok": CheckOK, "warning": CheckWarning, "CRITICAL": CheckCritical} {
+		status, err := ParseCheckStatus(name)
+
+		assert.NoError(t, err)
+		assert.Equal(t, expected, status)
+	}
+
+	_, err := ParseCheckStatus("unknown")
+	assert.EqualError(t, err, `unknown check status "unknown", expected ok, warning or critical`)
+}
+
+func TestThresholdNagiosRange(t *testing.T) {
+	ranges := map[string]string{
+		"value > 0.9":  "~:0.9",
+		"value >= 0.9": "@0.9:~",
+		"value < 10":   "10:",
+		"value <= 10":  "@~:10",
+		"value == 0":   "@0:0",
+		"value != 1":   "1:1",
+	}
+
+	for expr, nagiosRange := range ranges {
+		threshold, err := ParseThreshold(expr)
+		assert.NoError(t, err)
+		assert.Equal(t, nagiosRange, threshold.NagiosRange(), expr)
+	}
+
+	var none *Threshold
+	assert.Equal(t, "", none.NagiosRange())
+}
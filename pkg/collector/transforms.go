@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// transformOperation matches an operation of a value transform, e.g. *100
+// or -273.15.
+var transformOperation = regexp.MustCompile(`^\s*([*/+-])\s*([+-]?(?:[0-9]*\.)?[0-9]+(?:[eE][+-]?[0-9]+)?)`)
+
+// ValueTransform applies arithmetic operations, in order, to the values of
+// metrics with a name matching Pattern.
+type ValueTransform struct {
+	Pattern    *regexp.Regexp
+	Operations []ValueOperation
+}
+
+// ValueOperation is an arithmetic operation, *, /, + or -, with an operand.
+type ValueOperation struct {
+	Operator string
+	Operand  float64
+}
+
+// ParseValueTransforms parses transforms of the form <regex>=<operations>,
+// e.g. _ratio$=*100 or ^temperature_celsius$=*1.8+32.
+func ParseValueTransforms(transforms []string) ([]ValueTransform, error) {
+	var parsed []ValueTransform
+
+	for _, transform := range transforms {
+		i := strings.LastIndex(transform, "=")
+
+		if i < 0 {
+			return nil, fmt.Errorf("invalid value transform %q, expected <regex>=<operations>", transform)
+		}
+
+		pattern, err := regexp.Compile(transform[:i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		t := ValueTransform{Pattern: pattern}
+
+		for operations := transform[i+1:]; strings.TrimSpace(operations) != ""; {
+			match := transformOperation.FindStringSubmatch(operations)
+
+			if match == nil {
+				return nil, fmt.Errorf("invalid value transform %q, expected operations like *100, /8, +32 or -273.15", transform)
+			}
+
+			operand, err := strconv.ParseFloat(match[2], 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid value transform %q: %v", transform, err)
+			}
+
+			t.Operations = append(t.Operations, ValueOperation{Operator: match[1], Operand: operand})
+			operations = operations[len(match[0]):]
+		}
+
+		if len(t.Operations) == 0 {
+			return nil, fmt.Errorf("invalid value transform %q, expected operations like *100, /8, +32 or -273.15", transform)
+		}
+
+		parsed = append(parsed, t)
+	}
+
+	return parsed, nil
+}
+
+// Apply returns value with the operations applied.
+func (t ValueTransform) Apply(value float64) float64 {
+	for _, operation := range t.Operations {
+		switch operation.Operator {
+		case "*":
+			value *= operation.Operand
+		case "/":
+			value /= operation.Operand
+		case "+":
+			value += operation.Operand
+		case "-":
+			value -= operation.Operand
+		}
+	}
+
+	return value
+}
+
+// TransformValues applies the first transform matching the metric name to
+// the value of every sample. The samples that change are copied.
+func TransformValues(samples model.Vector, transforms []ValueTransform) model.Vector {
+	transformed := make(model.Vector, 0, len(samples))
+
+	for _, sample := range samples {
+		for _, transform := range transforms {
+			if transform.Pattern.MatchString(string(sample.Metric[model.MetricNameLabel])) {
+				copied := *sample
+				copied.Value = model.SampleValue(transform.Apply(float64(sample.Value)))
+				sample = &copied
+				break
+			}
+		}
+
+		transformed = append(transformed, sample)
+	}
+
+	return transformed
+}
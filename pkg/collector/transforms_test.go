@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransformValues(t *testing.T) {
+	transforms, err := ParseValueTransforms([]string{"_ratio$=*100", "^temperature_celsius$= * 1.8 + 32", "_kelvin$=-273.15", "_bits$=/8"})
+	assert.NoError(t, err)
+	assert.Equal(t, []ValueOperation{{"*", 1.8}, {"+", 32}}, transforms[1].Operations)
+
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "node_scrape_ratio"}, Value: 0.25},
+		{Metric: model.Metric{model.MetricNameLabel: "temperature_celsius"}, Value: 20},
+		{Metric: model.Metric{model.MetricNameLabel: "sensor_kelvin"}, Value: 300},
+		{Metric: model.Metric{model.MetricNameLabel: "link_speed_bits"}, Value: 1e9},
+		{Metric: model.Metric{model.MetricNameLabel: "node_load1"}, Value: 0.5},
+	}
+
+	transformed := TransformValues(samples, transforms)
+
+	assert.Equal(t, model.SampleValue(25), transformed[0].Value)
+	assert.Equal(t, model.SampleValue(68), transformed[1].Value)
+	assert.InDelta(t, 26.85, float64(transformed[2].Value), 1e-9)
+	assert.Equal(t, model.SampleValue(1.25e8), transformed[3].Value)
+	assert.Equal(t, samples[4], transformed[4])
+	assert.Equal(t, model.SampleValue(0.25), samples[0].Value)
+
+	assert.Equal(t, -5.0, ValueTransform{Operations: []ValueOperation{{"*", -1}, {"-", 3}, {"+", -2}}}.Apply(0))
+}
+
+func TestParseValueTransforms(t *testing.T) {
+	for _, transform := range []string{"_ratio$", "_ratio$=", "_ratio$=100", "_ratio$=*", "_ratio$=*100%", "(=*100"} {
+		_, err := ParseValueTransforms([]string{transform})
+		assert.Error(t, err, transform)
+	}
+}
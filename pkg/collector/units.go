@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// unitFactors are the units of unit conversions, by their size in the base
+// unit of their quantity.
+var unitFactors = map[string]struct {
+	quantity string
+	factor   float64
+}{
+	"seconds":      {"time", 1},
+	"milliseconds": {"time", 1e-3},
+	"microseconds": {"time", 1e-6},
+	"nanoseconds":  {"time", 1e-9},
+	"minutes":      {"time", 60},
+	"hours":        {"time", 3600},
+	"bytes":        {"size", 1},
+	"kilobytes":    {"size", 1e3},
+	"megabytes":    {"size", 1e6},
+	"gigabytes":    {"size", 1e9},
+	"kibibytes":    {"size", 1 << 10},
+	"mebibytes":    {"size", 1 << 20},
+	"gibibytes":    {"size", 1 << 30},
+	"bits":         {"size", 0.125},
+	"ratio":        {"ratio", 1},
+	"percent":      {"ratio", 0.01},
+}
+
+// UnitConversion converts the values of metrics with a name matching
+// Pattern from one unit to another, rewriting the unit in the name.
+type UnitConversion struct {
+	Pattern *regexp.Regexp
+	From    string
+	To      string
+	factor  float64
+	unit    *regexp.Regexp
+}
+
+// ParseUnitConversions parses conversions of the form <regex>=<from>:<to>,
+// e.g. _seconds=seconds:milliseconds.
+func ParseUnitConversions(conversions []string) ([]UnitConversion, error) {
+	var parsed []UnitConversion
+
+	for _, conversion := range conversions {
+		i := strings.LastIndex(conversion, "=")
+		units := strings.Split(conversion[i+1:], ":")
+
+		if i < 0 || len(units) != 2 {
+			return nil, fmt.Errorf("invalid unit conversion %q, expected <regex>=<from>:<to>", conversion)
+		}
+
+		from, fromOK := unitFactors[units[0]]
+		to, toOK := unitFactors[units[1]]
+
+		if !fromOK || !toOK || from.quantity != to.quantity {
+			return nil, fmt.Errorf("invalid unit conversion %q, expected units of the same quantity, seconds, milliseconds, microseconds, nanoseconds, minutes, hours, bytes, kilobytes, megabytes, gigabytes, kibibytes, mebibytes, gibibytes, bits, ratio or percent", conversion)
+		}
+
+		pattern, err := regexp.Compile(conversion[:i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		parsed = append(parsed, UnitConversion{
+			Pattern: pattern,
+			From:    units[0],
+			To:      units[1],
+			factor:  from.factor / to.factor,
+			unit:    regexp.MustCompile(`_` + units[0] + `(_total|_sum|_count|_bucket)?$`),
+		})
+	}
+
+	return parsed, nil
+}
+
+// ConvertUnits converts the samples of the metrics matching a conversion,
+// by the first one matching, and rewrites the unit in their name, e.g.
+// http_request_duration_seconds_sum becomes
+// http_request_duration_milliseconds_sum. Histogram _count and _bucket
+// values are counts, so only their name and bucket bounds are converted.
+// The samples that change are copied.
+func ConvertUnits(samples model.Vector, conversions []UnitConversion) model.Vector {
+	converted := make(model.Vector, 0, len(samples))
+
+	for _, sample := range samples {
+		name := string(sample.Metric[model.MetricNameLabel])
+
+		for _, conversion := range conversions {
+			if !conversion.Pattern.MatchString(name) {
+				continue
+			}
+
+			copied := *sample
+			copied.Metric = sample.Metric.Clone()
+
+			suffix := ""
+			if match := conversion.unit.FindStringSubmatch(name); match != nil {
+				suffix = match[1]
+				copied.Metric[model.MetricNameLabel] = model.LabelValue(name[:len(name)-len(match[0])] + "_" + conversion.To + suffix)
+			}
+
+			if suffix == "_bucket" {
+				if le, err := strconv.ParseFloat(string(sample.Metric["le"]), 64); err == nil {
+					copied.Metric["le"] = model.LabelValue(strconv.FormatFloat(le*conversion.factor, 'g', -1, 64))
+				}
+			}
+
+			if suffix != "_count" && suffix != "_bucket" {
+				copied.Value = model.SampleValue(float64(sample.Value) * conversion.factor)
+			}
+
+			sample = &copied
+			break
+		}
+
+		converted = append(converted, sample)
+	}
+
+	return converted
+}
@@ -0,0 +1,58 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertUnits(t *testing.T) {
+	conversions, err := ParseUnitConversions([]string{"^http_request_duration_seconds=seconds:milliseconds", "_bytes$=bytes:megabytes"})
+	assert.NoError(t, err)
+
+	samples := model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "http_request_duration_seconds_sum"}, Value: 1.5},
+		{Metric: model.Metric{model.MetricNameLabel: "http_request_duration_seconds_count"}, Value: 10},
+		{Metric: model.Metric{model.MetricNameLabel: "http_request_duration_seconds_bucket", "le": "0.25"}, Value: 7},
+		{Metric: model.Metric{model.MetricNameLabel: "http_request_duration_seconds_bucket", "le": "+Inf"}, Value: 10},
+		{Metric: model.Metric{model.MetricNameLabel: "node_memory_MemFree_bytes"}, Value: 2500000},
+		{Metric: model.Metric{model.MetricNameLabel: "node_load1"}, Value: 0.5},
+	}
+
+	assert.Equal(t, model.Vector{
+		{Metric: model.Metric{model.MetricNameLabel: "http_request_duration_milliseconds_sum"}, Value: 1500},
+		{Metric: model.Metric{model.MetricNameLabel: "http_request_duration_milliseconds_count"}, Value: 10},
+		{Metric: model.Metric{model.MetricNameLabel: "http_request_duration_milliseconds_bucket", "le": "250"}, Value: 7},
+		{Metric: model.Metric{model.MetricNameLabel: "http_request_duration_milliseconds_bucket", "le": "+Inf"}, Value: 10},
+		{Metric: model.Metric{model.MetricNameLabel: "node_memory_MemFree_megabytes"}, Value: 2.5},
+		samples[5],
+	}, ConvertUnits(samples, conversions))
+
+	// The samples are copied, not modified.
+	assert.Equal(t, model.SampleValue(1.5), samples[0].Value)
+
+	// Metrics without the unit in their name keep their name.
+	conversions, err = ParseUnitConversions([]string{"^node_scrape_ratio$=ratio:percent"})
+	assert.NoError(t, err)
+	converted := ConvertUnits(model.Vector{{Metric: model.Metric{model.MetricNameLabel: "node_scrape_ratio"}, Value: 0.25}}, conversions)
+	assert.Equal(t, model.LabelValue("node_scrape_percent"), converted[0].Metric[model.MetricNameLabel])
+	assert.Equal(t, model.SampleValue(25), converted[0].Value)
+
+	converted = ConvertUnits(model.Vector{{Metric: model.Metric{model.MetricNameLabel: "process_uptime"}, Value: 120}}, []UnitConversion{mustUnitConversion(t, "uptime=seconds:minutes")})
+	assert.Equal(t, model.LabelValue("process_uptime"), converted[0].Metric[model.MetricNameLabel])
+	assert.Equal(t, model.SampleValue(2), converted[0].Value)
+}
+
+func mustUnitConversion(t *testing.T, conversion string) UnitConversion {
+	conversions, err := ParseUnitConversions([]string{conversion})
+	assert.NoError(t, err)
+	return conversions[0]
+}
+
+func TestParseUnitConversions(t *testing.T) {
+	for _, conversion := range []string{"_seconds", "_seconds=seconds", "_seconds=seconds:bytes", "_seconds=seconds:fortnights", "(=seconds:milliseconds"} {
+		_, err := ParseUnitConversions([]string{conversion})
+		assert.Error(t, err, conversion)
+	}
+}
@@ -0,0 +1,231 @@
+package collector
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VaultSecretPrefix is the prefix of credential option values resolved
+// from Vault, vault:<path>#<field>, e.g. vault:secret/data/sensu#password.
+const VaultSecretPrefix = "vault:"
+
+// VaultConfig configures the Vault client resolving secrets.
+type VaultConfig struct {
+	// Address is the Vault server URL, e.g. https://vault:8200.
+	Address string
+	Token   string
+	// Namespace is the Vault Enterprise namespace, if any.
+	Namespace string
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+}
+
+// VaultConfigFromEnv returns the Vault configuration of the standard Vault
+// environment variables, VAULT_ADDR, VAULT_TOKEN, or else the token of the
+// ~/.vault-token file of vault login, VAULT_NAMESPACE, VAULT_CACERT,
+// VAULT_CLIENT_CERT, VAULT_CLIENT_KEY and VAULT_SKIP_VERIFY.
+func VaultConfigFromEnv(timeout time.Duration) (VaultConfig, error) {
+	config := VaultConfig{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Timeout:   timeout,
+	}
+
+	if config.Address == "" {
+		config.Address = "https://127.0.0.1:8200"
+	}
+
+	if config.Token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if token, err := ioutil.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				config.Token = strings.TrimSpace(string(token))
+			}
+		}
+	}
+
+	if config.Token == "" {
+		return config, errors.New("a Vault token is required, set VAULT_TOKEN or log in with vault login")
+	}
+
+	skipVerify := false
+	if value := os.Getenv("VAULT_SKIP_VERIFY"); value != "" {
+		var err error
+		if skipVerify, err = strconv.ParseBool(value); err != nil {
+			return config, fmt.Errorf("invalid VAULT_SKIP_VERIFY %q: %v", value, err)
+		}
+	}
+
+	tlsConfig, err := NewTLSConfig(os.Getenv("VAULT_CACERT"), os.Getenv("VAULT_CLIENT_CERT"), os.Getenv("VAULT_CLIENT_KEY"), skipVerify)
+
+	if err != nil {
+		return config, err
+	}
+
+	config.TLSConfig = tlsConfig
+
+	return config, nil
+}
+
+// VaultClient reads secrets from Vault, each path once.
+type VaultClient struct {
+	config  VaultConfig
+	client  *http.Client
+	secrets map[string]map[string]interface{}
+}
+
+// NewVaultClient returns a client of the Vault server in config.
+func NewVaultClient(config VaultConfig) *VaultClient {
+	return &VaultClient{
+		config: config,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: config.TLSConfig,
+			},
+			Timeout: config.Timeout,
+		},
+		secrets: map[string]map[string]interface{}{},
+	}
+}
+
+// Read returns the data of the secret at path. The data of KV version 2
+// secrets, read from <mount>/data/<path>, is unwrapped from its metadata.
+func (c *VaultClient) Read(path string) (map[string]interface{}, error) {
+	path = strings.Trim(path, "/")
+
+	if data, ok := c.secrets[path]; ok {
+		return data, nil
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(c.config.Address, "/")+"/v1/"+path, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-Vault-Token", c.config.Token)
+
+	if c.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.config.Namespace)
+	}
+
+	resp, err := c.client.Do(req)
+
+	if err != nil {
+		return nil, &FailureError{Class: FailureUnreachable, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := errors.New("vault returned non 2xx HTTP response status reading " + path + ": " + resp.Status + ": " + strings.TrimSpace(string(respBody)))
+
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized {
+			return nil, &FailureError{Class: FailureAuth, Err: err}
+		}
+
+		return nil, err
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("failed to decode Vault secret %s: %v", path, err)
+	}
+
+	data := secret.Data
+
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	c.secrets[path] = data
+
+	return data, nil
+}
+
+// Resolve returns the field of the secret of a <path>#<field> reference.
+func (c *VaultClient) Resolve(reference string) (string, error) {
+	i := strings.LastIndex(reference, "#")
+
+	if i <= 0 || i == len(reference)-1 {
+		return "", fmt.Errorf("invalid Vault secret reference %q, expected <path>#<field>", reference)
+	}
+
+	path, field := reference[:i], reference[i+1:]
+
+	data, err := c.Read(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := data[field]
+
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no field %q", path, field)
+	}
+
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case float64, bool:
+		return fmt.Sprint(value), nil
+	default:
+		return "", fmt.Errorf("vault secret %s field %q is not a string", path, field)
+	}
+}
+
+// ResolveVaultSecrets replaces the VaultSecretPrefix values of the named
+// flags with the secrets they reference. The Vault configuration is only
+// read from the environment when a flag references Vault.
+func ResolveVaultSecrets(flags *flag.FlagSet, names []string, timeout time.Duration) error {
+	var client *VaultClient
+
+	for _, name := range names {
+		f := flags.Lookup(name)
+
+		if f == nil || !strings.HasPrefix(f.Value.String(), VaultSecretPrefix) {
+			continue
+		}
+
+		if client == nil {
+			config, err := VaultConfigFromEnv(timeout)
+
+			if err != nil {
+				return &FailureError{Class: FailureConfig, Err: err}
+			}
+
+			client = NewVaultClient(config)
+			defer client.client.CloseIdleConnections()
+		}
+
+		secret, err := client.Resolve(strings.TrimPrefix(f.Value.String(), VaultSecretPrefix))
+
+		if err != nil {
+			return fmt.Errorf("-%s: %w", name, err)
+		}
+
+		if err := f.Value.Set(secret); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
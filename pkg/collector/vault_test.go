@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newVaultServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/sensu":
+			assert.Equal(t, "team", r.Header.Get("X-Vault-Namespace"))
+			w.Write([]byte(`{"data":{"data":{"password":"s3cret","port":8080},"metadata":{"version":1}}}`))
+		case "/v1/kv/sensu":
+			w.Write([]byte(`{"data":{"token":"abc","nested":{"a":"b"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+}
+
+func TestVaultClientResolve(t *testing.T) {
+	server := newVaultServer(t)
+	defer server.Close()
+
+	client := NewVaultClient(VaultConfig{Address: server.URL, Token: "root", Namespace: "team", Timeout: time.Second})
+
+	secret, err := client.Resolve("secret/data/sensu#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", secret)
+
+	secret, err = client.Resolve("secret/data/sensu#port")
+	assert.NoError(t, err)
+	assert.Equal(t, "8080", secret)
+
+	secret, err = client.Resolve("/kv/sensu#token")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", secret)
+
+	_, err = client.Resolve("kv/sensu#nested")
+	assert.EqualError(t, err, `vault secret kv/sensu field "nested" is not a string`)
+
+	_, err = client.Resolve("kv/sensu#missing")
+	assert.EqualError(t, err, `vault secret kv/sensu has no field "missing"`)
+
+	_, err = client.Resolve("kv/sensu")
+	assert.EqualError(t, err, `invalid Vault secret reference "kv/sensu", expected <path>#<field>`)
+
+	_, err = client.Resolve("kv/missing#token")
+	assert.Error(t, err)
+
+	client = NewVaultClient(VaultConfig{Address: server.URL, Token: "wrong", Timeout: time.Second})
+
+	_, err = client.Resolve("kv/sensu#token")
+	var failure *FailureError
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureAuth, failure.Class)
+}
+
+func TestResolveVaultSecrets(t *testing.T) {
+	server := newVaultServer(t)
+	defer server.Close()
+
+	for name, value := range map[string]string{"VAULT_ADDR": server.URL, "VAULT_TOKEN": "root", "VAULT_NAMESPACE": "team"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	password := flags.String("password", "", "")
+	token := flags.String("token", "", "")
+	user := flags.String("user", "", "")
+
+	assert.NoError(t, flags.Parse([]string{"-password", "vault:secret/data/sensu#password", "-token", "plain", "-user", "vault:secret/data/sensu#password"}))
+	assert.NoError(t, ResolveVaultSecrets(flags, []string{"password", "token"}, time.Second))
+	assert.Equal(t, "s3cret", *password)
+	assert.Equal(t, "plain", *token)
+	assert.Equal(t, "vault:secret/data/sensu#password", *user)
+
+	assert.NoError(t, flags.Set("password", "vault:secret/data/sensu#missing"))
+	assert.EqualError(t, ResolveVaultSecrets(flags, []string{"password"}, time.Second), `-password: vault secret secret/data/sensu has no field "missing"`)
+}
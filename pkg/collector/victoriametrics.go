@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// VictoriaMetricsConfig configures the sendtovictoriametrics output.
+type VictoriaMetricsConfig struct {
+	// URL is the VictoriaMetrics base URL, samples are posted to
+	// /api/v1/import/prometheus.
+	URL string
+	// ExtraLabels are name=value labels VictoriaMetrics adds to every
+	// imported sample.
+	ExtraLabels []string
+	TLSConfig   *tls.Config
+	Timeout     time.Duration
+}
+
+// SendToVictoriaMetrics posts samples in the Prometheus text exposition
+// format to the VictoriaMetrics /api/v1/import/prometheus endpoint.
+func SendToVictoriaMetrics(samples model.Vector, metricPrefix string, metricTypes MetricTypes, config VictoriaMetricsConfig) error {
+	query := url.Values{}
+
+	for _, extraLabel := range config.ExtraLabels {
+		if !strings.Contains(extraLabel, "=") {
+			return fmt.Errorf("invalid VictoriaMetrics extra label %q, expected <name>=<value>", extraLabel)
+		}
+
+		query.Add("extra_label", extraLabel)
+	}
+
+	importURL := strings.TrimSuffix(config.URL, "/") + "/api/v1/import/prometheus"
+	if len(query) > 0 {
+		importURL += "?" + query.Encode()
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config.TLSConfig,
+		},
+		Timeout: config.Timeout,
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Post(importURL, "text/plain", strings.NewReader(CreatePrometheusMetrics(samples, metricPrefix, metricTypes)))
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return errors.New("victoriametrics returned non 2xx HTTP response status: " + resp.Status + ": " + strings.TrimSpace(string(respBody)))
+	}
+
+	return nil
+}
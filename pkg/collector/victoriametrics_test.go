@@ -0,0 +1,36 @@
+package collector
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendToVictoriaMetrics(t *testing.T) {
+	var body string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/import/prometheus", r.URL.Path)
+		assert.Equal(t, []string{"env=prod", "dc=eu"}, r.URL.Query()["extra_label"])
+
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	samples := model.Vector{{Metric: model.Metric{model.MetricNameLabel: "up", "job": "node"}, Value: 1, Timestamp: model.Time(1506991233000)}}
+
+	err := SendToVictoriaMetrics(samples, "", nil, VictoriaMetricsConfig{URL: ts.URL, ExtraLabels: []string{"env=prod", "dc=eu"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "up{job=\"node\"} 1 1506991233000\n", body)
+
+	err = SendToVictoriaMetrics(samples, "", nil, VictoriaMetricsConfig{URL: ts.URL, ExtraLabels: []string{"env"}})
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"strings"
+	"sync"
+)
+
+// MultiError is the errors of the targets failing in a run, in target
+// order.
+type MultiError []error
+
+func (e MultiError) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the first error, so the exit code is that of the first
+// failing target.
+func (e MultiError) Unwrap() error {
+	return e[0]
+}
+
+// multiError returns the non-nil errors as a MultiError, the error itself
+// if there is only one and nil if there are none.
+func multiError(errs []error) error {
+	var failed MultiError
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	default:
+		return failed
+	}
+}
+
+// runConcurrently calls work for every index below n, on at most
+// concurrency goroutines at a time, 1 if concurrency is less, and waits for
+// them to return.
+func runConcurrently(n int, concurrency int, work func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < concurrency && worker < n; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				work(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+
+	wg.Wait()
+}
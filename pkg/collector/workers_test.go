@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	done := make([]bool, 10)
+
+	runConcurrently(len(done), 3, func(i int) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		done[i] = true
+		mu.Unlock()
+	})
+
+	assert.Equal(t, 3, maxRunning)
+	for i := range done {
+		assert.True(t, done[i])
+	}
+
+	runConcurrently(0, 3, func(i int) {
+		t.Fail()
+	})
+}
+
+func TestMultiError(t *testing.T) {
+	assert.NoError(t, multiError([]error{nil, nil}))
+
+	first := &FailureError{Class: FailureAuth, Err: errors.New("a: 401")}
+	assert.Equal(t, first, multiError([]error{nil, first}))
+
+	err := multiError([]error{first, nil, errors.New("b: connection refused")})
+	assert.EqualError(t, err, "a: 401; b: connection refused")
+
+	var failure *FailureError
+	assert.True(t, errors.As(err, &failure))
+	assert.Equal(t, FailureAuth, failure.Class)
+}
+
+func TestQueryExportersConcurrently(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			w.Write([]byte("# TYPE a_total counter\na_total 1\n"))
+		case "/b":
+			w.Write([]byte("# TYPE b gauge\nb 2\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	types := MetricTypes{}
+	samples, err := QueryExporters([]string{server.URL + "/a", server.URL + "/b"}, ExporterAuth{}, nil, ParseOptions{Types: types}, RequestOptions{Concurrency: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.LabelValue{"a_total", "b"}, []model.LabelValue{samples[0].Metric[model.MetricNameLabel], samples[1].Metric[model.MetricNameLabel]})
+	assert.Equal(t, MetricTypes{"a_total": "counter", "b": "gauge"}, types)
+
+	samples, err = QueryExporters([]string{server.URL + "/missing", server.URL + "/a", server.URL + "/gone"}, ExporterAuth{}, nil, ParseOptions{}, RequestOptions{Concurrency: 2})
+	assert.Len(t, samples, 1)
+	assert.Equal(t, model.LabelValue("a_total"), samples[0].Metric[model.MetricNameLabel])
+	assert.EqualError(t, err, server.URL+"/missing: exporter returned non OK HTTP response status: 404 Not Found; "+server.URL+"/gone: exporter returned non OK HTTP response status: 404 Not Found")
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sensu/sensu-prometheus-collector/pkg/collector"
+)
+
+// InterruptContext returns a context canceled on the first SIGINT or
+// SIGTERM, for the in-flight scrapes and queries to be canceled and the
+// samples collected so far to be output before exiting, rather than dying
+// mid-write. A second signal kills the collector.
+func InterruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		collector.Warnf("Received %s, shutting down", sig)
+		cancel()
+	}()
+
+	return ctx
+}
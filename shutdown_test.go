@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorInterrupted(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	for _, args := range [][]string{
+		{"-exporter-url", server.URL},
+		{"-exporter-url", server.URL, "-interval", "50ms"},
+	} {
+		cmd := exec.Command(os.Args[0])
+		cmd.Env = append(os.Environ(), "COLLECTOR_TEST_ARGS="+strings.Join(args, "\n"))
+
+		assert.NoError(t, cmd.Start())
+		time.Sleep(200 * time.Millisecond)
+		cmd.Process.Signal(syscall.SIGTERM)
+
+		err := cmd.Wait()
+
+		var exitErr *exec.ExitError
+		if assert.True(t, errors.As(err, &exitErr), args) {
+			assert.Equal(t, 130, exitErr.ExitCode(), args)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+
+	"github.com/prometheus/common/model"
+)
+
+// BuildInfoMetric is the name of the -build-info sample.
+const BuildInfoMetric = "sensu_prometheus_collector_build_info"
+
+// The version, commit and date of the build, set by goreleaser with
+// -ldflags "-X main.version=... -X main.commit=... -X main.date=...".
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
+// BuildInfo describes the build of the collector.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// CurrentBuildInfo returns the build info of the running collector.
+func CurrentBuildInfo() BuildInfo {
+	return BuildInfo{Version: version, Commit: commit, Date: date, GoVersion: runtime.Version()}
+}
+
+// FormatVersion formats the build info for -version, as text or json.
+func (b BuildInfo) FormatVersion(format string) (string, error) {
+	switch format {
+	case "text":
+		return fmt.Sprintf("sensu-prometheus-collector version %s, commit %s, built %s with %s\n", b.Version, b.Commit, b.Date, b.GoVersion), nil
+	case "json":
+		data, err := json.Marshal(b)
+		return string(data) + "\n", err
+	}
+
+	return "", fmt.Errorf("unknown version format %q, expected text or json", format)
+}
+
+// Sample returns the BuildInfoMetric sample of the build, always 1, with
+// the build info as labels, as the Prometheus build_info metrics.
+func (b BuildInfo) Sample(timestamp model.Time) *model.Sample {
+	return &model.Sample{
+		Metric: model.Metric{
+			model.MetricNameLabel: BuildInfoMetric,
+			"version":             model.LabelValue(b.Version),
+			"revision":            model.LabelValue(b.Commit),
+			"goversion":           model.LabelValue(b.GoVersion),
+		},
+		Value:     1,
+		Timestamp: timestamp,
+	}
+}
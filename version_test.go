@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildInfo(t *testing.T) {
+	info := BuildInfo{Version: "1.4.0", Commit: "5fe4a76", Date: "2020-10-16T12:00:00Z", GoVersion: "go1.13"}
+
+	output, err := info.FormatVersion("text")
+	assert.NoError(t, err)
+	assert.Equal(t, "sensu-prometheus-collector version 1.4.0, commit 5fe4a76, built 2020-10-16T12:00:00Z with go1.13\n", output)
+
+	output, err = info.FormatVersion("json")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"version":"1.4.0","commit":"5fe4a76","date":"2020-10-16T12:00:00Z","go_version":"go1.13"}`+"\n", output)
+
+	_, err = info.FormatVersion("yaml")
+	assert.Error(t, err)
+
+	assert.Equal(t, `sensu_prometheus_collector_build_info{goversion="go1.13", revision="5fe4a76", version="1.4.0"} => 1 @[1506991200]`, info.Sample(1506991200000).String())
+}